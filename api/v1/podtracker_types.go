@@ -1,9 +1,16 @@
 package v1
 
 import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
 	"github.com/gccloudone-aurora/podtracker/internal/writer"
 	"github.com/gobwas/glob"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -19,21 +26,185 @@ func namespaceIsWatched(namespace string, nsToWatch []string) bool {
 	return false
 }
 
+// selectorMatches returns true if the provided labels match the selector. A nil selector matches everything, and an invalid selector nothing
+func selectorMatches(selector *metav1.LabelSelector, objLabels map[string]string) bool {
+	if selector == nil {
+		return true
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false
+	}
+	return s.Matches(labels.Set(objLabels))
+}
+
+// TrackingMode describes how the deletion of tracked Pods is observed
+// +kubebuilder:validation:Enum=Finalizer;Watch
+type TrackingMode string
+
+const (
+	// FinalizerTrackingMode adds a finalizer to tracked Pods, so that their deletion is always observed before they are removed.
+	// Pod deletions are blocked while the controller is unavailable
+	FinalizerTrackingMode TrackingMode = "Finalizer"
+	// WatchTrackingMode observes the deletion of tracked Pods from watch events without modifying them.
+	// Pods deleted while the controller is unavailable are detected (with less accurate details) when it starts again
+	WatchTrackingMode TrackingMode = "Watch"
+)
+
+// OwnerExclusion excludes the Pods controlled by a kind of owner
+type OwnerExclusion struct {
+	// Kind is the kind of the controller of the excluded Pods (e.g. DaemonSet, ReplicaSet, StatefulSet, Job or Node for static Pods)
+	//+kubebuilder:validation:MinLength=1
+	Kind string `json:"kind"`
+
+	// HostNetworkOnly only excludes the Pods which use the host network
+	//+optional
+	HostNetworkOnly bool `json:"hostNetworkOnly,omitempty"`
+}
+
+// Excludes returns true if the provided Pod is excluded
+func (e OwnerExclusion) Excludes(pod *corev1.Pod) bool {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind != e.Kind {
+		return false
+	}
+	return !e.HostNetworkOnly || pod.Spec.HostNetwork
+}
+
 // PodTrackerSpec defines configuration options for the PodTracker controller
 type PodTrackerSpec struct {
-	// NSToWatch is a list of namespaces where Pods should be watched and logged.
-	// If empty, PodTracker will watch all namespaces
+	// NSToWatch is a list of namespaces (which may contain glob patterns) where Pods should be watched and logged.
+	// At least one of nsToWatch and namespaceSelector must be set. If both are set, a namespace must match both
 	//+optional
 	NSToWatch []string `json:"nsToWatch,omitempty" patchStrategy:"merge"`
 
+	// NamespaceSelector selects the namespaces where Pods should be watched and logged by the labels of the Namespaces,
+	// so that namespaces are brought under tracking as soon as they are labelled (e.g. when a tenant is onboarded).
+	// It also applies to the Services and namespaced resources recorded by the PodTracker
+	//+optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// PodSelector restricts the tracked Pods to the Pods with matching labels, in the namespaces selected by nsToWatch and namespaceSelector.
+	// It is evaluated against the labels of a Pod when it is recorded. If not set, every Pod of the selected namespaces is tracked
+	//+optional
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+
+	// NSToIgnore is a list of namespaces (which may contain glob patterns) excluded from the namespaces selected by nsToWatch and namespaceSelector
+	// (e.g. every namespace except kube-system). It also applies to the Services and namespaced resources recorded by the PodTracker
+	//+optional
+	NSToIgnore []string `json:"nsToIgnore,omitempty"`
+
+	// PodExclusionSelector excludes the Pods with matching labels from the Pods selected by the PodTracker. It is evaluated after podSelector
+	//+optional
+	PodExclusionSelector *metav1.LabelSelector `json:"podExclusionSelector,omitempty"`
+
+	// ExcludedOwners excludes Pods from the Pods selected by the PodTracker by the kind of the controller which owns them (e.g. DaemonSet Pods on the host network).
+	// Only the direct controller of a Pod is considered, so Deployment Pods are excluded by their ReplicaSet kind
+	//+optional
+	ExcludedOwners []OwnerExclusion `json:"excludedOwners,omitempty"`
+
 	// BackendWriterConfig configures one or many BackendWriter for PodTracker to use
 	// A BackendWriter will take the structured PodInfo from pod create/delete events and transforms and writes them to some log/output backend
 	//
 	// Currently, the following backends are supported:
 	//   - stdout: writes all data to stdout on the controller pod
+	//   - plugins: streams all data over gRPC to external writer plugins (typically running as a sidecar)
+	//
+	// Sensitive values (tokens, certificates) are referenced from Secrets in the namespace that the podtracker controller runs in
 	//
 	//+optional
 	BackendWriterConfig writer.BackendWriterConfig `json:"backendWriterConfig,omitempty"`
+
+	// Projection configures which Pod labels and annotations are recorded, and how their values are transformed
+	// (hashed, masked or size limited) before a record reaches any BackendWriter.
+	// If not set, all labels and annotations are recorded as-is
+	//+optional
+	Projection *tracking.ProjectionConfig `json:"projection,omitempty"`
+
+	// Integrity configures tamper-evident records. When enabled, the records written by each BackendWriter form a hash chain
+	// which can be checked with `podtrackerctl verify`
+	//+optional
+	Integrity *writer.IntegrityConfig `json:"integrity,omitempty"`
+
+	// Enrichment selects optional Pod details (service account, containers, images, ports, host namespaces, Services and Node topology) to record.
+	// If not set, none of these details are recorded
+	//+optional
+	Enrichment *tracking.EnrichmentConfig `json:"enrichment,omitempty"`
+
+	// Events is a list of additional Pod lifecycle events to record. Create, Delete, NetworkUpdate and Snapshot events are always recorded
+	//
+	// The following events are supported:
+	//   - IPAssigned: IPs are first observed for a Pod
+	//   - IPChanged: the IPs of a Pod change
+	//   - Ready: a Pod becomes ready
+	//   - Terminated: a Pod succeeds or fails (records the exit codes and reasons of its containers)
+	//   - Evicted: a Pod is evicted, preempted or otherwise disrupted
+	//   - Rescheduled: a Pod replaces a Pod with the same name on a different Node (e.g. a StatefulSet Pod)
+	//   - ServicesChanged: the Services fronting a Pod change (requires enrichment.services)
+	//
+	//+optional
+	Events []tracking.PodEvent `json:"events,omitempty"`
+
+	// TrackingMode configures how the deletion of tracked Pods is observed:
+	//   - Finalizer: a finalizer is added to tracked Pods, so that their deletion is always observed before they are removed.
+	//     Pod deletions (including namespace deletions and node drains) are blocked while the controller is unavailable
+	//   - Watch: the deletion of tracked Pods is observed from watch events, without modifying Pods.
+	//     Pods deleted while the controller is unavailable are recorded with less accurate details when it starts again
+	//
+	// A finalizer is added to a Pod if any of the PodTrackers tracking it uses the Finalizer mode.
+	// If not set, the default tracking mode of the controller is used
+	//+optional
+	TrackingMode TrackingMode `json:"trackingMode,omitempty"`
+
+	// TimestampFormat configures how the timestamps of records are formatted:
+	//   - RFC3339Nano: UTC timestamps with nanosecond precision (e.g. "2024-05-01T13:04:05.123456789Z")
+	//   - Legacy: timestamps with second precision and a numeric time zone (e.g. "2024-05-01T13:04:05+0000"), as recorded by earlier versions of PodTracker
+	//
+	// If not set, RFC3339Nano is used
+	//+optional
+	TimestampFormat tracking.TimestampFormat `json:"timestampFormat,omitempty"`
+
+	// SchemaVersion is the version of the records written by the PodTracker, so that consumers can keep parsing the records they
+	// were built for while they are updated:
+	//   - v1 (deprecated): the records of PodTracker 1.0.0. Only Create and Delete events are recorded, with legacy timestamps
+	//   - v2: the current records, which contain a schemaVersion field
+	//
+	// The JSON Schema of each version is printed by `podtrackerctl schema`. If not set, the current version (v2) is used
+	//+optional
+	SchemaVersion tracking.SchemaVersion `json:"schemaVersion,omitempty"`
+
+	// TrackServices enables the recording of the IPs allocated to the Services in the watched namespaces: their cluster IPs, external IPs
+	// and load balancer ingress points, when they are assigned (Create), changed (IPChanged) and released (Delete).
+	// Service records have a recordType of "Service" and are written by the same BackendWriters as Pod records.
+	// Services are not recorded by PodTrackers with the v1 schema version
+	//+optional
+	TrackServices bool `json:"trackServices,omitempty"`
+
+	// TrackNodes enables the recording of the addresses and Pod IP ranges of the Nodes of the cluster, when Nodes join (Join), change
+	// their addresses (AddressesChanged) or Pod IP ranges (PodCIDRsChanged), and leave (Leave). This lets the traffic of host-network Pods and the
+	// egress traffic SNAT'd to Node IPs be attributed even when Pods outlive a change of the IPs of their Node.
+	// Node records have a recordType of "Node" and are written by the same BackendWriters as Pod records. Nodes are recorded regardless of `spec.nsToWatch`,
+	// and are not recorded by PodTrackers with the v1 schema version
+	//+optional
+	TrackNodes bool `json:"trackNodes,omitempty"`
+
+	// Resources is a list of other resources holding IPs to record (e.g. CiliumEndpoints, Calico WorkloadEndpoints or egress gateways),
+	// each described by its group, version and kind, and JSONPath expressions of its identifier and IP fields.
+	// The IPs of the resources are recorded when they are first observed (Create), when they change (IPChanged) and when the resources are deleted (Delete).
+	// Resource records have a recordType of "Resource" and are written by the same BackendWriters as Pod records. Namespaced resources are tracked
+	// in the namespaces in `spec.nsToWatch`, and cluster-scoped resources are always tracked.
+	// The controller must be granted get, list and watch permissions on the resources. Resources are not recorded by PodTrackers with the v1 schema version
+	//+optional
+	Resources []tracking.ResourceRule `json:"resources,omitempty"`
+
+	// InventoryIntervalMinutes enables the periodic recording of an inventory of every Pod tracked by the PodTracker which holds IPs
+	// (its UID, name, namespace, IPs and Node), every InventoryIntervalMinutes minutes. Inventories let consumers reconcile their state and
+	// detect the records they have missed, e.g. while the controller was down or because a record was dropped.
+	// Inventory records have a recordType of "Inventory" and are written by the same BackendWriters as Pod records.
+	// Inventories are not recorded by PodTrackers with the v1 schema version
+	//+kubebuilder:validation:Minimum=1
+	//+optional
+	InventoryIntervalMinutes int32 `json:"inventoryIntervalMinutes,omitempty"`
 }
 
 // PodTrackerStatus defines the observed state of PodTracker
@@ -52,15 +223,217 @@ type PodTracker struct {
 	Status PodTrackerStatus `json:"status,omitempty"`
 }
 
-// GetWriters returns a list of objects that implement the writer.BackendWriter interface
-func (p PodTracker) GetWriters() []writer.BackendWriter {
-	return p.Spec.BackendWriterConfig.GetWriters()
+// GetWriters builds a list of objects that implement the writer.BackendWriter interface.
+// The returned writers may hold open connections, so the caller is responsible for closing them once they are no longer used
+func (p PodTracker) GetWriters(ctx context.Context, secrets writer.SecretResolver) ([]writer.BackendWriter, error) {
+	writers, err := p.Spec.BackendWriterConfig.GetWriters(ctx, secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := p.Spec.Integrity.Wrap(ctx, p.chainID(), writers, secrets)
+	if err != nil {
+		writer.CloseAll(writers)
+		return nil, err
+	}
+	return wrapped, nil
+}
+
+// chainID returns the ID of the hash chains begun by the writers of the PodTracker (see IntegrityConfig). It changes when the PodTracker
+// is recreated or updated, so that the chains begun for a new PodTracker (or when integrity is enabled again) are not mistaken for
+// chains restarted after records were removed. Chains continued by rebuilt writers keep their ID
+func (p PodTracker) chainID() string {
+	return fmt.Sprintf("%s/%d", p.GetUID(), p.GetGeneration())
+}
+
+// SecretReferences returns all the Secret keys referenced by the PodTracker
+func (p PodTracker) SecretReferences() []writer.SecretKeySelector {
+	return append(p.Spec.BackendWriterConfig.SecretReferences(), p.Spec.Integrity.SecretReferences()...)
+}
+
+// ProjectPodInfo returns a copy of the provided PodInfo marked as tracked by the PodTracker, in the PodTracker's schema version, with its timestamp format, projection and enrichment rules applied.
+// An error is returned if the projection or enrichment rules of the PodTracker are invalid
+func (p PodTracker) ProjectPodInfo(info *tracking.PodInfo) (*tracking.PodInfo, error) {
+	projected := *info
+	projected.TrackedBy = p.GetName()
+	projected.SchemaVersion = p.schemaVersion()
+	projected.FormatTimestamps(p.Spec.TimestampFormat)
+	// the projection is applied first, so that no details derived from the labels and annotations it removes are recorded
+	if err := p.Spec.Projection.Project(&projected); err != nil {
+		return nil, fmt.Errorf("unable to apply the projection of PodTracker %q: %w", p.GetName(), err)
+	}
+	if err := p.Spec.Enrichment.Enrich(&projected); err != nil {
+		return nil, fmt.Errorf("unable to apply the enrichment of PodTracker %q: %w", p.GetName(), err)
+	}
+	return &projected, nil
+}
+
+// CompilePatterns compiles the key patterns of the projection and enrichment rules of the PodTracker, so that they are compiled once
+// when the PodTracker is registered rather than for every record
+func (p *PodTracker) CompilePatterns() {
+	p.Spec.Projection.Compile()
+	p.Spec.Enrichment.Compile()
+}
+
+// ProjectServiceRecord returns a copy of the provided ServiceRecord marked as tracked by the PodTracker, with its timestamp format applied
+func (p PodTracker) ProjectServiceRecord(record *tracking.ServiceRecord) *tracking.ServiceRecord {
+	projected := *record
+	projected.TrackedBy = p.GetName()
+	projected.FormatTimestamps(p.Spec.TimestampFormat)
+	return &projected
+}
+
+// ProjectNodeRecord returns a copy of the provided NodeRecord marked as tracked by the PodTracker, with its timestamp format applied
+func (p PodTracker) ProjectNodeRecord(record *tracking.NodeRecord) *tracking.NodeRecord {
+	projected := *record
+	projected.TrackedBy = p.GetName()
+	projected.FormatTimestamps(p.Spec.TimestampFormat)
+	return &projected
+}
+
+// ProjectResourceRecord returns a copy of the provided ResourceRecord marked as tracked by the PodTracker, with its timestamp format applied
+func (p PodTracker) ProjectResourceRecord(record *tracking.ResourceRecord) *tracking.ResourceRecord {
+	projected := *record
+	projected.TrackedBy = p.GetName()
+	projected.FormatTimestamps(p.Spec.TimestampFormat)
+	return &projected
+}
+
+// ProjectInventoryRecord returns a copy of the provided InventoryRecord marked as tracked by the PodTracker, with its timestamp format applied
+func (p PodTracker) ProjectInventoryRecord(record *tracking.InventoryRecord) *tracking.InventoryRecord {
+	projected := *record
+	projected.TrackedBy = p.GetName()
+	projected.FormatTimestamps(p.Spec.TimestampFormat)
+	return &projected
+}
+
+// RecordsEvent returns true if records of the provided event are written by the PodTracker
+func (p PodTracker) RecordsEvent(event tracking.PodEvent) bool {
+	if p.schemaVersion() == tracking.SchemaVersionV1 {
+		return event == tracking.PodCreateEvent || event == tracking.PodDeleteEvent
+	}
+	if !event.IsOptional() {
+		return true
+	}
+	for _, e := range p.Spec.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaVersion returns the schema version of the records written by the PodTracker
+func (p PodTracker) schemaVersion() tracking.SchemaVersion {
+	if p.Spec.SchemaVersion == "" {
+		return tracking.CurrentSchemaVersion
+	}
+	return p.Spec.SchemaVersion
+}
+
+// UsesFinalizer returns true if the PodTracker adds a finalizer to the Pods it tracks. defaultMode is used if the PodTracker doesn't set a tracking mode
+func (p PodTracker) UsesFinalizer(defaultMode TrackingMode) bool {
+	mode := p.Spec.TrackingMode
+	if mode == "" {
+		mode = defaultMode
+	}
+	return mode != WatchTrackingMode
+}
+
+// ReferencesSecret returns true if any of the writers configured for the PodTracker reference the named Secret
+func (p PodTracker) ReferencesSecret(name string) bool {
+	for _, ref := range p.SecretReferences() {
+		if ref.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// WatchesNamespace returns true if the namespace with the provided name and labels is selected by `spec.nsToWatch` and `spec.namespaceSelector`,
+// and isn't excluded by `spec.nsToIgnore`.
+// namespaceLabels are nil if the labels of the namespace are unknown (e.g. because it was deleted while the controller was down),
+// in which case a namespace is not selected by a namespaceSelector
+func (p PodTracker) WatchesNamespace(namespace string, namespaceLabels map[string]string) bool {
+	if len(p.Spec.NSToWatch) == 0 && p.Spec.NamespaceSelector == nil {
+		return false
+	}
+	if len(p.Spec.NSToWatch) > 0 && !namespaceIsWatched(namespace, p.Spec.NSToWatch) {
+		return false
+	}
+	if namespaceIsWatched(namespace, p.Spec.NSToIgnore) {
+		return false
+	}
+	if namespaceLabels == nil {
+		return p.Spec.NamespaceSelector == nil
+	}
+	return selectorMatches(p.Spec.NamespaceSelector, namespaceLabels)
 }
 
 // TracksPod returns true if the provided Pod is tracked by the PodTracker.
-// A Pod is considered as being tracked by the calling PodTracker if the namespace that contains the Pod is in the configured `spec.nsToWatch`
-func (p PodTracker) TracksPod(obj client.Object) bool {
-	return namespaceIsWatched(obj.GetNamespace(), p.Spec.NSToWatch)
+// A Pod is considered as being tracked by the calling PodTracker if the namespace that contains the Pod is selected by the configured `spec.nsToWatch`,
+// `spec.namespaceSelector` and `spec.nsToIgnore` (see WatchesNamespace), its labels match the configured `spec.podSelector`, and it isn't excluded
+// by the configured `spec.podExclusionSelector` and `spec.excludedOwners`
+func (p PodTracker) TracksPod(obj client.Object, namespaceLabels map[string]string) bool {
+	if !p.WatchesNamespace(obj.GetNamespace(), namespaceLabels) || !selectorMatches(p.Spec.PodSelector, obj.GetLabels()) {
+		return false
+	}
+	return !p.excludesPod(obj)
+}
+
+// excludesPod returns true if the provided Pod is excluded by the configured `spec.podExclusionSelector` or `spec.excludedOwners`
+func (p PodTracker) excludesPod(obj client.Object) bool {
+	if p.Spec.PodExclusionSelector != nil && selectorMatches(p.Spec.PodExclusionSelector, obj.GetLabels()) {
+		return true
+	}
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return false
+	}
+	for _, exclusion := range p.Spec.ExcludedOwners {
+		if exclusion.Excludes(pod) {
+			return true
+		}
+	}
+	return false
+}
+
+// TracksService returns true if the provided Service is tracked by the PodTracker.
+// A Service is tracked if the PodTracker tracks Services and the namespace that contains the Service is selected by the PodTracker (see WatchesNamespace)
+func (p PodTracker) TracksService(obj client.Object, namespaceLabels map[string]string) bool {
+	return p.Spec.TrackServices && p.schemaVersion() != tracking.SchemaVersionV1 && p.WatchesNamespace(obj.GetNamespace(), namespaceLabels)
+}
+
+// InventoryInterval returns the period in which the PodTracker records an inventory of the Pods it tracks, or zero if it doesn't record them
+func (p PodTracker) InventoryInterval() time.Duration {
+	if p.Spec.InventoryIntervalMinutes <= 0 || p.schemaVersion() == tracking.SchemaVersionV1 {
+		return 0
+	}
+	return time.Duration(p.Spec.InventoryIntervalMinutes) * time.Minute
+}
+
+// TracksNodes returns true if the PodTracker records the Nodes of the cluster
+func (p PodTracker) TracksNodes() bool {
+	return p.Spec.TrackNodes && p.schemaVersion() != tracking.SchemaVersionV1
+}
+
+// TracksResource returns the ResourceRule of the provided resource if it is tracked by the PodTracker.
+// A resource is tracked if the PodTracker has a rule for its kind and, for namespaced resources, if its namespace is selected by the PodTracker (see WatchesNamespace)
+func (p PodTracker) TracksResource(obj client.Object, namespaceLabels map[string]string) (tracking.ResourceRule, bool) {
+	if p.schemaVersion() == tracking.SchemaVersionV1 {
+		return tracking.ResourceRule{}, false
+	}
+	if obj.GetNamespace() != "" && !p.WatchesNamespace(obj.GetNamespace(), namespaceLabels) {
+		return tracking.ResourceRule{}, false
+	}
+
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	for _, rule := range p.Spec.Resources {
+		if rule.GroupVersionKind() == gvk {
+			return rule, true
+		}
+	}
+	return tracking.ResourceRule{}, false
 }
 
 //+kubebuilder:object:root=true
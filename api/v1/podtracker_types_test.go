@@ -0,0 +1,156 @@
+package v1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+var _ = Describe("PodTracker", func() {
+	production := map[string]string{"env": "production"}
+	selectProduction := &metav1.LabelSelector{MatchLabels: production}
+
+	DescribeTable("selectorMatches",
+		func(selector *metav1.LabelSelector, objLabels map[string]string, expected bool) {
+			Expect(selectorMatches(selector, objLabels)).To(Equal(expected))
+		},
+		Entry("matches everything with a nil selector", nil, map[string]string{"env": "dev"}, true),
+		Entry("matches everything with an empty selector", &metav1.LabelSelector{}, nil, true),
+		Entry("matches labels selected by the selector", selectProduction, map[string]string{"env": "production", "team": "a"}, true),
+		Entry("doesn't match labels which aren't selected", selectProduction, map[string]string{"env": "dev"}, false),
+		Entry("doesn't match missing labels", selectProduction, nil, false),
+		Entry("matches nothing with an invalid selector", &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "env", Operator: "Unknown"}},
+		}, production, false),
+	)
+
+	DescribeTable("WatchesNamespace",
+		func(spec PodTrackerSpec, namespace string, namespaceLabels map[string]string, expected bool) {
+			pt := PodTracker{Spec: spec}
+			Expect(pt.WatchesNamespace(namespace, namespaceLabels)).To(Equal(expected))
+		},
+		Entry("doesn't watch any namespace without nsToWatch or namespaceSelector",
+			PodTrackerSpec{}, "apps", production, false),
+		Entry("watches the namespaces matching nsToWatch",
+			PodTrackerSpec{NSToWatch: []string{"app*"}}, "apps", map[string]string{}, true),
+		Entry("doesn't watch the namespaces which don't match nsToWatch",
+			PodTrackerSpec{NSToWatch: []string{"app*"}}, "kube-system", map[string]string{}, false),
+		Entry("watches the namespaces selected by the namespaceSelector",
+			PodTrackerSpec{NamespaceSelector: selectProduction}, "apps", production, true),
+		Entry("doesn't watch the namespaces which aren't selected by the namespaceSelector",
+			PodTrackerSpec{NamespaceSelector: selectProduction}, "apps", map[string]string{"env": "dev"}, false),
+		Entry("requires a namespace selected by the namespaceSelector to match nsToWatch as well",
+			PodTrackerSpec{NSToWatch: []string{"apps"}, NamespaceSelector: selectProduction}, "other", production, false),
+		Entry("requires a namespace matching nsToWatch to be selected by the namespaceSelector as well",
+			PodTrackerSpec{NSToWatch: []string{"apps"}, NamespaceSelector: selectProduction}, "apps", map[string]string{"env": "dev"}, false),
+		Entry("watches the namespaces matching both nsToWatch and the namespaceSelector",
+			PodTrackerSpec{NSToWatch: []string{"apps"}, NamespaceSelector: selectProduction}, "apps", production, true),
+		Entry("doesn't watch the namespaces matching nsToIgnore, even if they are selected",
+			PodTrackerSpec{NamespaceSelector: selectProduction, NSToIgnore: []string{"app*"}}, "apps", production, false),
+		Entry("watches a namespace whose labels are unknown when there is no namespaceSelector",
+			PodTrackerSpec{NSToWatch: []string{"apps"}}, "apps", nil, true),
+		Entry("doesn't watch a namespace whose labels are unknown with a namespaceSelector",
+			PodTrackerSpec{NamespaceSelector: selectProduction}, "apps", nil, false),
+		Entry("watches a namespace without labels with a namespaceSelector matching everything",
+			PodTrackerSpec{NamespaceSelector: &metav1.LabelSelector{}}, "apps", map[string]string{}, true),
+	)
+
+	DescribeTable("TracksPod",
+		func(spec PodTrackerSpec, podLabels map[string]string, namespaceLabels map[string]string, expected bool) {
+			pt := PodTracker{Spec: spec}
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "apps", Labels: podLabels}}
+			Expect(pt.TracksPod(pod, namespaceLabels)).To(Equal(expected))
+		},
+		Entry("tracks the Pods of a watched namespace",
+			PodTrackerSpec{NSToWatch: []string{"apps"}}, map[string]string{"app": "web"}, map[string]string{}, true),
+		Entry("doesn't track the Pods of a namespace which isn't watched",
+			PodTrackerSpec{NamespaceSelector: selectProduction}, map[string]string{"app": "web"}, map[string]string{"env": "dev"}, false),
+		Entry("tracks the Pods selected by the podSelector",
+			PodTrackerSpec{NSToWatch: []string{"apps"}, PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}},
+			map[string]string{"app": "web"}, map[string]string{}, true),
+		Entry("doesn't track the Pods which aren't selected by the podSelector",
+			PodTrackerSpec{NSToWatch: []string{"apps"}, PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}},
+			map[string]string{"app": "db"}, map[string]string{}, false),
+		Entry("doesn't track the Pods excluded by the podExclusionSelector",
+			PodTrackerSpec{NSToWatch: []string{"apps"}, PodExclusionSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}},
+			map[string]string{"app": "web"}, map[string]string{}, false),
+	)
+
+	isController := true
+
+	// ownedPod returns a Pod controlled by an owner of the provided kind (or without a controller if kind is empty)
+	ownedPod := func(kind string, hostNetwork bool, podLabels map[string]string) *corev1.Pod {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "apps", Labels: podLabels},
+			Spec:       corev1.PodSpec{HostNetwork: hostNetwork},
+		}
+		if kind != "" {
+			pod.SetOwnerReferences([]metav1.OwnerReference{{Kind: kind, Name: "owner", Controller: &isController}})
+		}
+		return pod
+	}
+
+	DescribeTable("excludesPod",
+		func(spec PodTrackerSpec, obj client.Object, expected bool) {
+			pt := PodTracker{Spec: spec}
+			Expect(pt.excludesPod(obj)).To(Equal(expected))
+		},
+		Entry("doesn't exclude any Pod without exclusions",
+			PodTrackerSpec{}, ownedPod("DaemonSet", true, nil), false),
+		Entry("excludes the Pods selected by the podExclusionSelector",
+			PodTrackerSpec{PodExclusionSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}},
+			ownedPod("", false, map[string]string{"app": "web"}), true),
+		Entry("doesn't exclude the Pods which aren't selected by the podExclusionSelector",
+			PodTrackerSpec{PodExclusionSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}},
+			ownedPod("", false, map[string]string{"app": "db"}), false),
+		Entry("excludes the Pods controlled by an excluded kind of owner",
+			PodTrackerSpec{ExcludedOwners: []OwnerExclusion{{Kind: "DaemonSet"}}}, ownedPod("DaemonSet", false, nil), true),
+		Entry("doesn't exclude the Pods controlled by another kind of owner",
+			PodTrackerSpec{ExcludedOwners: []OwnerExclusion{{Kind: "DaemonSet"}}}, ownedPod("ReplicaSet", false, nil), false),
+		Entry("doesn't exclude the Pods without a controller",
+			PodTrackerSpec{ExcludedOwners: []OwnerExclusion{{Kind: "DaemonSet"}}}, ownedPod("", false, nil), false),
+		Entry("excludes the Pods using the host network with hostNetworkOnly",
+			PodTrackerSpec{ExcludedOwners: []OwnerExclusion{{Kind: "DaemonSet", HostNetworkOnly: true}}}, ownedPod("DaemonSet", true, nil), true),
+		Entry("doesn't exclude the Pods using the Pod network with hostNetworkOnly",
+			PodTrackerSpec{ExcludedOwners: []OwnerExclusion{{Kind: "DaemonSet", HostNetworkOnly: true}}}, ownedPod("DaemonSet", false, nil), false),
+		Entry("only applies the excluded owners to Pods",
+			PodTrackerSpec{ExcludedOwners: []OwnerExclusion{{Kind: "DaemonSet"}}},
+			&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "apps", OwnerReferences: []metav1.OwnerReference{{Kind: "DaemonSet", Name: "owner", Controller: &isController}}}}, false),
+	)
+
+	Describe("ProjectPodInfo", func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "api",
+				Namespace: "apps",
+				Annotations: map[string]string{
+					tracking.NetworkStatusAnnotation: `[{"name": "cbr0", "interface": "eth0", "ips": ["10.244.0.17"], "default": true}]`,
+				},
+			},
+		}
+
+		It("records the network interfaces parsed from the network-status annotation", func() {
+			pt := PodTracker{ObjectMeta: metav1.ObjectMeta{Name: "tracker"}, Spec: PodTrackerSpec{SchemaVersion: "v2"}}
+			projected, err := pt.ProjectPodInfo(tracking.New(&tracking.PodInfoConfig{Pod: pod, Node: &corev1.Node{}}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(projected.Interfaces).To(HaveLen(1))
+		})
+
+		It("doesn't record the network interfaces when the projection denies the network-status annotation", func() {
+			pt := PodTracker{ObjectMeta: metav1.ObjectMeta{Name: "tracker"}, Spec: PodTrackerSpec{
+				SchemaVersion: "v2",
+				Projection:    &tracking.ProjectionConfig{Annotations: &tracking.KeyProjection{Deny: []string{tracking.NetworkStatusAnnotation}}},
+			}}
+			pt.CompilePatterns()
+
+			projected, err := pt.ProjectPodInfo(tracking.New(&tracking.PodInfoConfig{Pod: pod, Node: &corev1.Node{}}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(projected.Annotations).NotTo(HaveKey(tracking.NetworkStatusAnnotation))
+			Expect(projected.Interfaces).To(BeNil())
+		})
+	})
+})
@@ -1,12 +1,23 @@
 package v1
 
 import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
 	"github.com/gccloudone-aurora/podtracker/internal/writer"
+	"github.com/gobwas/glob"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -15,10 +26,24 @@ import (
 // log is for logging in this package.
 var podtrackerlog = logf.Log.WithName("podtracker-resource")
 
-// SetupWebhookWithManager will setup the manager to manage the webhooks
-func (r *PodTracker) SetupWebhookWithManager(mgr ctrl.Manager) error {
+// PodTrackerValidator validates PodTracker CRs via a validating webhook, including the resources they reference
+// +kubebuilder:object:generate=false
+type PodTrackerValidator struct {
+	// Client is used to look up resources referenced by a PodTracker
+	Client client.Reader
+	// Namespace is the namespace the podtracker controller runs in, which is where referenced Secrets must exist
+	Namespace string
+	// ClusterName and ClusterID are the cluster identity the controller is configured with (if any), which v1 records don't record
+	ClusterName string
+	ClusterID   string
+}
+
+// SetupWebhookWithManager will setup the manager to manage the webhooks.
+// validator validates PodTrackers, including their references to Secrets in the controller namespace
+func (r *PodTracker) SetupWebhookWithManager(mgr ctrl.Manager, validator *PodTrackerValidator) error {
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
+		WithValidator(validator).
 		Complete()
 }
 
@@ -30,42 +55,75 @@ var _ webhook.Defaulter = &PodTracker{}
 func (r *PodTracker) Default() {
 	podtrackerlog.Info("default", "name", r.Name)
 
-	// set the default backend writer to 'stdout' and enable it
-	r.Spec.BackendWriterConfig = writer.BackendWriterConfig{
-		Stdout: &writer.StdoutConfig{
-			Enabled: true,
-		},
+	// set the default backend writer to 'stdout' and enable it if no other backend writer was configured
+	if r.Spec.BackendWriterConfig.Stdout == nil && len(r.Spec.BackendWriterConfig.Plugins) == 0 {
+		r.Spec.BackendWriterConfig = writer.BackendWriterConfig{
+			Stdout: &writer.StdoutConfig{
+				Enabled: true,
+			},
+		}
 	}
 }
 
 //+kubebuilder:webhook:path=/validate-networking-aurora-gc-ca-v1-podtracker,mutating=false,failurePolicy=fail,sideEffects=None,groups=networking.aurora.gc.ca,resources=podtrackers,verbs=create;update,versions=v1,name=vpodtracker.kb.io,admissionReviewVersions=v1
 
-var _ webhook.Validator = &PodTracker{}
+var _ webhook.CustomValidator = &PodTrackerValidator{}
 
-// ValidateCreate implements webhook.Validator to validate PodTracker CR creation via a validating webhook
-func (r *PodTracker) ValidateCreate() (admission.Warnings, error) {
+// ValidateCreate implements webhook.CustomValidator to validate PodTracker CR creation via a validating webhook
+func (v *PodTrackerValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	r, err := asPodTracker(obj)
+	if err != nil {
+		return nil, err
+	}
 	podtrackerlog.Info("validate create", "name", r.Name)
-	return nil, r.validate()
+	return v.warnings(r), v.validate(ctx, r)
 }
 
-// ValidateUpdate implements webhook.Validator to validate PodTracker CR creation via a validating webhook
-func (r *PodTracker) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+// ValidateUpdate implements webhook.CustomValidator to validate PodTracker CR updates via a validating webhook
+func (v *PodTrackerValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	r, err := asPodTracker(newObj)
+	if err != nil {
+		return nil, err
+	}
 	podtrackerlog.Info("validate update", "name", r.Name)
-	return nil, r.validate()
+	return v.warnings(r), v.validate(ctx, r)
 }
 
-// ValidateDelete implements webhook.Validator so a webhook will be registered for the type. We do not need to validate anything upon deletion for this type, so we do nothing here
-func (r *PodTracker) ValidateDelete() (admission.Warnings, error) {
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type. We do not need to validate anything upon deletion for this type, so we do nothing here
+func (v *PodTrackerValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	r, err := asPodTracker(obj)
+	if err != nil {
+		return nil, err
+	}
 	podtrackerlog.Info("validate delete", "name", r.Name)
 	return nil, nil
 }
 
-func (r PodTracker) validate() error {
-	var errs field.ErrorList
-	if err := r.validateSpec(); err != nil {
-		errs = append(errs, err)
+func asPodTracker(obj runtime.Object) (*PodTracker, error) {
+	r, ok := obj.(*PodTracker)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a PodTracker but got a %T", obj))
 	}
+	return r, nil
+}
+
+// warnings returns the warnings reported when a PodTracker is created or updated, including the settings of the controller which it ignores
+func (v *PodTrackerValidator) warnings(r *PodTracker) admission.Warnings {
+	warnings := r.warnings()
+	if r.schemaVersion() == tracking.SchemaVersionV1 && (v.ClusterName != "" || v.ClusterID != "") {
+		warnings = append(warnings, "spec.schemaVersion: v1 records don't record the cluster, the cluster name and ID the controller is configured with are not recorded by this PodTracker")
+	}
+	return warnings
+}
+
+// validate validates the PodTracker spec and ensures the Secrets it references exist
+func (v *PodTrackerValidator) validate(ctx context.Context, r *PodTracker) error {
+	errs := r.validateFields()
+	errs = append(errs, v.validateSecretReferences(ctx, r)...)
+	return r.invalid(errs)
+}
 
+func (r PodTracker) invalid(errs field.ErrorList) error {
 	if len(errs) == 0 {
 		return nil
 	}
@@ -73,9 +131,301 @@ func (r PodTracker) validate() error {
 	return apierrors.NewInvalid(schema.GroupKind{Group: "networking.aurora.gc.ca", Kind: "PodTracker"}, r.Name, errs)
 }
 
+// validateFields validates the PodTracker spec without looking up any referenced resources
+func (r PodTracker) validateFields() field.ErrorList {
+	var errs field.ErrorList
+	if err := r.validateSpec(); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, r.validateSelectors()...)
+	errs = append(errs, r.validateExclusions()...)
+	errs = append(errs, r.validateBackendWriterConfig()...)
+	errs = append(errs, r.validateProjection()...)
+	errs = append(errs, r.validateEnrichment()...)
+	errs = append(errs, r.validateEvents()...)
+	errs = append(errs, r.validateResources()...)
+	errs = append(errs, r.validateSchemaVersion()...)
+	return errs
+}
+
+// warnings returns the warnings reported when a PodTracker is created or updated
+func (r PodTracker) warnings() admission.Warnings {
+	var warnings admission.Warnings
+	if r.Spec.SchemaVersion.IsDeprecated() {
+		warnings = append(warnings, fmt.Sprintf("spec.schemaVersion: %s records are deprecated and will no longer be producible in a future release, use %s", r.Spec.SchemaVersion, tracking.CurrentSchemaVersion))
+	}
+	warnings = append(warnings, r.exclusionWarnings()...)
+	return warnings
+}
+
 func (r PodTracker) validateSpec() *field.Error {
-	if len(r.Spec.NSToWatch) == 0 {
-		return field.Invalid(field.NewPath("spec").Child("nsToWatch"), r.Spec.NSToWatch, "Must specify at least one namespace that this PodTracker applies to")
+	if len(r.Spec.NSToWatch) == 0 && r.Spec.NamespaceSelector == nil {
+		return field.Invalid(field.NewPath("spec").Child("nsToWatch"), r.Spec.NSToWatch, "Must specify at least one namespace or a namespaceSelector that this PodTracker applies to")
 	}
 	return nil
 }
+
+func (r PodTracker) validateSelectors() field.ErrorList {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+	if _, err := metav1.LabelSelectorAsSelector(r.Spec.NamespaceSelector); err != nil {
+		errs = append(errs, field.Invalid(specPath.Child("namespaceSelector"), r.Spec.NamespaceSelector, err.Error()))
+	}
+	if _, err := metav1.LabelSelectorAsSelector(r.Spec.PodSelector); err != nil {
+		errs = append(errs, field.Invalid(specPath.Child("podSelector"), r.Spec.PodSelector, err.Error()))
+	}
+	if _, err := metav1.LabelSelectorAsSelector(r.Spec.PodExclusionSelector); err != nil {
+		errs = append(errs, field.Invalid(specPath.Child("podExclusionSelector"), r.Spec.PodExclusionSelector, err.Error()))
+	}
+	return errs
+}
+
+func (r PodTracker) validateExclusions() field.ErrorList {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+	for i, pattern := range r.Spec.NSToIgnore {
+		if _, err := glob.Compile(pattern); err != nil {
+			errs = append(errs, field.Invalid(specPath.Child("nsToIgnore").Index(i), pattern, err.Error()))
+		}
+	}
+	for i, exclusion := range r.Spec.ExcludedOwners {
+		if exclusion.Kind == "" {
+			errs = append(errs, field.Required(specPath.Child("excludedOwners").Index(i).Child("kind"), "the kind of the owner must be set"))
+		}
+	}
+	return errs
+}
+
+// isLiteralPattern returns true if the glob pattern has no special characters, i.e. it only matches the namespace of the same name
+func isLiteralPattern(pattern string) bool {
+	return !strings.ContainsAny(pattern, `*?[]{}\`)
+}
+
+// globMatches returns true if the glob pattern matches the provided name. Invalid patterns (reported by validateExclusions) match nothing
+func globMatches(pattern, name string) bool {
+	g, err := glob.Compile(pattern)
+	return err == nil && g.Match(name)
+}
+
+// exclusionWarnings returns a warning for each exclusion which leaves the PodTracker without any namespace or Pod to track
+func (r PodTracker) exclusionWarnings() []string {
+	var warnings []string
+
+	// only the nsToWatch patterns which are certainly excluded are counted, as whether a glob excludes every namespace matching another
+	// glob can't be decided in general: a pattern is excluded by an nsToIgnore pattern of "*" or by the same pattern, and a literal
+	// namespace name is excluded if it matches an nsToIgnore pattern (e.g. nsToWatch "tenant-*" and nsToIgnore "tenant-*" or "*")
+	watched := r.Spec.NSToWatch
+	if len(watched) == 0 {
+		watched = []string{"*"}
+	}
+	ignored := 0
+	for _, pattern := range watched {
+		for _, ignore := range r.Spec.NSToIgnore {
+			if ignore == "*" || ignore == pattern || (isLiteralPattern(pattern) && globMatches(ignore, pattern)) {
+				ignored++
+				break
+			}
+		}
+	}
+	if ignored == len(watched) {
+		warnings = append(warnings, "spec.nsToIgnore: every namespace selected by spec.nsToWatch is ignored, this PodTracker tracks nothing")
+	}
+
+	if selector := r.Spec.PodExclusionSelector; selector != nil {
+		if s, err := metav1.LabelSelectorAsSelector(selector); err == nil && s.Empty() {
+			warnings = append(warnings, "spec.podExclusionSelector: an empty selector excludes every Pod, this PodTracker tracks no Pods")
+		} else if reflect.DeepEqual(selector, r.Spec.PodSelector) {
+			warnings = append(warnings, "spec.podExclusionSelector: every Pod selected by spec.podSelector is excluded, this PodTracker tracks no Pods")
+		}
+	}
+
+	return warnings
+}
+
+func (r PodTracker) validateBackendWriterConfig() field.ErrorList {
+	var errs field.ErrorList
+
+	pluginsPath := field.NewPath("spec").Child("backendWriterConfig").Child("plugins")
+	names := map[string]bool{}
+	for i, p := range r.Spec.BackendWriterConfig.Plugins {
+		if p.Name == "" {
+			errs = append(errs, field.Required(pluginsPath.Index(i).Child("name"), "Must specify a name for the writer plugin"))
+		} else if names[p.Name] {
+			errs = append(errs, field.Duplicate(pluginsPath.Index(i).Child("name"), p.Name))
+		}
+		names[p.Name] = true
+
+		if p.Address == "" {
+			errs = append(errs, field.Required(pluginsPath.Index(i).Child("address"), "Must specify the address the writer plugin is served on"))
+		}
+		if p.TimeoutSeconds != nil && *p.TimeoutSeconds <= 0 {
+			errs = append(errs, field.Invalid(pluginsPath.Index(i).Child("timeoutSeconds"), *p.TimeoutSeconds, "Must be greater than zero"))
+		}
+		if p.Token != nil && p.TLS == nil {
+			errs = append(errs, field.Invalid(pluginsPath.Index(i).Child("token"), p.Token.Name, "A bearer token can only be sent to a writer plugin over TLS"))
+		}
+		if p.TLS != nil && (p.TLS.Cert == nil) != (p.TLS.Key == nil) {
+			errs = append(errs, field.Invalid(pluginsPath.Index(i).Child("tls"), "", "A client certificate and key must be configured together"))
+		}
+	}
+
+	return errs
+}
+
+// validateSecretReferences ensures that every Secret key referenced by the writer configuration exists in the controller namespace
+func (v *PodTrackerValidator) validateSecretReferences(ctx context.Context, r *PodTracker) field.ErrorList {
+	var errs field.ErrorList
+	if v.Client == nil {
+		return errs
+	}
+
+	refPath := field.NewPath("spec")
+	for _, ref := range r.SecretReferences() {
+		secret := &corev1.Secret{}
+		if err := v.Client.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: v.Namespace}, secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				errs = append(errs, field.NotFound(refPath, fmt.Sprintf("secret %s/%s", v.Namespace, ref.Name)))
+				continue
+			}
+			errs = append(errs, field.InternalError(refPath, err))
+			continue
+		}
+
+		if _, ok := secret.Data[ref.Key]; !ok {
+			errs = append(errs, field.NotFound(refPath, fmt.Sprintf("key %q in secret %s/%s", ref.Key, v.Namespace, ref.Name)))
+		}
+	}
+
+	return errs
+}
+
+func (r PodTracker) validateProjection() field.ErrorList {
+	var errs field.ErrorList
+	if r.Spec.Projection == nil {
+		return errs
+	}
+
+	projectionPath := field.NewPath("spec").Child("projection")
+	if err := r.Spec.Projection.Validate(); err != nil {
+		errs = append(errs, field.Invalid(projectionPath, r.Spec.Projection, err.Error()))
+	}
+	if r.Spec.Projection.MaxValueBytes != nil && *r.Spec.Projection.MaxValueBytes <= 0 {
+		errs = append(errs, field.Invalid(projectionPath.Child("maxValueBytes"), *r.Spec.Projection.MaxValueBytes, "Must be greater than zero"))
+	}
+
+	return errs
+}
+
+func (r PodTracker) validateEnrichment() field.ErrorList {
+	var errs field.ErrorList
+	if r.Spec.Enrichment == nil {
+		return errs
+	}
+
+	enrichmentPath := field.NewPath("spec").Child("enrichment")
+	if !r.Spec.Enrichment.Containers {
+		if r.Spec.Enrichment.Images {
+			errs = append(errs, field.Forbidden(enrichmentPath.Child("images"), "Images are only recorded along with containers"))
+		}
+		if r.Spec.Enrichment.Ports {
+			errs = append(errs, field.Forbidden(enrichmentPath.Child("ports"), "Ports are only recorded along with containers"))
+		}
+	}
+
+	if r.Spec.Enrichment.Node == nil {
+		return errs
+	}
+
+	labelsPath := enrichmentPath.Child("node").Child("labels")
+	for i, pattern := range r.Spec.Enrichment.Node.Labels {
+		if _, err := glob.Compile(pattern); err != nil {
+			errs = append(errs, field.Invalid(labelsPath.Index(i), pattern, err.Error()))
+		}
+	}
+
+	return errs
+}
+
+func (r PodTracker) validateEvents() field.ErrorList {
+	var errs field.ErrorList
+
+	eventsPath := field.NewPath("spec").Child("events")
+	for i, event := range r.Spec.Events {
+		if !event.IsOptional() {
+			errs = append(errs, field.NotSupported(eventsPath.Index(i), event, tracking.OptionalPodEvents))
+		}
+		if event == tracking.PodServicesChangedEvent && (r.Spec.Enrichment == nil || !r.Spec.Enrichment.Services) {
+			errs = append(errs, field.Invalid(eventsPath.Index(i), event, "ServicesChanged events require spec.enrichment.services to be enabled"))
+		}
+	}
+
+	return errs
+}
+
+func (r PodTracker) validateResources() field.ErrorList {
+	var errs field.ErrorList
+
+	resourcesPath := field.NewPath("spec").Child("resources")
+	kinds := map[string]bool{}
+	for i, rule := range r.Spec.Resources {
+		rulePath := resourcesPath.Index(i)
+		if rule.Version == "" {
+			errs = append(errs, field.Required(rulePath.Child("version"), "Must specify the API version of the resource"))
+		}
+		if rule.Kind == "" {
+			errs = append(errs, field.Required(rulePath.Child("kind"), "Must specify the kind of the resource"))
+		}
+		if len(rule.IPPaths) == 0 {
+			errs = append(errs, field.Required(rulePath.Child("ipPaths"), "Must specify at least one JSONPath expression of the IPs of the resource"))
+		}
+		if err := rule.Validate(); err != nil {
+			errs = append(errs, field.Invalid(rulePath, rule, err.Error()))
+		}
+
+		gvk := rule.GroupVersionKind().String()
+		if kinds[gvk] {
+			errs = append(errs, field.Duplicate(rulePath, gvk))
+		}
+		kinds[gvk] = true
+	}
+
+	return errs
+}
+
+func (r PodTracker) validateSchemaVersion() field.ErrorList {
+	var errs field.ErrorList
+	if r.Spec.SchemaVersion != tracking.SchemaVersionV1 {
+		return errs
+	}
+
+	specPath := field.NewPath("spec")
+	if len(r.Spec.Events) > 0 {
+		errs = append(errs, field.Forbidden(specPath.Child("events"), "Only Create and Delete events are recorded in v1 records"))
+	}
+	if r.Spec.TimestampFormat != "" && r.Spec.TimestampFormat != tracking.LegacyTimestampFormat {
+		errs = append(errs, field.Invalid(specPath.Child("timestampFormat"), r.Spec.TimestampFormat, "v1 records always use the Legacy timestamp format"))
+	}
+	if r.Spec.TrackServices {
+		errs = append(errs, field.Forbidden(specPath.Child("trackServices"), "Services are not recorded in v1 records"))
+	}
+	if r.Spec.TrackNodes {
+		errs = append(errs, field.Forbidden(specPath.Child("trackNodes"), "Nodes are not recorded in v1 records"))
+	}
+	if len(r.Spec.Resources) > 0 {
+		errs = append(errs, field.Forbidden(specPath.Child("resources"), "Resources are not recorded in v1 records"))
+	}
+	if r.Spec.InventoryIntervalMinutes > 0 {
+		errs = append(errs, field.Forbidden(specPath.Child("inventoryIntervalMinutes"), "Inventories are not recorded in v1 records"))
+	}
+	if r.Spec.Integrity != nil && r.Spec.Integrity.Enabled {
+		errs = append(errs, field.Forbidden(specPath.Child("integrity"), "v1 records don't record the controller or the chain, so their hash chains can't be verified"))
+	}
+	if r.Spec.Projection != nil {
+		errs = append(errs, field.Forbidden(specPath.Child("projection"), "v1 records always record every label and annotation of the Pod as is"))
+	}
+	if r.Spec.Enrichment != nil {
+		errs = append(errs, field.Forbidden(specPath.Child("enrichment"), "Pod details are not recorded in v1 records"))
+	}
+
+	return errs
+}
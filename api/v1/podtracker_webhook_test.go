@@ -0,0 +1,185 @@
+package v1
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+	"github.com/gccloudone-aurora/podtracker/internal/writer"
+)
+
+var _ = Describe("PodTracker webhook", func() {
+	const (
+		everyNamespaceIgnored = "spec.nsToIgnore: every namespace selected by spec.nsToWatch is ignored, this PodTracker tracks nothing"
+		everyPodExcluded      = "spec.podExclusionSelector: an empty selector excludes every Pod, this PodTracker tracks no Pods"
+		everySelectedExcluded = "spec.podExclusionSelector: every Pod selected by spec.podSelector is excluded, this PodTracker tracks no Pods"
+	)
+
+	web := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+
+	DescribeTable("exclusionWarnings",
+		func(spec PodTrackerSpec, expected []string) {
+			pt := PodTracker{Spec: spec}
+			Expect(pt.exclusionWarnings()).To(Equal(expected))
+		},
+		Entry("doesn't warn without exclusions",
+			PodTrackerSpec{NSToWatch: []string{"apps"}}, nil),
+		Entry("warns when nsToIgnore ignores every namespace",
+			PodTrackerSpec{NSToWatch: []string{"apps", "tenant-*"}, NSToIgnore: []string{"*"}}, []string{everyNamespaceIgnored}),
+		Entry("warns when nsToIgnore repeats every nsToWatch pattern",
+			PodTrackerSpec{NSToWatch: []string{"tenant-*"}, NSToIgnore: []string{"tenant-*"}}, []string{everyNamespaceIgnored}),
+		Entry("warns when every literal namespace of nsToWatch matches an nsToIgnore pattern",
+			PodTrackerSpec{NSToWatch: []string{"tenant-a", "tenant-b"}, NSToIgnore: []string{"tenant-?"}}, []string{everyNamespaceIgnored}),
+		Entry("doesn't warn when some nsToWatch patterns aren't ignored",
+			PodTrackerSpec{NSToWatch: []string{"tenant-a", "apps"}, NSToIgnore: []string{"tenant-*"}}, nil),
+		Entry("doesn't warn when a glob of nsToWatch may select namespaces which aren't ignored",
+			PodTrackerSpec{NSToWatch: []string{"tenant-*"}, NSToIgnore: []string{"tenant-a*"}}, nil),
+		Entry("warns when nsToIgnore ignores every namespace selected by a namespaceSelector",
+			PodTrackerSpec{NamespaceSelector: web, NSToIgnore: []string{"*"}}, []string{everyNamespaceIgnored}),
+		Entry("doesn't warn when nsToIgnore ignores some of the namespaces selected by a namespaceSelector",
+			PodTrackerSpec{NamespaceSelector: web, NSToIgnore: []string{"kube-*"}}, nil),
+		Entry("doesn't warn about an invalid nsToIgnore pattern, which is rejected",
+			PodTrackerSpec{NSToWatch: []string{"apps"}, NSToIgnore: []string{"[apps"}}, nil),
+		Entry("warns when the podExclusionSelector is empty",
+			PodTrackerSpec{NSToWatch: []string{"apps"}, PodExclusionSelector: &metav1.LabelSelector{}}, []string{everyPodExcluded}),
+		Entry("warns when the podExclusionSelector is the podSelector",
+			PodTrackerSpec{NSToWatch: []string{"apps"}, PodSelector: web, PodExclusionSelector: web.DeepCopy()}, []string{everySelectedExcluded}),
+		Entry("doesn't warn when the podExclusionSelector differs from the podSelector",
+			PodTrackerSpec{NSToWatch: []string{"apps"}, PodSelector: web, PodExclusionSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}}}, nil),
+		Entry("warns about both namespaces and Pods",
+			PodTrackerSpec{NSToWatch: []string{"apps"}, NSToIgnore: []string{"apps"}, PodExclusionSelector: &metav1.LabelSelector{}},
+			[]string{everyNamespaceIgnored, everyPodExcluded}),
+	)
+	DescribeTable("validateSchemaVersion",
+		func(spec PodTrackerSpec, forbidden []string) {
+			spec.SchemaVersion = tracking.SchemaVersionV1
+			pt := PodTracker{Spec: spec}
+			fields := []string{}
+			for _, err := range pt.validateSchemaVersion() {
+				fields = append(fields, err.Field)
+			}
+			Expect(fields).To(Equal(forbidden))
+		},
+		Entry("accepts the settings of v1 records",
+			PodTrackerSpec{NSToWatch: []string{"apps"}}, []string{}),
+		Entry("rejects projection",
+			PodTrackerSpec{Projection: &tracking.ProjectionConfig{Labels: &tracking.KeyProjection{Allow: []string{"app"}}}}, []string{"spec.projection"}),
+		Entry("rejects enrichment",
+			PodTrackerSpec{Enrichment: &tracking.EnrichmentConfig{Containers: true}}, []string{"spec.enrichment"}),
+		Entry("rejects integrity",
+			PodTrackerSpec{Integrity: &writer.IntegrityConfig{Enabled: true}}, []string{"spec.integrity"}),
+		Entry("accepts disabled integrity",
+			PodTrackerSpec{Integrity: &writer.IntegrityConfig{}}, []string{}),
+		Entry("rejects every unsupported setting",
+			PodTrackerSpec{
+				Projection: &tracking.ProjectionConfig{},
+				Enrichment: &tracking.EnrichmentConfig{},
+				Integrity:  &writer.IntegrityConfig{Enabled: true},
+			}, []string{"spec.integrity", "spec.projection", "spec.enrichment"}),
+	)
+
+	It("accepts projection, enrichment and integrity with v2", func() {
+		pt := PodTracker{Spec: PodTrackerSpec{
+			SchemaVersion: tracking.SchemaVersionV2,
+			Projection:    &tracking.ProjectionConfig{},
+			Enrichment:    &tracking.EnrichmentConfig{},
+			Integrity:     &writer.IntegrityConfig{Enabled: true},
+		}}
+		Expect(pt.validateSchemaVersion()).To(BeEmpty())
+	})
+
+	Describe("PodTrackerValidator", func() {
+		var (
+			ctx       context.Context
+			validator *PodTrackerValidator
+		)
+
+		// referencing returns a PodTracker whose HMAC key is the provided key of the provided Secret
+		referencing := func(name, key string) *PodTracker {
+			return &PodTracker{
+				ObjectMeta: metav1.ObjectMeta{Name: "podtracker"},
+				Spec: PodTrackerSpec{
+					NSToWatch: []string{"apps"},
+					Integrity: &writer.IntegrityConfig{Enabled: true, HMACKey: &writer.SecretKeySelector{Name: name, Key: key}},
+				},
+			}
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+			validator = &PodTrackerValidator{
+				Client: fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "integrity", Namespace: "podtracker-system"},
+					Data:       map[string][]byte{"hmac.key": []byte("hmac-key")},
+				}).Build(),
+				Namespace: "podtracker-system",
+			}
+		})
+
+		It("accepts references to existing Secret keys", func() {
+			_, err := validator.ValidateCreate(ctx, referencing("integrity", "hmac.key"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("rejects references to a missing Secret", func() {
+			_, err := validator.ValidateCreate(ctx, referencing("missing", "hmac.key"))
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err).To(MatchError(ContainSubstring("secret podtracker-system/missing")))
+		})
+
+		It("rejects references to a missing key of a Secret", func() {
+			_, err := validator.ValidateUpdate(ctx, referencing("integrity", "hmac.key"), referencing("integrity", "missing"))
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err).To(MatchError(ContainSubstring(`key \"missing\" in secret podtracker-system/integrity`)))
+		})
+
+		It("only looks up Secrets in the controller namespace", func() {
+			validator.Namespace = "other"
+			_, err := validator.ValidateCreate(ctx, referencing("integrity", "hmac.key"))
+			Expect(err).To(MatchError(ContainSubstring("secret other/integrity")))
+		})
+
+		It("rejects projection and enrichment with v1", func() {
+			_, err := validator.ValidateCreate(ctx, &PodTracker{
+				ObjectMeta: metav1.ObjectMeta{Name: "podtracker"},
+				Spec: PodTrackerSpec{
+					NSToWatch:     []string{"apps"},
+					SchemaVersion: tracking.SchemaVersionV1,
+					Projection:    &tracking.ProjectionConfig{Annotations: &tracking.KeyProjection{Deny: []string{"kubectl.kubernetes.io/*"}}},
+					Enrichment:    &tracking.EnrichmentConfig{ServiceAccount: true},
+				},
+			})
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err).To(MatchError(ContainSubstring("spec.projection: Forbidden")))
+			Expect(err).To(MatchError(ContainSubstring("spec.enrichment: Forbidden")))
+		})
+
+		DescribeTable("warns when the cluster identity isn't recorded",
+			func(schemaVersion tracking.SchemaVersion, clusterName, clusterID string, warned bool) {
+				validator.ClusterName, validator.ClusterID = clusterName, clusterID
+				warnings, err := validator.ValidateCreate(ctx, &PodTracker{
+					ObjectMeta: metav1.ObjectMeta{Name: "podtracker"},
+					Spec:       PodTrackerSpec{NSToWatch: []string{"apps"}, SchemaVersion: schemaVersion},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				if warned {
+					Expect(warnings).To(ContainElement(ContainSubstring("the cluster name and ID the controller is configured with are not recorded")))
+				} else {
+					Expect(warnings).NotTo(ContainElement(ContainSubstring("the cluster name and ID")))
+				}
+			},
+			Entry("with v1 and a cluster name", tracking.SchemaVersionV1, "prod", "", true),
+			Entry("with v1 and a cluster ID", tracking.SchemaVersionV1, "", "7c1b", true),
+			Entry("not with v1 and no cluster identity", tracking.SchemaVersionV1, "", "", false),
+			Entry("not with v2", tracking.SchemaVersionV2, "prod", "7c1b", false),
+			Entry("not with the default schema version", tracking.SchemaVersion(""), "prod", "7c1b", false),
+		)
+	})
+})
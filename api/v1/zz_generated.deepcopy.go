@@ -5,9 +5,27 @@
 package v1
 
 import (
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+	"github.com/gccloudone-aurora/podtracker/internal/writer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OwnerExclusion) DeepCopyInto(out *OwnerExclusion) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OwnerExclusion.
+func (in *OwnerExclusion) DeepCopy() *OwnerExclusion {
+	if in == nil {
+		return nil
+	}
+	out := new(OwnerExclusion)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodTracker) DeepCopyInto(out *PodTracker) {
 	*out = *in
@@ -75,7 +93,59 @@ func (in *PodTrackerSpec) DeepCopyInto(out *PodTrackerSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PodSelector != nil {
+		in, out := &in.PodSelector, &out.PodSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NSToIgnore != nil {
+		in, out := &in.NSToIgnore, &out.NSToIgnore
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PodExclusionSelector != nil {
+		in, out := &in.PodExclusionSelector, &out.PodExclusionSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExcludedOwners != nil {
+		in, out := &in.ExcludedOwners, &out.ExcludedOwners
+		*out = make([]OwnerExclusion, len(*in))
+		copy(*out, *in)
+	}
 	in.BackendWriterConfig.DeepCopyInto(&out.BackendWriterConfig)
+	if in.Projection != nil {
+		in, out := &in.Projection, &out.Projection
+		*out = new(tracking.ProjectionConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Integrity != nil {
+		in, out := &in.Integrity, &out.Integrity
+		*out = new(writer.IntegrityConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Enrichment != nil {
+		in, out := &in.Enrichment, &out.Enrichment
+		*out = new(tracking.EnrichmentConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Events != nil {
+		in, out := &in.Events, &out.Events
+		*out = make([]tracking.PodEvent, len(*in))
+		copy(*out, *in)
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = make([]tracking.ResourceRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodTrackerSpec.
@@ -1,17 +1,23 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
 	"time"
 
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -22,6 +28,10 @@ import (
 	"github.com/gccloudone-aurora/podtracker/internal/cleaner"
 	"github.com/gccloudone-aurora/podtracker/internal/config"
 	"github.com/gccloudone-aurora/podtracker/internal/controller"
+	"github.com/gccloudone-aurora/podtracker/internal/inventory"
+	"github.com/gccloudone-aurora/podtracker/internal/owner"
+	"github.com/gccloudone-aurora/podtracker/internal/podstore"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -51,6 +61,20 @@ var (
 	disablePodCleaner bool
 	// podCleanerIntervalSeconds specifies the period (in seconds) for which the pod cleaner will run
 	podCleanerIntervalSeconds uint
+	// controllerNamespace is the namespace that the controller runs in. Secrets referenced by PodTracker writer configurations must exist in this namespace
+	controllerNamespace string
+	// ownerCacheTTLSeconds specifies how long (in seconds) the resolved top-level owners of Pods are cached for
+	ownerCacheTTLSeconds uint
+	// defaultTrackingMode specifies how the deletion of Pods is observed for PodTrackers that don't set a tracking mode
+	defaultTrackingMode string
+	// clusterName is a human readable name for the cluster which is recorded on every record
+	clusterName string
+	// clusterID uniquely identifies the cluster on every record. The UID of the kube-system namespace is used if not set
+	clusterID string
+	// inventoryCheckIntervalSeconds specifies the period (in seconds) in which the inventory recorder checks whether the inventory of a PodTracker is due
+	inventoryCheckIntervalSeconds uint
+	// snapshotOnStartup records a snapshot of the Pods tracked by every PodTracker when the controller starts, rather than only when a PodTracker is created
+	snapshotOnStartup bool
 )
 
 var (
@@ -107,6 +131,48 @@ func init() {
 		600,
 		"The period (in seconds) in which the Pod Cleaner should check for stuck pods",
 	)
+	flag.StringVar(
+		&controllerNamespace,
+		"controller-namespace",
+		lookupEnvOrDefault("POD_NAMESPACE", "podtracker-system"),
+		"The namespace the controller runs in. Secrets referenced by PodTracker writer configurations are read from this namespace",
+	)
+	flag.UintVar(
+		&ownerCacheTTLSeconds,
+		"owner-cache-ttl",
+		600,
+		"The period (in seconds) for which the resolved top-level owners of Pods are cached",
+	)
+	flag.StringVar(
+		&defaultTrackingMode,
+		"default-tracking-mode",
+		lookupEnvOrDefault("DEFAULT_TRACKING_MODE", string(networkingv1.FinalizerTrackingMode)),
+		"How the deletion of Pods is observed for PodTrackers that don't set a tracking mode. One of 'Finalizer' (adds a finalizer to tracked Pods) or 'Watch' (observes deletions from watch events, without modifying Pods)",
+	)
+	flag.StringVar(
+		&clusterName,
+		"cluster-name",
+		lookupEnvOrDefault("CLUSTER_NAME", ""),
+		"A human readable name for the cluster, which is recorded on every record",
+	)
+	flag.StringVar(
+		&clusterID,
+		"cluster-id",
+		lookupEnvOrDefault("CLUSTER_ID", ""),
+		"Uniquely identifies the cluster on every record. If not set, the UID of the kube-system namespace is used",
+	)
+	flag.UintVar(
+		&inventoryCheckIntervalSeconds,
+		"inventory-check-interval",
+		30,
+		"The period (in seconds) in which the inventory recorder checks whether the inventory of a PodTracker is due",
+	)
+	flag.BoolVar(
+		&snapshotOnStartup,
+		"snapshot-on-startup",
+		lookupEnvOrDefault("SNAPSHOT_ON_STARTUP", "false") != "false",
+		"Records a Snapshot event for every Pod tracked by each PodTracker when the controller starts. Snapshots are always recorded when a PodTracker is created",
+	)
 
 	opts := zap.Options{
 		Development: developmentLogging,
@@ -123,12 +189,29 @@ func init() {
 }
 
 func main() {
+	if mode := networkingv1.TrackingMode(defaultTrackingMode); mode != networkingv1.FinalizerTrackingMode && mode != networkingv1.WatchTrackingMode {
+		setupLog.Error(fmt.Errorf("unsupported tracking mode %q", defaultTrackingMode), "invalid --default-tracking-mode")
+		os.Exit(1)
+	}
+	if inventoryCheckIntervalSeconds == 0 {
+		setupLog.Error(errors.New("the period must be at least 1 second"), "invalid --inventory-check-interval")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		Metrics:                metricsserver.Options{BindAddress: metricsAddr},
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       leaderElectionID,
+		Cache: cache.Options{
+			ByObject: map[client.Object]cache.ByObject{
+				// only Secrets in the controller namespace can be referenced, so there is no need to cache Secrets cluster-wide
+				&corev1.Secret{}: {
+					Namespaces: map[string]cache.Config{controllerNamespace: {}},
+				},
+			},
+		},
 		WebhookServer: webhook.NewServer(webhook.Options{
 			CertDir: "/tmp/podtracker-webhook-server/serving-certs",
 		}),
@@ -140,7 +223,12 @@ func main() {
 
 	// configure validating/defaulting webhooks
 	if !disableWebhooks {
-		if err = (&networkingv1.PodTracker{}).SetupWebhookWithManager(mgr); err != nil {
+		if err = (&networkingv1.PodTracker{}).SetupWebhookWithManager(mgr, &networkingv1.PodTrackerValidator{
+			Client:      mgr.GetAPIReader(),
+			Namespace:   controllerNamespace,
+			ClusterName: clusterName,
+			ClusterID:   clusterID,
+		}); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "PodTracker")
 			os.Exit(1)
 		}
@@ -149,21 +237,80 @@ func main() {
 	// a local in-memory cache for relevant PodTracker data
 	var cachedPodTrackers config.CachedPodTrackerConfig
 
+	// resolves Secrets referenced by BackendWriter configurations
+	secretResolver := &config.SecretResolver{
+		Reader:    mgr.GetClient(),
+		Namespace: controllerNamespace,
+	}
+
+	// identifies the cluster and this controller process on every record
+	instance, err := newInstance(mgr.GetAPIReader())
+	if err != nil {
+		setupLog.Error(err, "unable to identify the cluster, set --cluster-id")
+		os.Exit(1)
+	}
+	setupLog.Info("identified cluster", "clusterName", instance.ClusterName, "clusterID", instance.ClusterID, "controller", instance.Controller)
+
+	// resolves the top-level owners of Pods. Owners are read directly from the API server (and cached by the resolver)
+	// so that an informer isn't started for every kind of owner
+	ownerResolver := owner.NewResolver(mgr.GetAPIReader(), time.Duration(ownerCacheTTLSeconds)*time.Second)
+
+	podReconciler := &controller.PodReconciler{
+		Client:              mgr.GetClient(),
+		Scheme:              mgr.GetScheme(),
+		PodTrackerConfig:    &cachedPodTrackers,
+		Owners:              ownerResolver,
+		DefaultTrackingMode: networkingv1.TrackingMode(defaultTrackingMode),
+		Instance:            instance,
+		Store: &podstore.Store{
+			Client:        mgr.GetClient(),
+			Reader:        mgr.GetAPIReader(),
+			Namespace:     controllerNamespace,
+			FlushInterval: 10 * time.Second,
+		},
+	}
+	if err = podReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Podtracker-Pod-Controller")
+		os.Exit(1)
+	}
+
 	if err = (&controller.PodTrackerReconciler{
+		Client:            mgr.GetClient(),
+		Scheme:            mgr.GetScheme(),
+		PodTrackerConfig:  &cachedPodTrackers,
+		Namespace:         controllerNamespace,
+		Secrets:           secretResolver,
+		Snapshots:         podReconciler,
+		SnapshotOnStartup: snapshotOnStartup,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PodTracker")
+		os.Exit(1)
+	}
+
+	if err = (&controller.ServiceReconciler{
 		Client:           mgr.GetClient(),
-		Scheme:           mgr.GetScheme(),
 		PodTrackerConfig: &cachedPodTrackers,
+		Instance:         instance,
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "PodTracker")
+		setupLog.Error(err, "unable to create controller", "controller", "Podtracker-Service-Controller")
 		os.Exit(1)
 	}
 
-	if err = (&controller.PodReconciler{
+	if err = (&controller.NodeReconciler{
 		Client:           mgr.GetClient(),
-		Scheme:           mgr.GetScheme(),
 		PodTrackerConfig: &cachedPodTrackers,
+		Instance:         instance,
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Podtracker-Pod-Controller")
+		setupLog.Error(err, "unable to create controller", "controller", "Podtracker-Node-Controller")
+		os.Exit(1)
+	}
+
+	if err = (&controller.ResourceReconciler{
+		Client:           mgr.GetClient(),
+		PodTrackerConfig: &cachedPodTrackers,
+		Instance:         instance,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Podtracker-Resource-Controller")
 		os.Exit(1)
 	}
 	//+kubebuilder:scaffold:builder
@@ -191,14 +338,55 @@ func main() {
 			Client:           mgr.GetClient(),
 			CleanInterval:    time.Duration(podCleanerIntervalSeconds) * time.Second,
 			PodTrackerConfig: &cachedPodTrackers,
+			Owners:           ownerResolver,
+			Instance:         instance,
 		}); err != nil {
 			setupLog.Error(err, "unable to add pod cleaner runnable to manager")
 		}
 	}
 
+	if err := mgr.Add(&inventory.Recorder{
+		Client:           mgr.GetClient(),
+		CheckInterval:    time.Duration(inventoryCheckIntervalSeconds) * time.Second,
+		PodTrackerConfig: &cachedPodTrackers,
+		Instance:         instance,
+	}); err != nil {
+		setupLog.Error(err, "unable to add inventory recorder runnable to manager")
+	}
+
 	setupLog.Info("starting manager")
 	if err := mgr.Start(managerContext); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
+
+	// flush and close all the writers now that no more events will be processed
+	if errs := cachedPodTrackers.Close(); len(errs) > 0 {
+		setupLog.Error(errors.Join(errs...), "unable to cleanly close writers")
+	}
+}
+
+// newInstance identifies the cluster and this controller process. The controller is identified by the name of its Pod (POD_NAME),
+// which is also its hostname unless it is overridden
+func newInstance(reader client.Reader) (*tracking.Instance, error) {
+	instance := &tracking.Instance{
+		ClusterName: clusterName,
+		ClusterID:   clusterID,
+		Controller:  os.Getenv("POD_NAME"),
+	}
+	if instance.Controller == "" {
+		instance.Controller, _ = os.Hostname()
+	}
+
+	if instance.ClusterID == "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		namespace := &corev1.Namespace{}
+		if err := reader.Get(ctx, types.NamespacedName{Name: metav1.NamespaceSystem}, namespace); err != nil {
+			return nil, fmt.Errorf("unable to get the %s namespace: %w", metav1.NamespaceSystem, err)
+		}
+		instance.ClusterID = string(namespace.GetUID())
+	}
+	return instance, nil
 }
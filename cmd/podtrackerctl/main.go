@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// podtrackerctl contains offline tooling for consumers of PodTracker records
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "verify":
+		err = verify(os.Args[2:])
+	case "schema":
+		err = schema(os.Args[2:])
+	case "help", "-h", "--help":
+		usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `Usage: podtrackerctl <command> [flags]
+
+Commands:
+  verify    verify the hash chain of an exported NDJSON file of PodTracker records
+  schema    print the JSON Schema of a version of the PodTracker records
+`)
+}
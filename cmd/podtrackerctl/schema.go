@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+// schema prints the JSON Schema of a version of the PodTracker records, or writes the JSON Schema of every version to a directory.
+// Service, Node and Resource records only exist in the current schema version
+func schema(args []string) error {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	version := fs.String("version", string(tracking.CurrentSchemaVersion), "The schema version to print the JSON Schema of")
+	record := fs.String("record", "pod", "The record type to print the JSON Schema of: pod, service, node, resource or inventory")
+	outputDir := fs.String("output-dir", "", "A directory to write the JSON Schema of every schema version to, as podinfo-<version>.schema.json and <record>-<version>.schema.json")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: podtrackerctl schema [--record <pod|service|node|resource|inventory>] [--version <version> | --output-dir <dir>]")
+		fmt.Fprintf(fs.Output(), "Schema versions: %v\n", tracking.SchemaVersions)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *outputDir == "" {
+		var data []byte
+		var err error
+		if *record == "pod" {
+			data, err = marshalSchema(tracking.SchemaVersion(*version))
+		} else if recordSchema, ok := recordSchemas[*record]; !ok {
+			return fmt.Errorf("unknown record type %q", *record)
+		} else if tracking.SchemaVersion(*version) != tracking.CurrentSchemaVersion {
+			return fmt.Errorf("%s records only exist in schema version %s", *record, tracking.CurrentSchemaVersion)
+		} else {
+			data, err = marshalJSON(recordSchema())
+		}
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	for _, v := range tracking.SchemaVersions {
+		data, err := marshalSchema(v)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(*outputDir, fmt.Sprintf("podinfo-%s.schema.json", v)), data, 0o644); err != nil {
+			return err
+		}
+	}
+
+	for name, recordSchema := range recordSchemas {
+		data, err := marshalJSON(recordSchema())
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(*outputDir, fmt.Sprintf("%s-%s.schema.json", name, tracking.CurrentSchemaVersion)), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordSchemas are the JSON Schemas of the records other than PodInfo, by record type. They only exist in the current schema version
+var recordSchemas = map[string]func() map[string]interface{}{
+	"service":   tracking.ServiceRecordJSONSchema,
+	"node":      tracking.NodeRecordJSONSchema,
+	"resource":  tracking.ResourceRecordJSONSchema,
+	"inventory": tracking.InventoryRecordJSONSchema,
+}
+
+// marshalSchema returns the indented JSON Schema of the provided schema version
+func marshalSchema(version tracking.SchemaVersion) ([]byte, error) {
+	s, err := tracking.JSONSchema(version)
+	if err != nil {
+		return nil, err
+	}
+	return marshalJSON(s)
+}
+
+// marshalJSON returns the indented JSON encoding of the provided value, followed by a newline
+func marshalJSON(v interface{}) ([]byte, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+// verify walks an NDJSON file of records written by a single BackendWriter and reports any gaps or modifications of the hash chains.
+// The records of every PodTracker form their own chain, so the chains are verified separately by the trackedBy of each record
+func verify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	hmacKeyFile := fs.String("hmac-key-file", "", "A file containing the HMAC key that records were signed with. If not set, signatures are not verified")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: podtrackerctl verify [--hmac-key-file <file>] [<records.ndjson>]")
+		fmt.Fprintln(fs.Output(), "Records are read from stdin if no file is provided. Records must be in the order they were written.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var key []byte
+	if *hmacKeyFile != "" {
+		var err error
+		if key, err = readHMACKey(*hmacKeyFile); err != nil {
+			return err
+		}
+	}
+
+	var in io.Reader = os.Stdin
+	if fs.NArg() > 0 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	verifiers := map[string]*tracking.Verifier{}
+	records, problems := 0, 0
+	scanner := bufio.NewScanner(in)
+	// records with large annotations can exceed the default token size
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		records++
+
+		record, trackedBy, err := parseRecord(raw)
+		if err != nil {
+			fmt.Printf("line %d: unable to parse record: %v\n", line, err)
+			problems++
+			continue
+		}
+
+		verifier, ok := verifiers[trackedBy]
+		if !ok {
+			verifier = &tracking.Verifier{Key: key}
+			verifiers[trackedBy] = verifier
+		}
+		for _, problem := range verifier.Verify(record, raw) {
+			fmt.Printf("line %d (%s, sequence %d): %s\n", line, trackedBy, record.Link().Sequence, problem)
+			problems++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	restarts, newChains := 0, 0
+	for _, verifier := range verifiers {
+		restarts += verifier.Restarts
+		newChains += verifier.NewChains
+	}
+	fmt.Printf("verified %d records of %d PodTrackers: %d problems, %d chain restarts, %d new chains\n", records, len(verifiers), problems, restarts, newChains)
+	if problems > 0 {
+		return errors.New("verification failed")
+	}
+	return nil
+}
+
+// readHMACKey reads the HMAC key from the provided file. Surrounding whitespace (e.g. the trailing newline left by most editors and `echo`)
+// is trimmed, as it is when the controller signs records with the key
+func readHMACKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read HMAC key: %w", err)
+	}
+	return bytes.TrimSpace(key), nil
+}
+
+// parseRecord parses a PodInfo, ServiceRecord, NodeRecord, ResourceRecord or InventoryRecord, depending on the recordType of the provided record,
+// and returns it along with the name of the PodTracker that it was tracked by
+func parseRecord(data []byte) (tracking.Record, string, error) {
+	header := struct {
+		RecordType string `json:"recordType"`
+		TrackedBy  string `json:"trackedBy"`
+	}{}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, "", err
+	}
+
+	var record tracking.Record
+	switch header.RecordType {
+	case tracking.ServiceRecordType:
+		record = &tracking.ServiceRecord{}
+	case tracking.NodeRecordType:
+		record = &tracking.NodeRecord{}
+	case tracking.ResourceRecordType:
+		record = &tracking.ResourceRecord{}
+	case tracking.InventoryRecordType:
+		record = &tracking.InventoryRecord{}
+	default:
+		record = &tracking.PodInfo{}
+	}
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, "", err
+	}
+	return record, header.TrackedBy, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("readHMACKey", func() {
+	// writeKey writes the provided key to a file and returns its path
+	writeKey := func(key string) string {
+		path := filepath.Join(GinkgoT().TempDir(), "hmac.key")
+		Expect(os.WriteFile(path, []byte(key), 0o600)).To(Succeed())
+		return path
+	}
+
+	DescribeTable("trims the whitespace surrounding the key",
+		func(contents string) {
+			key, err := readHMACKey(writeKey(contents))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key).To(Equal([]byte("hmac-key")))
+		},
+		Entry("without whitespace", "hmac-key"),
+		Entry("with a trailing newline", "hmac-key\n"),
+		Entry("with a trailing CRLF", "hmac-key\r\n"),
+		Entry("with surrounding spaces", "  hmac-key \t\n"),
+	)
+
+	It("fails if the key can't be read", func() {
+		_, err := readHMACKey(filepath.Join(GinkgoT().TempDir(), "missing.key"))
+		Expect(err).To(MatchError(ContainSubstring("unable to read HMAC key")))
+	})
+})
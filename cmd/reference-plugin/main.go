@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/gccloudone-aurora/podtracker/internal/plugin"
+	"github.com/gccloudone-aurora/podtracker/internal/plugin/reference"
+)
+
+// The reference plugin is a minimal external writer plugin which prints every record it receives to stdout.
+// It is intended to run as a sidecar next to the podtracker controller.
+func main() {
+	var listenAddr string
+	flag.StringVar(
+		&listenAddr,
+		"listen",
+		"unix:///var/run/podtracker/plugin.sock",
+		"The address to serve the plugin on. Either unix://<path> or <host>:<port>",
+	)
+	flag.Parse()
+
+	network, address := "tcp", listenAddr
+	if strings.HasPrefix(listenAddr, "unix://") {
+		network, address = "unix", strings.TrimPrefix(listenAddr, "unix://")
+		// remove a stale socket left behind by a previous run
+		_ = os.Remove(address)
+	}
+
+	lis, err := net.Listen(network, address)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to listen on %s: %v\n", listenAddr, err)
+		os.Exit(1)
+	}
+
+	if err := plugin.NewServer(&reference.Plugin{Out: os.Stdout}).Serve(lis); err != nil {
+		fmt.Fprintf(os.Stderr, "plugin server stopped: %v\n", err)
+		os.Exit(1)
+	}
+}
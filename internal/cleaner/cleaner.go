@@ -32,8 +32,10 @@ import (
 	"errors"
 	"time"
 
+	v1 "github.com/gccloudone-aurora/podtracker/api/v1"
 	"github.com/gccloudone-aurora/podtracker/internal/config"
 	"github.com/gccloudone-aurora/podtracker/internal/finalizer"
+	"github.com/gccloudone-aurora/podtracker/internal/owner"
 	"github.com/gccloudone-aurora/podtracker/internal/tracking"
 	"github.com/gccloudone-aurora/podtracker/internal/writer"
 	corev1 "k8s.io/api/core/v1"
@@ -52,6 +54,10 @@ type PodCleaner struct {
 	CleanInterval time.Duration
 
 	PodTrackerConfig *config.CachedPodTrackerConfig
+	// Owners resolves the top-level controller of Pods. Owners are not recorded if nil
+	Owners *owner.Resolver
+	// Instance identifies the cluster and controller process on every record. Records are not stamped if nil
+	Instance *tracking.Instance
 }
 
 // a blank assignment of PodCleaner as a manager.Runnable to ensure that the interface is implemented
@@ -69,7 +75,6 @@ func (c *PodCleaner) Start(parentContext context.Context) error {
 	go func(ctx context.Context) {
 		for {
 			<-ticker.C
-			c.PodTrackerConfig.Lock()
 
 			pods := &corev1.PodList{}
 			if err := c.Client.List(ctx, pods, client.MatchingFields{
@@ -95,28 +100,54 @@ func (c *PodCleaner) Start(parentContext context.Context) error {
 						}
 					}
 
+					var podOwner *tracking.Owner
+					if c.Owners != nil {
+						var err error
+						if podOwner, err = c.Owners.Resolve(ctx, &pod); err != nil {
+							cl.Error(err, "unable to resolve the owner of Pod", "pod", pod.GetName(), "namespace", pod.GetNamespace())
+						}
+					}
+
 					info := tracking.New(&tracking.PodInfoConfig{
 						Pod:   &pod,
 						Node:  &node,
 						Event: tracking.PodDeleteEvent,
+						Owner: podOwner,
 					})
 
-					for _, pt := range c.PodTrackerConfig.Items {
-						if pt.TracksPod(&pod) {
-							info.TrackedBy = pt.GetName()
-							errs := writer.WriteToAll(pt.GetWriters(), info)
-
-							if len(errs) > 0 {
-								cl.Error(
-									errors.Join(errs...),
-									"unable to write final pod delete. will try again later",
-									"pod", pod.GetName(),
-									"namespace", pod.GetNamespace(),
-								)
-								continue
-							}
+					namespaceLabels, err := c.PodTrackerConfig.NamespaceLabels(ctx, c.Client, pod.GetNamespace())
+					if err != nil {
+						cl.Error(err, "unable to get the Namespace of Pod. will try again on the next cleanup", "pod", pod.GetName(), "namespace", pod.GetNamespace())
+						continue
+					}
+
+					// acquire the PodTrackers tracking the Pod, whose writers are written to without holding the lock
+					registrations, release := c.PodTrackerConfig.Acquire(func(pt *v1.PodTracker) bool { return pt.TracksPod(&pod, namespaceLabels) })
+					for _, registration := range registrations {
+						pt := registration.PodTracker
+						if !registration.Ready {
+							cl.Info("no writers are available for PodTracker. will try again later", "podtracker", pt.GetName())
+							continue
+						}
+						projected, err := pt.ProjectPodInfo(info)
+						if err != nil {
+							cl.Error(err, "unable to project final pod delete. will try again later", "pod", pod.GetName(), "namespace", pod.GetNamespace())
+							continue
+						}
+						c.Instance.Stamp(projected)
+						errs := writer.WriteToAll(registration.Writers, projected)
+
+						if len(errs) > 0 {
+							cl.Error(
+								errors.Join(errs...),
+								"unable to write final pod delete. will try again later",
+								"pod", pod.GetName(),
+								"namespace", pod.GetNamespace(),
+							)
+							continue
 						}
 					}
+					release()
 
 					controllerutil.RemoveFinalizer(&pod, finalizer.POD_FINALIZER_NAME)
 					if err := c.Client.Update(ctx, &pod); err != nil {
@@ -125,7 +156,6 @@ func (c *PodCleaner) Start(parentContext context.Context) error {
 					}
 				}
 			}
-			c.PodTrackerConfig.Unlock()
 		}
 	}(parentContext)
 
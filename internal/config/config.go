@@ -30,10 +30,156 @@ package config
 import (
 	"sync"
 
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
 	v1 "github.com/gccloudone-aurora/podtracker/api/v1"
+	"github.com/gccloudone-aurora/podtracker/internal/writer"
 )
 
+// CachedPodTrackerConfig is the in-memory store of registered PodTrackers along with the BackendWriters that were built for them.
+// Writers are built once when a PodTracker is reconciled and reused for every event. They are acquired under the lock (see Acquire)
+// but written to without it, so that a slow backend doesn't hold up the other controllers
 type CachedPodTrackerConfig struct {
 	sync.Mutex
 	v1.PodTrackerList
+
+	writers map[string]*registeredWriters
+	// subscribers receive the PodTrackers which are registered or updated (see Subscribe)
+	subscribers []chan event.GenericEvent
+	// namespaces are the labels of the namespaces which have been looked up (see NamespaceLabels)
+	namespaces namespaceLabelStore
+}
+
+// registeredWriters are the writers registered for a PodTracker
+type registeredWriters struct {
+	writers []writer.BackendWriter
+	// inUse counts the holders of the writers which have acquired them, so that they are only closed once they are released
+	inUse sync.WaitGroup
+}
+
+// Registration is a copy of a registered PodTracker along with the writers registered for it
+type Registration struct {
+	PodTracker v1.PodTracker
+	// Writers are the writers registered for the PodTracker. They are only usable if Ready is true
+	Writers []writer.BackendWriter
+	// Ready is false if no writers have been registered for the PodTracker (e.g. because they could not be built)
+	Ready bool
+}
+
+// RetiredWriters are the writers which have been replaced or unregistered, and which may still be used by writes in progress
+type RetiredWriters struct {
+	registered *registeredWriters
+}
+
+// Close waits until the retired writers have been released by every holder which acquired them, and closes them
+func (r RetiredWriters) Close() []error {
+	if r.registered == nil {
+		return nil
+	}
+	r.registered.inUse.Wait()
+	return writer.CloseAll(r.registered.writers)
+}
+
+// Subscribe returns a channel which receives every PodTracker that is registered or updated from now on, so that the objects which
+// existed before can be reconciled against it. It is meant to be the source of a source.Channel, and acquires the lock itself
+func (c *CachedPodTrackerConfig) Subscribe() <-chan event.GenericEvent {
+	c.Lock()
+	defer c.Unlock()
+
+	subscriber := make(chan event.GenericEvent)
+	c.subscribers = append(c.subscribers, subscriber)
+	return subscriber
+}
+
+// NotifyRegistered sends a copy of the provided PodTracker to every subscriber (see Subscribe) without blocking the caller,
+// which must hold the lock
+func (c *CachedPodTrackerConfig) NotifyRegistered(pt *v1.PodTracker) {
+	for _, subscriber := range c.subscribers {
+		go func(subscriber chan<- event.GenericEvent, obj *v1.PodTracker) {
+			subscriber <- event.GenericEvent{Object: obj}
+		}(subscriber, pt.DeepCopy())
+	}
+}
+
+// Get returns the registered PodTracker with the provided name. The caller must hold the lock
+func (c *CachedPodTrackerConfig) Get(name string) (*v1.PodTracker, bool) {
+	for i := range c.Items {
+		if c.Items[i].GetName() == name {
+			return &c.Items[i], true
+		}
+	}
+	return nil, false
+}
+
+// WritersFor returns the writers registered for the named PodTracker. The caller must hold the lock.
+// The second return value is false if no writers have been registered for the PodTracker
+func (c *CachedPodTrackerConfig) WritersFor(name string) ([]writer.BackendWriter, bool) {
+	registered, ok := c.writers[name]
+	if !ok {
+		return nil, false
+	}
+	return registered.writers, true
+}
+
+// Acquire returns a copy of every registered PodTracker matched by the provided function along with its writers. It acquires the lock itself,
+// and the returned writers are kept open until release is called, so the caller can write to them without holding the lock
+func (c *CachedPodTrackerConfig) Acquire(matches func(*v1.PodTracker) bool) (registrations []Registration, release func()) {
+	c.Lock()
+	defer c.Unlock()
+
+	acquired := []*registeredWriters{}
+	for i := range c.Items {
+		pt := &c.Items[i]
+		if !matches(pt) {
+			continue
+		}
+
+		registration := Registration{PodTracker: *pt.DeepCopy()}
+		if registered, ok := c.writers[pt.GetName()]; ok {
+			registered.inUse.Add(1)
+			acquired = append(acquired, registered)
+			registration.Writers = registered.writers
+			registration.Ready = true
+		}
+		registrations = append(registrations, registration)
+	}
+
+	return registrations, func() {
+		for _, registered := range acquired {
+			registered.inUse.Done()
+		}
+	}
+}
+
+// SetWriters registers the writers for the named PodTracker and returns the writers that they replace (if any). The caller must hold the lock.
+// The replaced writers are no longer acquired once this returns, and it is the caller's responsibility to close them
+func (c *CachedPodTrackerConfig) SetWriters(name string, writers []writer.BackendWriter) RetiredWriters {
+	if c.writers == nil {
+		c.writers = map[string]*registeredWriters{}
+	}
+
+	previous := c.writers[name]
+	c.writers[name] = &registeredWriters{writers: writers}
+	return RetiredWriters{registered: previous}
+}
+
+// RemoveWriters unregisters the writers for the named PodTracker and returns them so that they can be closed by the caller,
+// who must hold the lock
+func (c *CachedPodTrackerConfig) RemoveWriters(name string) RetiredWriters {
+	previous := c.writers[name]
+	delete(c.writers, name)
+	return RetiredWriters{registered: previous}
+}
+
+// Close closes the writers of every registered PodTracker once they have been released. It is meant to be called once the controller
+// has stopped processing events
+func (c *CachedPodTrackerConfig) Close() []error {
+	c.Lock()
+	defer c.Unlock()
+
+	errs := []error{}
+	for name := range c.writers {
+		errs = append(errs, c.RemoveWriters(name).Close()...)
+	}
+	return errs
 }
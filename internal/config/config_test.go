@@ -0,0 +1,169 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package config
+
+import (
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/gccloudone-aurora/podtracker/api/v1"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+	"github.com/gccloudone-aurora/podtracker/internal/writer"
+)
+
+// closeCountingWriter is a BackendWriter which counts the number of times it is closed
+type closeCountingWriter struct {
+	closed atomic.Int32
+}
+
+func (w *closeCountingWriter) Write(tracking.Record) error { return nil }
+
+func (w *closeCountingWriter) Close() error {
+	w.closed.Add(1)
+	return nil
+}
+
+var _ = Describe("CachedPodTrackerConfig", func() {
+	var (
+		cfg      *CachedPodTrackerConfig
+		previous *closeCountingWriter
+	)
+
+	all := func(*v1.PodTracker) bool { return true }
+
+	BeforeEach(func() {
+		cfg = &CachedPodTrackerConfig{}
+		cfg.Items = []v1.PodTracker{
+			{ObjectMeta: metav1.ObjectMeta{Name: "ready"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "unavailable"}},
+		}
+		previous = &closeCountingWriter{}
+		cfg.SetWriters("ready", []writer.BackendWriter{previous})
+	})
+
+	It("acquires copies of the matching PodTrackers along with their writers", func() {
+		registrations, release := cfg.Acquire(func(pt *v1.PodTracker) bool { return pt.GetName() == "ready" })
+		defer release()
+
+		Expect(registrations).To(HaveLen(1))
+		Expect(registrations[0].Ready).To(BeTrue())
+		Expect(registrations[0].Writers).To(ConsistOf(previous))
+
+		registrations[0].PodTracker.Spec.NSToWatch = []string{"changed"}
+		Expect(cfg.Items[0].Spec.NSToWatch).To(BeEmpty())
+	})
+
+	It("acquires the PodTrackers whose writers could not be built as not ready", func() {
+		registrations, release := cfg.Acquire(func(pt *v1.PodTracker) bool { return pt.GetName() == "unavailable" })
+		defer release()
+
+		Expect(registrations).To(HaveLen(1))
+		Expect(registrations[0].Ready).To(BeFalse())
+		Expect(registrations[0].Writers).To(BeEmpty())
+	})
+
+	It("does not hold the lock while the writers are acquired", func() {
+		_, release := cfg.Acquire(all)
+		defer release()
+
+		Expect(cfg.TryLock()).To(BeTrue())
+		cfg.Unlock()
+	})
+
+	It("closes replaced writers once the writes in progress have released them", func() {
+		_, release := cfg.Acquire(all)
+
+		cfg.Lock()
+		retired := cfg.SetWriters("ready", []writer.BackendWriter{&closeCountingWriter{}})
+		cfg.Unlock()
+
+		closed := make(chan []error)
+		go func() { closed <- retired.Close() }()
+		Consistently(closed, 100*time.Millisecond).ShouldNot(Receive())
+		Expect(previous.closed.Load()).To(BeZero())
+
+		release()
+		Eventually(closed).Should(Receive(BeEmpty()))
+		Expect(previous.closed.Load()).To(Equal(int32(1)))
+	})
+
+	It("does not acquire replaced writers", func() {
+		replacement := &closeCountingWriter{}
+		cfg.Lock()
+		retired := cfg.SetWriters("ready", []writer.BackendWriter{replacement})
+		cfg.Unlock()
+
+		registrations, release := cfg.Acquire(all)
+		Expect(registrations[0].Writers).To(ConsistOf(replacement))
+
+		// the replaced writers are not held by the acquired registrations
+		Expect(retired.Close()).To(BeEmpty())
+		release()
+		Expect(previous.closed.Load()).To(Equal(int32(1)))
+		Expect(replacement.closed.Load()).To(BeZero())
+	})
+
+	It("closes removed writers once they have been released", func() {
+		_, release := cfg.Acquire(all)
+
+		cfg.Lock()
+		retired := cfg.RemoveWriters("ready")
+		_, ok := cfg.WritersFor("ready")
+		cfg.Unlock()
+		Expect(ok).To(BeFalse())
+
+		closed := make(chan []error)
+		go func() { closed <- retired.Close() }()
+		Consistently(closed, 100*time.Millisecond).ShouldNot(Receive())
+
+		release()
+		Eventually(closed).Should(Receive(BeEmpty()))
+		Expect(previous.closed.Load()).To(Equal(int32(1)))
+	})
+
+	It("ignores writers which were not registered", func() {
+		cfg.Lock()
+		retired := cfg.RemoveWriters("unavailable")
+		cfg.Unlock()
+
+		Expect(retired.Close()).To(BeEmpty())
+	})
+
+	It("closes every registered writer", func() {
+		Expect(cfg.Close()).To(BeEmpty())
+		Expect(previous.closed.Load()).To(Equal(int32(1)))
+
+		registrations, release := cfg.Acquire(all)
+		defer release()
+		Expect(registrations[0].Ready).To(BeFalse())
+	})
+})
@@ -0,0 +1,114 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package config
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// deletedNamespaceRetention is how long the labels of a deleted namespace are remembered after its deletion is noticed,
+// which leaves time for the deletion of its objects to be recorded (and retried)
+const deletedNamespaceRetention = time.Hour
+
+// namespaceLabelStore remembers the labels of the namespaces which have been looked up, so that the namespaceSelectors of PodTrackers
+// can still be evaluated against a namespace once it has been deleted
+type namespaceLabelStore struct {
+	mu         sync.Mutex
+	namespaces map[string]*rememberedNamespace
+}
+
+// rememberedNamespace holds the last known labels of a namespace, and when it was first found to be deleted
+type rememberedNamespace struct {
+	labels  map[string]string
+	deleted time.Time
+}
+
+// NamespaceLabels returns the labels of the namespace with the provided name, against which the namespaceSelectors of PodTrackers are evaluated.
+// The labels of a deleted namespace are remembered for a while (see deletedNamespaceRetention), so that the objects of the namespace are released
+// by the PodTrackers which recorded them. nil is returned for cluster-scoped objects (i.e. an empty name) and for namespaces which don't exist anymore
+// and whose labels are unknown (e.g. namespaces deleted while the controller was down). It does not require the lock to be held
+func (c *CachedPodTrackerConfig) NamespaceLabels(ctx context.Context, reader client.Reader, name string) (map[string]string, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	namespace := &corev1.Namespace{}
+	if err := reader.Get(ctx, types.NamespacedName{Name: name}, namespace); err != nil {
+		if apierrors.IsNotFound(err) {
+			return c.namespaces.deleted(name), nil
+		}
+		return nil, err
+	}
+
+	labels := namespace.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	c.namespaces.remember(name, labels)
+	return labels, nil
+}
+
+// remember stores the current labels of the namespace with the provided name
+func (s *namespaceLabelStore) remember(name string, labels map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.namespaces == nil {
+		s.namespaces = map[string]*rememberedNamespace{}
+	}
+	s.namespaces[name] = &rememberedNamespace{labels: labels}
+}
+
+// deleted returns the remembered labels of the deleted namespace with the provided name, if they are known and haven't expired
+func (s *namespaceLabelStore) deleted(name string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for other, namespace := range s.namespaces {
+		if !namespace.deleted.IsZero() && now.Sub(namespace.deleted) > deletedNamespaceRetention {
+			delete(s.namespaces, other)
+		}
+	}
+
+	namespace, ok := s.namespaces[name]
+	if !ok {
+		return nil
+	}
+	if namespace.deleted.IsZero() {
+		namespace.deleted = now
+	}
+	return namespace.labels
+}
@@ -0,0 +1,149 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+var _ = Describe("CachedPodTrackerConfig namespace labels", func() {
+	var (
+		ctx       context.Context
+		c         client.Client
+		cfg       *CachedPodTrackerConfig
+		namespace *corev1.Namespace
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		namespace = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps", Labels: map[string]string{"env": "production"}}}
+		c = fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(namespace).Build()
+		cfg = &CachedPodTrackerConfig{}
+	})
+
+	It("returns the labels of an existing namespace", func() {
+		labels, err := cfg.NamespaceLabels(ctx, c, "apps")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(labels).To(Equal(map[string]string{"env": "production"}))
+	})
+
+	It("returns empty labels for an existing namespace without labels, which are known", func() {
+		Expect(c.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "unlabelled"}})).To(Succeed())
+
+		labels, err := cfg.NamespaceLabels(ctx, c, "unlabelled")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(labels).NotTo(BeNil())
+		Expect(labels).To(BeEmpty())
+	})
+
+	It("returns no labels for cluster-scoped objects", func() {
+		labels, err := cfg.NamespaceLabels(ctx, c, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(labels).To(BeNil())
+	})
+
+	It("returns no labels for a deleted namespace whose labels were never looked up", func() {
+		Expect(c.Delete(ctx, namespace)).To(Succeed())
+
+		labels, err := cfg.NamespaceLabels(ctx, c, "apps")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(labels).To(BeNil())
+	})
+
+	It("returns the last known labels of a deleted namespace", func() {
+		_, err := cfg.NamespaceLabels(ctx, c, "apps")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Delete(ctx, namespace)).To(Succeed())
+
+		labels, err := cfg.NamespaceLabels(ctx, c, "apps")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(labels).To(Equal(map[string]string{"env": "production"}))
+	})
+
+	It("remembers the labels of a deleted namespace for the retention window only", func() {
+		_, err := cfg.NamespaceLabels(ctx, c, "apps")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Delete(ctx, namespace)).To(Succeed())
+
+		// the retention window starts when the deletion is first noticed, and isn't extended by later lookups
+		_, err = cfg.NamespaceLabels(ctx, c, "apps")
+		Expect(err).NotTo(HaveOccurred())
+		noticed := cfg.namespaces.namespaces["apps"].deleted
+		Expect(noticed).NotTo(BeZero())
+		_, err = cfg.NamespaceLabels(ctx, c, "apps")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.namespaces.namespaces["apps"].deleted).To(Equal(noticed))
+
+		cfg.namespaces.namespaces["apps"].deleted = time.Now().Add(-deletedNamespaceRetention + time.Minute)
+		labels, err := cfg.NamespaceLabels(ctx, c, "apps")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(labels).To(Equal(map[string]string{"env": "production"}))
+
+		cfg.namespaces.namespaces["apps"].deleted = time.Now().Add(-deletedNamespaceRetention - time.Minute)
+		labels, err = cfg.NamespaceLabels(ctx, c, "apps")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(labels).To(BeNil())
+		Expect(cfg.namespaces.namespaces).NotTo(HaveKey("apps"))
+	})
+
+	It("forgets that a namespace was deleted when it is created again", func() {
+		_, err := cfg.NamespaceLabels(ctx, c, "apps")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Delete(ctx, namespace)).To(Succeed())
+		_, err = cfg.NamespaceLabels(ctx, c, "apps")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps", Labels: map[string]string{"env": "dev"}}})).To(Succeed())
+		labels, err := cfg.NamespaceLabels(ctx, c, "apps")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(labels).To(Equal(map[string]string{"env": "dev"}))
+		Expect(cfg.namespaces.namespaces["apps"].deleted).To(BeZero())
+	})
+
+	It("returns the errors other than NotFound", func() {
+		failing := interceptor.NewClient(c.(client.WithWatch), interceptor.Funcs{
+			Get: func(context.Context, client.WithWatch, client.ObjectKey, client.Object, ...client.GetOption) error {
+				return errors.New("unavailable")
+			},
+		})
+
+		_, err := cfg.NamespaceLabels(ctx, failing, "apps")
+		Expect(err).To(MatchError("unavailable"))
+	})
+})
@@ -0,0 +1,63 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/gccloudone-aurora/podtracker/internal/writer"
+)
+
+// SecretResolver resolves Secret references from writer configurations against Secrets in the namespace that the podtracker controller runs in
+type SecretResolver struct {
+	client.Reader
+	Namespace string
+}
+
+// A blank assignment to ensure that SecretResolver implements writer.SecretResolver
+var _ writer.SecretResolver = &SecretResolver{}
+
+// ResolveSecret returns the value of the key referenced by the provided SecretKeySelector
+func (s *SecretResolver) ResolveSecret(ctx context.Context, ref writer.SecretKeySelector) ([]byte, error) {
+	secret := &corev1.Secret{}
+	if err := s.Reader.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: s.Namespace}, secret); err != nil {
+		return nil, fmt.Errorf("unable to get secret %q in namespace %q: %w", ref.Name, s.Namespace, err)
+	}
+
+	value, ok := secret.Data[ref.Key]
+	if !ok {
+		return nil, fmt.Errorf("secret %q in namespace %q has no key %q", ref.Name, s.Namespace, ref.Key)
+	}
+
+	return value, nil
+}
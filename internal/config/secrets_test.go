@@ -0,0 +1,83 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package config
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/gccloudone-aurora/podtracker/internal/writer"
+)
+
+var _ = Describe("SecretResolver", func() {
+	var (
+		ctx      context.Context
+		resolver *SecretResolver
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		resolver = &SecretResolver{
+			Reader: fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "plugin", Namespace: "podtracker-system"},
+					Data:       map[string][]byte{"token": []byte("secret-token")},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "apps"},
+					Data:       map[string][]byte{"token": []byte("other-token")},
+				},
+			).Build(),
+			Namespace: "podtracker-system",
+		}
+	})
+
+	It("resolves the key of a Secret in the controller namespace", func() {
+		value, err := resolver.ResolveSecret(ctx, writer.SecretKeySelector{Name: "plugin", Key: "token"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(Equal([]byte("secret-token")))
+	})
+
+	It("fails if the Secret doesn't exist in the controller namespace", func() {
+		_, err := resolver.ResolveSecret(ctx, writer.SecretKeySelector{Name: "other", Key: "token"})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(err).To(MatchError(ContainSubstring(`secret "other" in namespace "podtracker-system"`)))
+	})
+
+	It("fails if the Secret doesn't have the key", func() {
+		_, err := resolver.ResolveSecret(ctx, writer.SecretKeySelector{Name: "plugin", Key: "missing"})
+		Expect(err).To(MatchError(`secret "plugin" in namespace "podtracker-system" has no key "missing"`))
+	})
+})
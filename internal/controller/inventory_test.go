@@ -0,0 +1,90 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	networkingv1 "github.com/gccloudone-aurora/podtracker/api/v1"
+	"github.com/gccloudone-aurora/podtracker/internal/config"
+	"github.com/gccloudone-aurora/podtracker/internal/inventory"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+var _ = Describe("Inventory Recorder", func() {
+	var (
+		ctx       context.Context
+		namespace string
+		plugin    *recordingPlugin
+		address   string
+	)
+
+	setup := func(mgr ctrl.Manager, podTrackers *config.CachedPodTrackerConfig, _ *PodTrackerReconciler) error {
+		return mgr.Add(&inventory.Recorder{
+			Client:           mgr.GetClient(),
+			CheckInterval:    time.Second,
+			PodTrackerConfig: podTrackers,
+		})
+	}
+
+	BeforeEach(func() {
+		requireTestEnv()
+		ctx = context.Background()
+		namespace = createNamespace(ctx)
+		plugin, address = servePlugin()
+	})
+
+	It("records an inventory of the Pods which exist when the controller starts", func() {
+		node := createNode(ctx, "192.168.0.40")
+		createRunningPod(ctx, namespace, "existing", node, "10.40.0.1")
+		pt := newPodTracker(address, func(spec *networkingv1.PodTrackerSpec) {
+			spec.NSToWatch = []string{namespace}
+			spec.InventoryIntervalMinutes = 1
+		})
+		createPodTracker(ctx, pt)
+		startManager(setup)
+
+		// the first inventory is recorded one interval after the PodTracker is registered
+		Eventually(func() []tracking.InventoryPod {
+			for _, record := range recordsOf[*tracking.InventoryRecord](plugin) {
+				if record.TrackedBy == pt.GetName() {
+					return record.Pods
+				}
+			}
+			return nil
+		}).WithTimeout(2 * time.Minute).WithPolling(time.Second).Should(ConsistOf(
+			HaveField("Name", "existing"),
+		))
+	})
+})
@@ -0,0 +1,326 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	v1 "github.com/gccloudone-aurora/podtracker/api/v1"
+	"github.com/gccloudone-aurora/podtracker/internal/config"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+	"github.com/gccloudone-aurora/podtracker/internal/writer"
+)
+
+// NodeReconciler records the addresses and Pod IP ranges of the Nodes of the cluster for the PodTrackers which track Nodes (see PodTracker.TracksNodes):
+// when Nodes join, when their addresses or Pod IP ranges change, and when they leave.
+// Nodes are recorded separately for every PodTracker, so that a PodTracker registered after a Node joined records it too.
+// NOTE: like the observed state of Pods, the recorded state of Nodes is kept in memory only, so Nodes are recorded with a join event again
+// after a controller restart, and Nodes deleted while the controller is down are not recorded
+type NodeReconciler struct {
+	client.Client
+	PodTrackerConfig *config.CachedPodTrackerConfig
+	// Instance identifies the cluster and controller process on every record. Records are not stamped if nil
+	Instance *tracking.Instance
+
+	// recorded is the state of the Nodes as of the last record written for them, for every PodTracker
+	recorded keyedStore[recordedKey, observedNodeState]
+	// deleted holds the recorded Nodes whose deletion has been observed from watch events until their deletion is recorded
+	deleted keyedStore[string, *corev1.Node]
+	// registered is closed once the existing PodTrackers have been registered after the controller starts
+	registered <-chan struct{}
+}
+
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+
+// Reconcile records the changes of the addresses and Pod IP ranges of a Node
+func (r *NodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	rl := log.FromContext(ctx)
+
+	// wait until the existing PodTrackers are registered, so that the Nodes listed when the controller starts are not missed
+	select {
+	case <-r.registered:
+	case <-ctx.Done():
+		return ctrl.Result{}, ctx.Err()
+	}
+
+	// record a Node leaving the cluster, if its deletion has been observed from a watch event
+	if deleted, ok := r.deleted.Pop(req.Name); ok {
+		if err := r.recordDeletedNode(deleted); err != nil {
+			// writing to one or more backends failed - hold the Node again and requeue with error
+			r.deleted.Set(req.Name, deleted)
+			return ctrl.Result{}, err
+		}
+	}
+
+	node := &corev1.Node{}
+	if err := r.Client.Get(ctx, req.NamespacedName, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			rl.V(2).Info(
+				"Request object not found for Node, could have been deleted after reconcile request.",
+				"name", req.Name,
+			)
+
+			// return and don't requeue
+			return ctrl.Result{}, nil
+		}
+
+		// error getting Node from Kubernetes API server - requeue the request
+		return ctrl.Result{}, err
+	}
+	if !node.GetDeletionTimestamp().IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.recordNode(node); err != nil {
+		// writing to one or more backends failed - return and requeue with error
+		return ctrl.Result{}, err
+	}
+
+	// reconciliation was successful - return and don't requeue
+	return ctrl.Result{}, nil
+}
+
+// recordNode records the changes of the Node for every PodTracker tracking Nodes. The Node is recorded with a join event
+// for the PodTrackers which haven't recorded it before, and with an event for each of its changes otherwise
+func (r *NodeReconciler) recordNode(node *corev1.Node) error {
+	current := newObservedNodeState(node)
+
+	// acquire the PodTrackers tracking Nodes, whose writers are written to without holding the lock
+	registrations, release := r.PodTrackerConfig.Acquire(func(pt *v1.PodTracker) bool { return pt.TracksNodes() })
+	defer release()
+
+	var errs []error
+	tracked := map[string]bool{}
+	for _, registration := range registrations {
+		tracked[registration.PodTracker.GetName()] = true
+		key := recordedKey{PodTracker: registration.PodTracker.GetName(), UID: node.GetUID()}
+		previous, recorded := r.recorded.Get(key)
+		if !recorded {
+			if err := r.writeNodeRecord(registration, &tracking.NodeRecordConfig{Node: node, Event: tracking.NodeJoinEvent}); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			r.recorded.Set(key, current)
+			continue
+		}
+
+		// each change is recorded (and remembered) separately, so that a change which has been recorded is not recorded again if recording the next one fails
+		if !reflect.DeepEqual(previous.Addresses, current.Addresses) {
+			if err := r.writeNodeRecord(registration, &tracking.NodeRecordConfig{
+				Node:              node,
+				Event:             tracking.NodeAddressesChangedEvent,
+				PreviousAddresses: previous.Addresses,
+			}); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			previous.Addresses = current.Addresses
+			r.recorded.Set(key, previous)
+		}
+		if !reflect.DeepEqual(previous.PodCIDRs, current.PodCIDRs) {
+			if err := r.writeNodeRecord(registration, &tracking.NodeRecordConfig{
+				Node:             node,
+				Event:            tracking.NodePodCIDRsChangedEvent,
+				PreviousPodCIDRs: previous.PodCIDRs,
+			}); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			r.recorded.Set(key, current)
+		}
+	}
+
+	// the PodTrackers which have recorded the Node but don't track Nodes anymore record it as leaving
+	untracked := r.recorded.Keys(func(key recordedKey) bool { return key.UID == node.GetUID() && !tracked[key.PodTracker] })
+	if err := r.releaseNode(node, untracked); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// recordDeletedNode records a deleted Node leaving the cluster for every PodTracker which has recorded the Node
+func (r *NodeReconciler) recordDeletedNode(node *corev1.Node) error {
+	return r.releaseNode(node, r.recorded.Keys(func(key recordedKey) bool { return key.UID == node.GetUID() }))
+}
+
+// releaseNode records the Node as leaving for the PodTrackers it was recorded for with the provided keys,
+// and forgets the keys once it has been recorded
+func (r *NodeReconciler) releaseNode(node *corev1.Node, keys []recordedKey) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	registrations, release := acquireRecorded(r.PodTrackerConfig, keys)
+	defer release()
+
+	var errs []error
+	for _, key := range keys {
+		if registration, ok := registrations[key.PodTracker]; ok {
+			if err := r.writeNodeRecord(registration, &tracking.NodeRecordConfig{Node: node, Event: tracking.NodeLeaveEvent}); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		// the Node leaving has been recorded, or the PodTracker has been removed
+		r.recorded.Forget(key)
+	}
+
+	return errors.Join(errs...)
+}
+
+// writeNodeRecord writes the described NodeRecord to the writers of the acquired PodTracker
+func (r *NodeReconciler) writeNodeRecord(registration config.Registration, cfg *tracking.NodeRecordConfig) error {
+	if !registration.Ready {
+		// the writers for this PodTracker could not be built - fail so that the event is retried once they are
+		return fmt.Errorf("no writers are available for PodTracker %q", registration.PodTracker.GetName())
+	}
+
+	record := registration.PodTracker.ProjectNodeRecord(tracking.NewNodeRecord(cfg))
+	r.Instance.Stamp(record)
+	return errors.Join(writer.WriteToAll(registration.Writers, record)...)
+}
+
+// enqueueRegisteredNodes enqueues every Node when a PodTracker tracking Nodes has been registered or updated, as the Nodes
+// which joined before are otherwise only recorded for the PodTracker once they change
+func (r *NodeReconciler) enqueueRegisteredNodes(ctx context.Context, obj client.Object) []reconcile.Request {
+	rl := log.FromContext(ctx)
+
+	pt, ok := obj.(*v1.PodTracker)
+	if !ok {
+		return []reconcile.Request{}
+	}
+	// the Nodes are enqueued for the PodTrackers which have recorded them too, so that they are recorded as leaving once Nodes aren't tracked anymore
+	recorded := len(r.recorded.Keys(func(key recordedKey) bool { return key.PodTracker == pt.GetName() })) > 0
+	if !pt.TracksNodes() && !recorded {
+		return []reconcile.Request{}
+	}
+
+	nodes := &corev1.NodeList{}
+	if err := r.Client.List(ctx, nodes); err != nil {
+		rl.Error(err, "unable to list the Nodes tracked by PodTracker", "podtracker", pt.GetName())
+		return []reconcile.Request{}
+	}
+
+	requests := make([]reconcile.Request, 0, len(nodes.Items))
+	for _, node := range nodes.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: node.GetName()}})
+	}
+	return requests
+}
+
+// enqueueDeletedNode holds the final state of the recorded Nodes which are deleted, so that they can be recorded as leaving once they are gone
+func (r *NodeReconciler) enqueueDeletedNode(ctx context.Context, de event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	node, ok := de.Object.(*corev1.Node)
+	if !ok {
+		return
+	}
+	if len(r.recorded.Keys(func(key recordedKey) bool { return key.UID == node.GetUID() })) == 0 {
+		return
+	}
+
+	r.deleted.Set(node.GetName(), node)
+	q.Add(reconcile.Request{NamespacedName: types.NamespacedName{Name: node.GetName()}})
+}
+
+// SetupWithManager sets up the controller with the Controller Manager.
+func (r *NodeReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	registered, err := podTrackersRegisteredChannel(mgr, r.PodTrackerConfig)
+	if err != nil {
+		return err
+	}
+	r.registered = registered
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("PodTracker-Node").
+		// NOTE: Nodes are enqueued whether or not they are tracked when the event is received, as the PodTrackers may not be registered yet.
+		// The reconciler only records Nodes for the PodTrackers which track them
+		Watches(
+			&corev1.Node{},
+			&handler.EnqueueRequestForObject{},
+			builder.WithPredicates(
+				predicate.Funcs{
+					CreateFunc: func(ce event.CreateEvent) bool { return true },
+					UpdateFunc: func(ue event.UpdateEvent) bool {
+						oldNode, ok := ue.ObjectOld.(*corev1.Node)
+						if !ok {
+							return false
+						}
+						newNode, ok := ue.ObjectNew.(*corev1.Node)
+						if !ok {
+							return false
+						}
+
+						// only enqueue Nodes whose addresses or Pod IP ranges have changed, as Node statuses are updated frequently
+						return !reflect.DeepEqual(newObservedNodeState(oldNode), newObservedNodeState(newNode))
+					},
+					DeleteFunc:  func(de event.DeleteEvent) bool { return false },
+					GenericFunc: func(ge event.GenericEvent) bool { return false },
+				},
+			),
+		).
+		Watches(
+			&corev1.Node{},
+			handler.Funcs{DeleteFunc: r.enqueueDeletedNode},
+		).
+		WatchesRawSource(
+			&source.Channel{Source: r.PodTrackerConfig.Subscribe()},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueRegisteredNodes),
+		).
+		Complete(r)
+}
+
+// observedNodeState is the state of a Node as of the last record written for it
+type observedNodeState struct {
+	Addresses []tracking.NodeAddress
+	PodCIDRs  []string
+}
+
+// newObservedNodeState returns the current state of the Node
+func newObservedNodeState(node *corev1.Node) observedNodeState {
+	return observedNodeState{
+		Addresses: tracking.NodeAddresses(node),
+		PodCIDRs:  tracking.NodePodCIDRs(node),
+	}
+}
@@ -0,0 +1,209 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	networkingv1 "github.com/gccloudone-aurora/podtracker/api/v1"
+	"github.com/gccloudone-aurora/podtracker/internal/config"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+var _ = Describe("NodeReconciler", func() {
+	var (
+		ctx     context.Context
+		node    string
+		plugin  *recordingPlugin
+		address string
+	)
+
+	setup := func(mgr ctrl.Manager, podTrackers *config.CachedPodTrackerConfig, _ *PodTrackerReconciler) error {
+		return (&NodeReconciler{Client: mgr.GetClient(), PodTrackerConfig: podTrackers}).SetupWithManager(mgr)
+	}
+
+	trackNodes := func(spec *networkingv1.PodTrackerSpec) {
+		spec.NSToWatch = []string{"default"}
+		spec.TrackNodes = true
+	}
+
+	// joined returns the number of times the Node has been recorded as joining for the named PodTracker
+	joined := func(podTracker string) func() int {
+		return func() int {
+			count := 0
+			for _, record := range recordsOf[*tracking.NodeRecord](plugin) {
+				if record.TrackedBy == podTracker && record.Name == node && record.Event == tracking.NodeJoinEvent {
+					count++
+				}
+			}
+			return count
+		}
+	}
+
+	BeforeEach(func() {
+		requireTestEnv()
+		ctx = context.Background()
+		plugin, address = servePlugin()
+		node = createNode(ctx, "192.168.0.10")
+	})
+
+	It("records the Nodes which exist when the controller starts", func() {
+		pt := newPodTracker(address, trackNodes)
+		createPodTracker(ctx, pt)
+		startManager(setup)
+
+		Eventually(joined(pt.GetName())).WithTimeout(30 * time.Second).Should(Equal(1))
+	})
+
+	It("records the existing Nodes for a PodTracker registered after they were recorded", func() {
+		first := newPodTracker(address, trackNodes)
+		createPodTracker(ctx, first)
+		startManager(setup)
+		Eventually(joined(first.GetName())).WithTimeout(30 * time.Second).Should(Equal(1))
+
+		second := newPodTracker(address, trackNodes)
+		createPodTracker(ctx, second)
+		Eventually(joined(second.GetName())).WithTimeout(30 * time.Second).Should(Equal(1))
+		Consistently(joined(first.GetName())).WithTimeout(2 * time.Second).Should(Equal(1))
+	})
+
+	It("records the address changes of a Node and the Node leaving", func() {
+		pt := newPodTracker(address, trackNodes)
+		createPodTracker(ctx, pt)
+		startManager(setup)
+		Eventually(joined(pt.GetName())).WithTimeout(30 * time.Second).Should(Equal(1))
+
+		current := &corev1.Node{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Name: node}, current)).To(Succeed())
+		current.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "192.168.0.11"}}
+		Expect(k8sClient.Status().Update(ctx, current)).To(Succeed())
+		Eventually(func() []tracking.NodeEvent {
+			recorded := []tracking.NodeEvent{}
+			for _, record := range recordsOf[*tracking.NodeRecord](plugin) {
+				if record.TrackedBy == pt.GetName() && record.Name == node {
+					recorded = append(recorded, record.Event)
+				}
+			}
+			return recorded
+		}).WithTimeout(30 * time.Second).Should(Equal([]tracking.NodeEvent{tracking.NodeJoinEvent, tracking.NodeAddressesChangedEvent}))
+
+		Expect(k8sClient.Delete(ctx, current)).To(Succeed())
+		Eventually(func() bool {
+			for _, record := range recordsOf[*tracking.NodeRecord](plugin) {
+				if record.TrackedBy == pt.GetName() && record.Name == node && record.Event == tracking.NodeLeaveEvent {
+					return true
+				}
+			}
+			return false
+		}).WithTimeout(30 * time.Second).Should(BeTrue())
+	})
+})
+
+var _ = Describe("NodeReconciler recording Nodes", func() {
+	var (
+		node        *corev1.Node
+		r           *NodeReconciler
+		podTrackers *config.CachedPodTrackerConfig
+		written     *recordingWriter
+	)
+
+	events := func() []tracking.NodeEvent {
+		recorded := []tracking.NodeEvent{}
+		for _, record := range recordsOf[*tracking.NodeRecord](written) {
+			recorded = append(recorded, record.Event)
+		}
+		return recorded
+	}
+
+	BeforeEach(func() {
+		node = &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1", UID: "node-uid"},
+			Spec:       corev1.NodeSpec{PodCIDR: "10.244.1.0/24", PodCIDRs: []string{"10.244.1.0/24"}},
+			Status:     corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "192.168.0.10"}}},
+		}
+
+		pt := &networkingv1.PodTracker{
+			ObjectMeta: metav1.ObjectMeta{Name: "nodes"},
+			Spec:       networkingv1.PodTrackerSpec{NSToWatch: []string{"default"}, TrackNodes: true},
+		}
+		var writers map[string]*recordingWriter
+		podTrackers, writers = registerPodTrackers(pt)
+		written = writers[pt.GetName()]
+		r = &NodeReconciler{PodTrackerConfig: podTrackers}
+	})
+
+	It("records a Node joining once", func() {
+		Expect(r.recordNode(node)).To(Succeed())
+		Expect(r.recordNode(node)).To(Succeed())
+
+		Expect(events()).To(Equal([]tracking.NodeEvent{tracking.NodeJoinEvent}))
+	})
+
+	It("records each change of a Node separately, with its previous state", func() {
+		Expect(r.recordNode(node)).To(Succeed())
+
+		node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "192.168.0.11"}}
+		node.Spec.PodCIDRs = []string{"10.244.2.0/24"}
+		Expect(r.recordNode(node)).To(Succeed())
+
+		Expect(events()).To(Equal([]tracking.NodeEvent{tracking.NodeJoinEvent, tracking.NodeAddressesChangedEvent, tracking.NodePodCIDRsChangedEvent}))
+		records := recordsOf[*tracking.NodeRecord](written)
+		Expect(records[1].PreviousAddresses).To(HaveLen(1))
+		Expect(records[1].PreviousAddresses[0].Address).To(Equal("192.168.0.10"))
+		Expect(records[2].PreviousPodCIDRs).To(Equal([]string{"10.244.1.0/24"}))
+	})
+
+	It("records a deleted Node leaving", func() {
+		Expect(r.recordNode(node)).To(Succeed())
+		Expect(r.recordDeletedNode(node)).To(Succeed())
+		Expect(r.recordDeletedNode(node)).To(Succeed())
+
+		Expect(events()).To(Equal([]tracking.NodeEvent{tracking.NodeJoinEvent, tracking.NodeLeaveEvent}))
+	})
+
+	It("records a Node leaving once the PodTracker stops tracking Nodes", func() {
+		Expect(r.recordNode(node)).To(Succeed())
+
+		podTrackers.Items[0].Spec.TrackNodes = false
+		Expect(r.recordNode(node)).To(Succeed())
+		Expect(events()).To(Equal([]tracking.NodeEvent{tracking.NodeJoinEvent, tracking.NodeLeaveEvent}))
+
+		_, recorded := r.recorded.Get(recordedKey{PodTracker: "nodes", UID: node.GetUID()})
+		Expect(recorded).To(BeFalse())
+		Expect(r.enqueueRegisteredNodes(context.Background(), &podTrackers.Items[0])).To(BeEmpty())
+	})
+})
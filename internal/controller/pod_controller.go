@@ -30,6 +30,8 @@ package controller
 import (
 	"context"
 	"errors"
+	"fmt"
+	"reflect"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -38,16 +40,21 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	v1 "github.com/gccloudone-aurora/podtracker/api/v1"
 	"github.com/gccloudone-aurora/podtracker/internal/config"
 	"github.com/gccloudone-aurora/podtracker/internal/finalizer"
+	"github.com/gccloudone-aurora/podtracker/internal/owner"
+	"github.com/gccloudone-aurora/podtracker/internal/podstore"
 	"github.com/gccloudone-aurora/podtracker/internal/tracking"
 	"github.com/gccloudone-aurora/podtracker/internal/writer"
 )
@@ -59,17 +66,66 @@ type PodReconciler struct {
 	client.Client
 	Scheme           *runtime.Scheme
 	PodTrackerConfig *config.CachedPodTrackerConfig
+	// Owners resolves the top-level controller of Pods. Owners are not recorded if nil
+	Owners *owner.Resolver
+	// DefaultTrackingMode is the tracking mode of PodTrackers that don't set one
+	DefaultTrackingMode v1.TrackingMode
+	// Store remembers the Pods recorded without a finalizer, so that the Pods which vanish while the controller is down are recorded
+	// when it starts again, and the Pods whose release has been recorded, so that they aren't recorded again. Vanished Pods are not detected
+	// and released Pods are not remembered if nil
+	Store *podstore.Store
+	// Instance identifies the cluster and controller process on every record. Records are not stamped if nil
+	Instance *tracking.Instance
+
+	// observed is the state of the Pods as of the last record written for them
+	observed observedPods
+	// deleted holds the Pods whose deletion has been observed from watch events until their deletion is recorded
+	deleted deletedPods
+	// cache is the cache of the manager the reconciler is set up with
+	cache cache.Cache
+	// endpointSlices is the watch of the EndpointSlices referencing the recorded Pods
+	endpointSlices endpointSliceWatch
+	// snapshots holds the PodTrackers waiting for a snapshot of the Pods they track to be recorded
+	snapshots snapshotRequests
 }
 
 //+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;update
 // NOTE: the list/watch permissions on the following Nodes RBAC are needed due to the client being passed into this reconciler having caching which means informers are created for any Get requests so that they can take advantage of caching (https://github.com/kubernetes-sigs/controller-runtime/issues/1156)
 //+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
-
-// Reconcile is used to log pertinant information about Pod create and delete events using the configured BackendWriters
-// This function is called to reconcile the above behaviour whenever a Pod is created or has a deletion timestamp added.
+// NOTE: the following RBAC lets the owner chains of Pods managed by built-in workloads be resolved. Owners of other kinds are recorded,
+// but their own owners are only followed if the controller is granted get permissions on them
+//+kubebuilder:rbac:groups=apps,resources=replicasets;deployments;statefulsets;daemonsets,verbs=get
+//+kubebuilder:rbac:groups=batch,resources=jobs;cronjobs,verbs=get
+// NOTE: EndpointSlices are only watched (and cached) once a PodTracker records the Services fronting Pods.
+// Services are always watched by the ServiceReconciler
+//+kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch
+// NOTE: the labels of Namespaces are watched (and cached) to evaluate the namespaceSelectors of PodTrackers. The UID of the kube-system namespace
+// also identifies the cluster on every record, unless a cluster ID is configured
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",namespace=system,resources=configmaps,verbs=get;create;update
+
+// Reconcile is used to log pertinant information about Pod create, update and delete events using the configured BackendWriters
+// This function is called to reconcile the above behaviour whenever a Pod is created, has its observed state change or has a deletion timestamp added.
 func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	rl := log.FromContext(ctx)
 
+	// wait until the pods recorded without a finalizer have been loaded, so that released pods are not recorded again
+	if r.Store != nil {
+		select {
+		case <-r.Store.Loaded():
+		case <-ctx.Done():
+			return ctrl.Result{}, ctx.Err()
+		}
+	}
+
+	// record the deletion of a Pod tracked without a finalizer, if it has been observed from a watch event
+	if err := r.recordDeletedPod(ctx, req.NamespacedName); err != nil {
+		// writing to one or more backends failed - return and requeue with error
+		return ctrl.Result{}, err
+	}
+
 	// get the Pod resource from the Kubernetes API
 	currentPod := &corev1.Pod{}
 	if err := r.Client.Get(ctx, req.NamespacedName, currentPod); err != nil {
@@ -88,17 +144,52 @@ func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 		return ctrl.Result{}, err
 	}
 
+	// pods are recorded from the moment they are assigned an IP, regardless of their phase, so that short-lived pods (e.g. Jobs) and pods
+	// that fail are recorded too. Pods without an IP are reconciled again once they are assigned one (see SetupWithManager)
+	previous, observed := r.observed.Get(currentPod.GetUID())
+	if currentPod.ObjectMeta.DeletionTimestamp.IsZero() && !observed && len(tracking.PodIPs(currentPod)) == 0 {
+		rl.V(2).Info(
+			"Pod has not been assigned an IP yet",
+			"name", currentPod.GetName(),
+			"namespace", currentPod.GetNamespace(),
+		)
+
+		// return and don't requeue
+		return ctrl.Result{}, nil
+	}
+	if r.isReleased(currentPod) && !observed {
+		// the release of the pod's IPs has already been recorded - return and don't requeue
+		return ctrl.Result{}, nil
+	}
+
+	// get the labels of the Pod's namespace, against which the namespaceSelectors of PodTrackers are evaluated
+	namespaceLabels, err := r.PodTrackerConfig.NamespaceLabels(ctx, r.Client, currentPod.GetNamespace())
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
 	// get the Node that the Pod resides on (this is necessary to determine the NodeIP which is useful for troubleshooting Pods using `HostNetworking`)
 	currentNode := &corev1.Node{}
 	if err := r.Client.Get(ctx, types.NamespacedName{
 		Name:      currentPod.Spec.NodeName,
 		Namespace: corev1.NamespaceAll,
 	}, currentNode); err != nil {
-		if apierrors.IsNotFound(err) {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		if !tracking.PodIsTerminated(currentPod) && currentPod.ObjectMeta.DeletionTimestamp.IsZero() {
 			// pod may not be scheduled to a Node yet - return and requeue with a short delay
 			return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
 		}
-		return ctrl.Result{}, err
+
+		// the Node of a finished (or deleted) Pod may have been deleted already, in which case the Pod is recorded without the Node's IPs
+		rl.V(2).Info(
+			"Node of Pod not found, recording the Pod without its Node",
+			"name", currentPod.GetName(),
+			"namespace", currentPod.GetNamespace(),
+			"node", currentPod.Spec.NodeName,
+		)
+		currentNode = &corev1.Node{}
 	}
 
 	// check if the Pod is scheduled for deletion
@@ -110,43 +201,55 @@ func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 		)
 
 		// remove the finalizer on the pod resource
-		controllerutil.RemoveFinalizer(currentPod, finalizer.POD_FINALIZER_NAME)
-		if err := r.Update(ctx, currentPod); err != nil {
-			if apierrors.IsNotFound(err) {
-				// Pod may already be gone - return and don't requeue the request
-				return ctrl.Result{}, nil
+		if controllerutil.RemoveFinalizer(currentPod, finalizer.POD_FINALIZER_NAME) {
+			if err := r.Update(ctx, currentPod); err != nil {
+				if apierrors.IsNotFound(err) {
+					// Pod may already be gone - return and don't requeue the request
+					return ctrl.Result{}, nil
+				}
+
+				// error updating the Pod - return and requeue
+				return ctrl.Result{}, err
 			}
+		}
 
-			// error updating the Pod - return and requeue
-			return ctrl.Result{}, err
+		var services []tracking.ServiceInfo
+		if r.recordsServices(currentPod, namespaceLabels) {
+			var err error
+			if services, err = r.podServices(ctx, currentPod); err != nil {
+				return ctrl.Result{}, err
+			}
 		}
 
-		// write pod tracking info to all configured backends
-		if errs := r.writePodInfo(ctx, &tracking.PodInfoConfig{
-			Pod:   currentPod,
-			Node:  currentNode,
-			Event: tracking.PodDeleteEvent,
+		// write pod tracking info to all configured backends, unless the release of the pod's IPs has already been recorded
+		// when it finished
+		if r.observed.IsWritten(currentPod.GetUID(), tracking.PodDeleteEvent, observedPodState{}) {
+			rl.V(2).Info("Pod deletion has already been recorded", "name", currentPod.GetName(), "namespace", currentPod.GetNamespace())
+		} else if errs := r.writePodInfo(ctx, &tracking.PodInfoConfig{
+			Pod:      currentPod,
+			Node:     currentNode,
+			Event:    tracking.PodDeleteEvent,
+			Owner:    r.resolveOwner(ctx, currentPod),
+			Services: services,
 		}); len(errs) > 0 {
 			// writing to one or more backends failed - return and requeue with error
 			return ctrl.Result{}, errors.Join(errs...)
 		}
+		r.observed.Forget(currentPod.GetUID())
+		if r.Store != nil {
+			r.Store.Remove(currentPod.GetUID())
+		}
 
 		// pod deletion successfully recorded - return and don't requeue
 		return ctrl.Result{}, nil
 	}
 
-	// ensure that the pod is in a state where we can get the necessary information from it
-	if currentPod.Status.Phase != corev1.PodRunning {
-		rl.V(2).Info(
-			"Pod is not scheduled to a node yet",
-		)
-
-		// return and requeue with a small delay to give some time for the pod to get into a running state
-		return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
-	}
-
-	// add a finalizer to the pod so that we can intercept pod deletions to log deletion timestamp (establishes lifetime of Pod IP allocation)
-	if !controllerutil.ContainsFinalizer(currentPod, finalizer.POD_FINALIZER_NAME) {
+	// add a finalizer to the pod so that we can intercept pod deletions to log deletion timestamp (establishes lifetime of Pod IP allocation),
+	// unless all the PodTrackers tracking the pod observe its deletion from watch events
+	// NOTE: pods that have succeeded or failed have already released their IPs, so they are released below rather than waiting for their deletion
+	current := newObservedPodState(currentPod)
+	hasFinalizer := controllerutil.ContainsFinalizer(currentPod, finalizer.POD_FINALIZER_NAME)
+	if !current.Finished && !hasFinalizer && r.usesFinalizer(currentPod, namespaceLabels) {
 		controllerutil.AddFinalizer(currentPod, finalizer.POD_FINALIZER_NAME)
 		if err := r.Update(ctx, currentPod); err != nil {
 			if apierrors.IsNotFound(err) {
@@ -157,36 +260,142 @@ func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 			// error updating the Pod - return and requeue
 			return ctrl.Result{}, err
 		}
+		hasFinalizer = true
 	}
 
-	// write pod tracking info to all configured backends
-	if errs := r.writePodInfo(ctx, &tracking.PodInfoConfig{
-		Pod:   currentPod,
-		Node:  currentNode,
-		Event: tracking.PodCreateEvent,
-	}); len(errs) > 0 {
-		// writing to one or more backends failed - return and requeue with error
-		return ctrl.Result{}, errors.Join(errs...)
+	// the services fronting the pod are only looked up when they are recorded, as they are read from EndpointSlices rather than the pod
+	var services []tracking.ServiceInfo
+	if r.recordsServices(currentPod, namespaceLabels) {
+		var err error
+		if services, err = r.podServices(ctx, currentPod); err != nil {
+			return ctrl.Result{}, err
+		}
+		current.Services = serviceNames(services)
+	}
+
+	// pods which have already been recorded are only recorded again when their state changes
+	var events []tracking.PodEvent
+	var replacedNode string
+	if observed {
+		events = podEvents(&previous, current, "")
+	} else {
+		replacedNode = r.observed.ReplacedNode(currentPod)
+		events = podEvents(nil, current, replacedNode)
+	}
+
+	// the network policies selecting the pod are only evaluated when it is created (i.e. when it is assigned its IPs)
+	var networkPolicies *tracking.NetworkPolicyExposure
+	if !observed && r.recordsNetworkPolicies(currentPod, namespaceLabels) {
+		var err error
+		if networkPolicies, err = r.podNetworkPolicies(ctx, currentPod); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// write pod tracking info for every event to all configured backends. Events which have already been recorded are skipped,
+	// so that only the events which failed to be recorded are retried
+	podOwner := r.resolveOwner(ctx, currentPod)
+	for _, podEvent := range events {
+		if r.observed.IsWritten(currentPod.GetUID(), podEvent, current) {
+			continue
+		}
+		if errs := r.writePodInfo(ctx, &tracking.PodInfoConfig{
+			Pod:              currentPod,
+			Node:             currentNode,
+			Event:            podEvent,
+			Owner:            podOwner,
+			PreviousPodIPs:   splitNonEmpty(previous.PodIPs),
+			PreviousNode:     replacedNode,
+			Services:         services,
+			PreviousServices: splitNonEmpty(previous.Services),
+			NetworkPolicies:  networkPolicies,
+		}); len(errs) > 0 {
+			// writing to one or more backends failed - return and requeue with error
+			return ctrl.Result{}, errors.Join(errs...)
+		}
+		r.observed.Written(currentPod.GetUID(), podEvent, current)
+	}
+
+	if current.Finished {
+		// the release of the pod's IPs has been recorded - remember the pod as released (without modifying it) so that a controller restart
+		// doesn't record it again, and remove its finalizer so that its eventual deletion isn't recorded either
+		if r.Store != nil {
+			r.Store.Release(currentPod)
+		}
+		if controllerutil.RemoveFinalizer(currentPod, finalizer.POD_FINALIZER_NAME) {
+			if err := r.Update(ctx, currentPod); err != nil && !apierrors.IsNotFound(err) {
+				// error updating the Pod - return and requeue
+				return ctrl.Result{}, err
+			}
+		}
+		r.observed.Forget(currentPod.GetUID())
+
+		// pod release successfully recorded - return and don't requeue
+		return ctrl.Result{}, nil
+	}
+	r.observed.Set(currentPod, current)
+	if !hasFinalizer && r.Store != nil {
+		// remember the pod so that its deletion is recorded even if it is deleted while the controller is down
+		r.Store.Add(currentPod)
 	}
 
 	// reconciliation was successful - return and don't requeue
 	return ctrl.Result{}, nil
 }
 
-// writePodInfo adds some additional context (such as which PodTracker CR has been configured to track this pod) to the provided PodInfo object
-// and writes the provided PodInfo to all the configured writers
+// isReleased returns true if the release of the pod's IPs has already been recorded
+func (r *PodReconciler) isReleased(pod *corev1.Pod) bool {
+	if r.Store != nil {
+		record, ok := r.Store.Get(pod.GetUID())
+		return ok && record.Released
+	}
+	return false
+}
+
+// resolveOwner returns the top-level controller of the Pod. Failing to resolve the whole owner chain doesn't prevent the Pod from being recorded,
+// so the owner resolved so far is returned if an error occurs
+func (r *PodReconciler) resolveOwner(ctx context.Context, pod *corev1.Pod) *tracking.Owner {
+	if r.Owners == nil {
+		return nil
+	}
+
+	owner, err := r.Owners.Resolve(ctx, pod)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "unable to resolve the owner of Pod", "name", pod.GetName(), "namespace", pod.GetNamespace())
+	}
+	return owner
+}
+
+// writePodInfo adds some additional context (such as which PodTracker CR has been configured to track this pod) to the provided PodInfo object,
+// applies the PodTracker's projection rules and writes the resulting PodInfo to all the configured writers
 func (r *PodReconciler) writePodInfo(ctx context.Context, cfg *tracking.PodInfoConfig) (errs []error) {
-	info := tracking.New(cfg)
+	namespaceLabels, err := r.PodTrackerConfig.NamespaceLabels(ctx, r.Client, cfg.Pod.GetNamespace())
+	if err != nil {
+		return []error{err}
+	}
 
-	// aquire the cached config
-	r.PodTrackerConfig.Lock()
-	defer r.PodTrackerConfig.Unlock()
+	info := tracking.New(cfg)
 
-	for _, pt := range r.PodTrackerConfig.Items {
-		if pt.TracksPod(cfg.Pod) {
-			info.TrackedBy = pt.GetName()
-			errs = writer.WriteToAll(pt.GetWriters(), info)
+	// acquire the PodTrackers tracking the Pod, whose writers are written to without holding the lock
+	registrations, release := r.PodTrackerConfig.Acquire(func(pt *v1.PodTracker) bool {
+		return pt.TracksPod(cfg.Pod, namespaceLabels) && pt.RecordsEvent(cfg.Event)
+	})
+	defer release()
+
+	for _, registration := range registrations {
+		pt := registration.PodTracker
+		if !registration.Ready {
+			// the writers for this PodTracker could not be built - fail so that the event is retried once they are
+			errs = append(errs, fmt.Errorf("no writers are available for PodTracker %q", pt.GetName()))
+			continue
 		}
+		projected, err := pt.ProjectPodInfo(info)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		r.Instance.Stamp(projected)
+		errs = append(errs, writer.WriteToAll(registration.Writers, projected)...)
 	}
 
 	return
@@ -195,12 +404,18 @@ func (r *PodReconciler) writePodInfo(ctx context.Context, cfg *tracking.PodInfoC
 // enqueueTrackedPods lets us ensure that only Pods that are tracked by a PodTracker configuration are reconciled.
 // This helps to avoid errors where
 func (r *PodReconciler) enqueueTrackedPods(ctx context.Context, obj client.Object) []reconcile.Request {
+	// NOTE: Pods are enqueued if the labels of their namespace can't be read, as the reconciler only records the Pods which are tracked
+	namespaceLabels, err := r.PodTrackerConfig.NamespaceLabels(ctx, r.Client, obj.GetNamespace())
+	if err != nil {
+		log.FromContext(ctx).Error(err, "unable to get the Namespace of Pod", "name", obj.GetName(), "namespace", obj.GetNamespace())
+	}
+
 	// aquire the cached config
 	r.PodTrackerConfig.Lock()
 	defer r.PodTrackerConfig.Unlock()
 
 	for _, pt := range r.PodTrackerConfig.Items {
-		if pt.TracksPod(obj) {
+		if err != nil || pt.TracksPod(obj, namespaceLabels) {
 			return []reconcile.Request{
 				{
 					NamespacedName: types.NamespacedName{
@@ -215,9 +430,47 @@ func (r *PodReconciler) enqueueTrackedPods(ctx context.Context, obj client.Objec
 	return []reconcile.Request{}
 }
 
+// enqueueNamespacePods enqueues the Pods of the provided namespace which are tracked by a PodTracker
+func (r *PodReconciler) enqueueNamespacePods(ctx context.Context, obj client.Object) []reconcile.Request {
+	pods := &corev1.PodList{}
+	if err := r.Client.List(ctx, pods, client.InNamespace(obj.GetName())); err != nil {
+		log.FromContext(ctx).Error(err, "unable to list the Pods of namespace", "namespace", obj.GetName())
+		return []reconcile.Request{}
+	}
+
+	requests := []reconcile.Request{}
+	for i := range pods.Items {
+		requests = append(requests, r.enqueueTrackedPods(ctx, &pods.Items[i])...)
+	}
+	return requests
+}
+
+// namespaceLabelsChanged only lets through the updates of namespaces whose labels have changed
+var namespaceLabelsChanged = predicate.Funcs{
+	CreateFunc: func(ce event.CreateEvent) bool { return false },
+	UpdateFunc: func(ue event.UpdateEvent) bool {
+		return !reflect.DeepEqual(ue.ObjectOld.GetLabels(), ue.ObjectNew.GetLabels())
+	},
+	DeleteFunc:  func(de event.DeleteEvent) bool { return false },
+	GenericFunc: func(ge event.GenericEvent) bool { return false },
+}
+
 // SetupWithManager sets up the controller with the Controller Manager.
 func (r *PodReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	r.cache = mgr.GetCache()
+	if r.Store != nil {
+		if err := mgr.Add(r.Store); err != nil {
+			return err
+		}
+		if err := mgr.Add(manager.RunnableFunc(r.recordVanishedPods)); err != nil {
+			return err
+		}
+	}
+	if err := mgr.Add(manager.RunnableFunc(r.recordSnapshots)); err != nil {
+		return err
+	}
+
+	c, err := ctrl.NewControllerManagedBy(mgr).
 		Named("PodTracker-Pod").
 		Watches(
 			&corev1.Pod{},
@@ -226,13 +479,44 @@ func (r *PodReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				predicate.Funcs{
 					CreateFunc: func(ce event.CreateEvent) bool { return true },
 					UpdateFunc: func(ue event.UpdateEvent) bool {
-						// only enqueue pod updates that have a podtracker finalizer and are being deleted
-						return !ue.ObjectNew.GetDeletionTimestamp().IsZero() && controllerutil.ContainsFinalizer(ue.ObjectNew, finalizer.POD_FINALIZER_NAME)
+						oldPod, ok := ue.ObjectOld.(*corev1.Pod)
+						if !ok {
+							return false
+						}
+						newPod, ok := ue.ObjectNew.(*corev1.Pod)
+						if !ok {
+							return false
+						}
+
+						// enqueue pods that have not been recorded yet once they are assigned an IP
+						_, observed := r.observed.Get(newPod.GetUID())
+						if !observed && !controllerutil.ContainsFinalizer(newPod, finalizer.POD_FINALIZER_NAME) {
+							return len(tracking.PodIPs(oldPod)) == 0 && len(tracking.PodIPs(newPod)) > 0
+						}
+
+						// only enqueue pod updates that have been recorded and are being deleted, or whose observed state has changed
+						return !newPod.GetDeletionTimestamp().IsZero() || newObservedPodState(oldPod) != newObservedPodState(newPod)
 					},
 					DeleteFunc:  func(de event.DeleteEvent) bool { return false },
 					GenericFunc: func(ge event.GenericEvent) bool { return false },
 				},
 			),
 		).
-		Complete(r)
+		Watches(
+			&corev1.Pod{},
+			handler.Funcs{DeleteFunc: r.enqueueDeletedPod},
+		).
+		// the Pods of a namespace are reconciled when its labels change, as the namespace may have been selected (or unselected) by a PodTracker
+		Watches(
+			&corev1.Namespace{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueNamespacePods),
+			builder.WithPredicates(namespaceLabelsChanged),
+		).
+		Build(r)
+	if err != nil {
+		return err
+	}
+
+	r.endpointSlices.controller = c
+	return nil
 }
@@ -0,0 +1,218 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1 "github.com/gccloudone-aurora/podtracker/api/v1"
+	"github.com/gccloudone-aurora/podtracker/internal/config"
+	"github.com/gccloudone-aurora/podtracker/internal/finalizer"
+	"github.com/gccloudone-aurora/podtracker/internal/podstore"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+	"github.com/gccloudone-aurora/podtracker/internal/writer"
+)
+
+var _ = Describe("PodReconciler namespace label changes", func() {
+	var (
+		ctx       context.Context
+		c         client.Client
+		r         *PodReconciler
+		namespace *corev1.Namespace
+	)
+
+	// relabel updates the labels of the namespace, and returns the requests enqueued for the update if it is let through
+	relabel := func(labels map[string]string) []reconcile.Request {
+		old := namespace.DeepCopy()
+		namespace.SetLabels(labels)
+		Expect(c.Update(ctx, namespace)).To(Succeed())
+
+		if !namespaceLabelsChanged.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: namespace}) {
+			return nil
+		}
+		return r.enqueueNamespacePods(ctx, namespace)
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		namespace = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps", Labels: map[string]string{"env": "dev"}}}
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			namespace,
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other", Labels: map[string]string{"env": "production"}}},
+			&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "apps"}},
+			&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "apps", Labels: map[string]string{"excluded": "true"}}},
+			&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "other"}},
+		).Build()
+
+		podTrackers, _ := registerPodTrackers(&networkingv1.PodTracker{
+			ObjectMeta: metav1.ObjectMeta{Name: "production"},
+			Spec: networkingv1.PodTrackerSpec{
+				NamespaceSelector:    &metav1.LabelSelector{MatchLabels: map[string]string{"env": "production"}},
+				PodExclusionSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"excluded": "true"}},
+			},
+		})
+		r = &PodReconciler{Client: c, Scheme: scheme.Scheme, PodTrackerConfig: podTrackers}
+	})
+
+	It("enqueues the tracked Pods of a namespace once it is selected by a PodTracker", func() {
+		Expect(relabel(map[string]string{"env": "production"})).To(ConsistOf(
+			reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "apps", Name: "web"}},
+		))
+	})
+
+	It("doesn't enqueue the Pods of a namespace which isn't selected by a PodTracker", func() {
+		Expect(relabel(map[string]string{"env": "staging"})).To(BeEmpty())
+	})
+
+	It("ignores the updates of namespaces whose labels haven't changed", func() {
+		Expect(namespaceLabelsChanged.Update(event.UpdateEvent{ObjectOld: namespace.DeepCopy(), ObjectNew: namespace})).To(BeFalse())
+		Expect(namespaceLabelsChanged.Create(event.CreateEvent{Object: namespace})).To(BeFalse())
+		Expect(namespaceLabelsChanged.Delete(event.DeleteEvent{Object: namespace})).To(BeFalse())
+	})
+})
+
+var _ = Describe("PodReconciler releasing finished Pods", func() {
+	var (
+		ctx     context.Context
+		c       client.Client
+		store   *podstore.Store
+		written *recordingWriter
+		pod     *corev1.Pod
+	)
+
+	// reconcilePod reconciles the Pod with a new PodReconciler sharing the store, i.e. as a restarted controller would
+	reconcilePod := func() {
+		podTrackers := &config.CachedPodTrackerConfig{}
+		podTrackers.Items = []networkingv1.PodTracker{{
+			ObjectMeta: metav1.ObjectMeta{Name: "finalizer"},
+			Spec:       networkingv1.PodTrackerSpec{NSToWatch: []string{"apps"}, TrackingMode: networkingv1.FinalizerTrackingMode},
+		}}
+		podTrackers.SetWriters("finalizer", []writer.BackendWriter{written})
+		r := &PodReconciler{Client: c, Scheme: scheme.Scheme, PodTrackerConfig: podTrackers, Store: store}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pod)})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	// events returns the events recorded for the Pod
+	events := func() []tracking.PodEvent {
+		recorded := []tracking.PodEvent{}
+		for _, info := range recordsOf[*tracking.PodInfo](written) {
+			recorded = append(recorded, info.Event)
+		}
+		return recorded
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		pod = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "apps", UID: "job-uid", Finalizers: []string{finalizer.POD_FINALIZER_NAME}},
+			Spec:       corev1.PodSpec{NodeName: "node-a"},
+			Status:     corev1.PodStatus{Phase: corev1.PodSucceeded, PodIP: "10.50.0.1", PodIPs: []corev1.PodIP{{IP: "10.50.0.1"}}},
+		}
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps"}},
+			&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}},
+			pod,
+		).Build()
+		written = &recordingWriter{}
+
+		storeContext, cancel := context.WithCancel(ctx)
+		DeferCleanup(cancel)
+		store = &podstore.Store{Client: c, Reader: c, Namespace: "podtracker-system", FlushInterval: time.Hour}
+		go func() {
+			defer GinkgoRecover()
+			Expect(store.Start(storeContext)).To(Succeed())
+		}()
+	})
+
+	It("remembers a released Pod in the store without annotating it", func() {
+		reconcilePod()
+		Expect(events()).To(ContainElement(tracking.PodDeleteEvent))
+
+		released := &corev1.Pod{}
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(pod), released)).To(Succeed())
+		Expect(controllerutil.ContainsFinalizer(released, finalizer.POD_FINALIZER_NAME)).To(BeFalse())
+		Expect(released.GetAnnotations()).To(BeEmpty())
+
+		record, ok := store.Get(pod.GetUID())
+		Expect(ok).To(BeTrue())
+		Expect(record.Released).To(BeTrue())
+	})
+
+	It("doesn't record a released Pod again", func() {
+		reconcilePod()
+		recorded := len(events())
+
+		reconcilePod()
+		Expect(events()).To(HaveLen(recorded))
+	})
+})
+
+var _ = Describe("PodReconciler stamping records", func() {
+	It("stamps the record written for every PodTracker with its own sequence number", func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "apps", UID: "api-uid"},
+			Status:     corev1.PodStatus{PodIP: "10.50.0.1", PodIPs: []corev1.PodIP{{IP: "10.50.0.1"}}},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps"}},
+			pod,
+		).Build()
+		podTrackers, writers := registerPodTrackers(
+			&networkingv1.PodTracker{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Spec: networkingv1.PodTrackerSpec{NSToWatch: []string{"apps"}}},
+			&networkingv1.PodTracker{ObjectMeta: metav1.ObjectMeta{Name: "b"}, Spec: networkingv1.PodTrackerSpec{NSToWatch: []string{"apps"}}},
+		)
+		r := &PodReconciler{Client: c, Scheme: scheme.Scheme, PodTrackerConfig: podTrackers, Instance: &tracking.Instance{ClusterName: "prod"}}
+
+		Expect(r.writePodInfo(context.Background(), &tracking.PodInfoConfig{Pod: pod, Node: &corev1.Node{}, Event: tracking.PodCreateEvent})).To(BeEmpty())
+
+		sequences := []uint64{}
+		for _, name := range []string{"a", "b"} {
+			records := recordsOf[*tracking.PodInfo](writers[name])
+			Expect(records).To(HaveLen(1))
+			Expect(records[0].ClusterName).To(Equal("prod"))
+			sequences = append(sequences, records[0].ControllerSequence)
+		}
+		Expect(sequences).To(ConsistOf(uint64(1), uint64(2)))
+	})
+})
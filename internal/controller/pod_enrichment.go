@@ -0,0 +1,72 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+// enriches returns true if any of the PodTrackers tracking the Pod enables the enrichment checked by enabled.
+// Enrichments which are looked up from other resources are only looked up when a PodTracker records them
+func (r *PodReconciler) enriches(pod *corev1.Pod, namespaceLabels map[string]string, enabled func(*tracking.EnrichmentConfig) bool) bool {
+	// aquire the cached config
+	r.PodTrackerConfig.Lock()
+	defer r.PodTrackerConfig.Unlock()
+
+	for _, pt := range r.PodTrackerConfig.Items {
+		if pt.TracksPod(pod, namespaceLabels) && pt.Spec.Enrichment != nil && enabled(pt.Spec.Enrichment) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordsServices returns true if any of the PodTrackers tracking the Pod records the Services fronting it
+func (r *PodReconciler) recordsServices(pod *corev1.Pod, namespaceLabels map[string]string) bool {
+	return r.enriches(pod, namespaceLabels, func(e *tracking.EnrichmentConfig) bool { return e.Services })
+}
+
+// recordsNetworkPolicies returns true if any of the PodTrackers tracking the Pod records the NetworkPolicies selecting it
+func (r *PodReconciler) recordsNetworkPolicies(pod *corev1.Pod, namespaceLabels map[string]string) bool {
+	return r.enriches(pod, namespaceLabels, func(e *tracking.EnrichmentConfig) bool { return e.NetworkPolicies })
+}
+
+// podNetworkPolicies evaluates the cached NetworkPolicies of the Pod's namespace against the Pod
+func (r *PodReconciler) podNetworkPolicies(ctx context.Context, pod *corev1.Pod) (*tracking.NetworkPolicyExposure, error) {
+	policies := &networkingv1.NetworkPolicyList{}
+	if err := r.Client.List(ctx, policies, client.InNamespace(pod.GetNamespace())); err != nil {
+		return nil, err
+	}
+	return tracking.PodNetworkPolicies(pod, policies.Items), nil
+}
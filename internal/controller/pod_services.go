@@ -0,0 +1,144 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+// endpointSliceWatch starts watching EndpointSlices the first time the Services of a Pod are recorded, so that EndpointSlices
+// (and Services) are only cached when a PodTracker records them
+type endpointSliceWatch struct {
+	mu         sync.Mutex
+	controller controller.Controller
+	started    bool
+}
+
+// Start starts watching EndpointSlices with the provided handler, unless the watch has already been started
+func (w *endpointSliceWatch) Start(src source.Source, h handler.EventHandler) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.started || w.controller == nil {
+		return nil
+	}
+	if err := w.controller.Watch(src, h); err != nil {
+		return err
+	}
+	w.started = true
+	return nil
+}
+
+// podServices returns the Services fronting the Pod, which are looked up from the cached EndpointSlices and Services of the Pod's namespace
+func (r *PodReconciler) podServices(ctx context.Context, pod *corev1.Pod) ([]tracking.ServiceInfo, error) {
+	if err := r.endpointSlices.Start(source.Kind(r.cache, &discoveryv1.EndpointSlice{}), handler.Funcs{
+		CreateFunc: func(ctx context.Context, ce event.CreateEvent, q workqueue.RateLimitingInterface) {
+			r.enqueueEndpointSlicePods(q, ce.Object)
+		},
+		UpdateFunc: func(ctx context.Context, ue event.UpdateEvent, q workqueue.RateLimitingInterface) {
+			r.enqueueEndpointSlicePods(q, ue.ObjectOld)
+			r.enqueueEndpointSlicePods(q, ue.ObjectNew)
+		},
+		DeleteFunc: func(ctx context.Context, de event.DeleteEvent, q workqueue.RateLimitingInterface) {
+			r.enqueueEndpointSlicePods(q, de.Object)
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	slices := &discoveryv1.EndpointSliceList{}
+	if err := r.Client.List(ctx, slices, client.InNamespace(pod.GetNamespace())); err != nil {
+		return nil, err
+	}
+
+	services := map[string]*corev1.Service{}
+	for i := range slices.Items {
+		name := slices.Items[i].GetLabels()[discoveryv1.LabelServiceName]
+		if _, ok := services[name]; ok || name == "" || !tracking.EndpointSliceReferencesPod(&slices.Items[i], pod) {
+			continue
+		}
+
+		svc := &corev1.Service{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: pod.GetNamespace()}, svc); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, err
+			}
+			svc = nil
+		}
+		services[name] = svc
+	}
+
+	return tracking.PodServices(pod, slices.Items, services), nil
+}
+
+// enqueueEndpointSlicePods enqueues the recorded Pods targeted by the endpoints of the EndpointSlice, so that changes to the Services fronting them are recorded
+func (r *PodReconciler) enqueueEndpointSlicePods(q workqueue.RateLimitingInterface, obj client.Object) {
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return
+	}
+
+	for _, endpoint := range slice.Endpoints {
+		ref := endpoint.TargetRef
+		if ref == nil || ref.Kind != "Pod" {
+			continue
+		}
+		if _, observed := r.observed.Get(ref.UID); observed {
+			q.Add(reconcile.Request{NamespacedName: types.NamespacedName{Name: ref.Name, Namespace: slice.GetNamespace()}})
+		}
+	}
+}
+
+// serviceNames returns the comma separated names of the provided Services
+func serviceNames(services []tracking.ServiceInfo) string {
+	return strings.Join(tracking.ServiceNames(services), ",")
+}
+
+// splitNonEmpty splits the provided comma separated list, returning nil if it is empty
+func splitNonEmpty(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
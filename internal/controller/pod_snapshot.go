@@ -0,0 +1,302 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	v1 "github.com/gccloudone-aurora/podtracker/api/v1"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+	"github.com/gccloudone-aurora/podtracker/internal/writer"
+)
+
+// snapshotRetryInterval is the period in which snapshots that failed to be recorded are retried
+const snapshotRetryInterval = time.Minute
+
+// SnapshotRequester records a snapshot of the Pods tracked by a PodTracker
+type SnapshotRequester interface {
+	// RequestSnapshot asynchronously records a Snapshot event for every Pod tracked by the PodTracker with the provided name
+	RequestSnapshot(name string)
+}
+
+// snapshotRequests holds the names of the PodTrackers waiting for a snapshot of their Pods to be recorded, along with the progress
+// of the snapshots which failed to be recorded, so that retrying them only writes the Pods to the writers which failed
+type snapshotRequests struct {
+	mu      sync.Mutex
+	pending map[string]bool
+	// written holds the streams (see writer.StreamName) that each Pod has been written to, by PodTracker name
+	written map[string]map[types.UID]map[string]bool
+	signal  chan struct{}
+}
+
+// Push queues a new snapshot for the PodTracker with the provided name. Snapshots requested again before they are recorded are only recorded once
+func (s *snapshotRequests) Push(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.written, name)
+	s.push(name)
+}
+
+// Retry queues the snapshot for the PodTracker with the provided name again, without recording the Pods which have already been written
+func (s *snapshotRequests) Retry(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.push(name)
+}
+
+func (s *snapshotRequests) push(name string) {
+	if s.pending == nil {
+		s.pending = map[string]bool{}
+	}
+	s.pending[name] = true
+	select {
+	case s.wait() <- struct{}{}:
+	default:
+	}
+}
+
+// Pop removes and returns the names of the PodTrackers waiting for a snapshot
+func (s *snapshotRequests) Pop() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.pending))
+	for name := range s.pending {
+		names = append(names, name)
+	}
+	s.pending = nil
+	return names
+}
+
+// Written returns true if the snapshot of the PodTracker with the provided name has already written the Pod to the stream
+func (s *snapshotRequests) Written(name string, uid types.UID, stream string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.written[name][uid][stream]
+}
+
+// MarkWritten records that the snapshot of the PodTracker with the provided name has written the Pod to the stream
+func (s *snapshotRequests) MarkWritten(name string, uid types.UID, stream string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.written == nil {
+		s.written = map[string]map[types.UID]map[string]bool{}
+	}
+	if s.written[name] == nil {
+		s.written[name] = map[types.UID]map[string]bool{}
+	}
+	if s.written[name][uid] == nil {
+		s.written[name][uid] = map[string]bool{}
+	}
+	s.written[name][uid][stream] = true
+}
+
+// Done forgets the progress of the snapshot of the PodTracker with the provided name, once it has been fully recorded
+func (s *snapshotRequests) Done(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.written, name)
+}
+
+// Wait returns a channel which receives a value when snapshots have been requested
+func (s *snapshotRequests) Wait() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.wait()
+}
+
+func (s *snapshotRequests) wait() chan struct{} {
+	if s.signal == nil {
+		s.signal = make(chan struct{}, 1)
+	}
+	return s.signal
+}
+
+// RequestSnapshot queues a snapshot of the Pods tracked by the PodTracker with the provided name, which is recorded once the cache has synced
+func (r *PodReconciler) RequestSnapshot(name string) {
+	r.snapshots.Push(name)
+}
+
+// recordSnapshots records the requested snapshots until the provided context is cancelled.
+// Snapshots that fail to be recorded are retried after snapshotRetryInterval, for the Pods and writers which failed only
+func (r *PodReconciler) recordSnapshots(ctx context.Context) error {
+	rl := log.FromContext(ctx).WithName("snapshots")
+
+	if !r.cache.WaitForCacheSync(ctx) {
+		return nil
+	}
+
+	for {
+		select {
+		case <-r.snapshots.Wait():
+		case <-ctx.Done():
+			return nil
+		}
+
+		for _, name := range r.snapshots.Pop() {
+			pods, err := r.recordSnapshot(ctx, name)
+			if err != nil {
+				rl.Error(err, "unable to record the snapshot of PodTracker. will try again later", "name", name)
+				time.AfterFunc(snapshotRetryInterval, func() { r.snapshots.Retry(name) })
+				continue
+			}
+			r.snapshots.Done(name)
+			rl.Info("recorded the snapshot of PodTracker", "name", name, "pods", pods)
+		}
+	}
+}
+
+// recordSnapshot writes a Snapshot event for every existing Pod tracked by the PodTracker with the provided name, returning the number of Pods recorded.
+// Pods which haven't been assigned an IP yet, or have already released their IPs, are left out, along with the Pods which an earlier attempt
+// of the snapshot has written to every writer
+func (r *PodReconciler) recordSnapshot(ctx context.Context, name string) (int, error) {
+	pt, ok := r.podTracker(name)
+	if !ok || !pt.RecordsEvent(tracking.PodSnapshotEvent) {
+		// the PodTracker has been removed, or it doesn't record snapshots
+		return 0, nil
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.Client.List(ctx, pods); err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	recorded := 0
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !pod.GetDeletionTimestamp().IsZero() || len(tracking.PodIPs(pod)) == 0 || newObservedPodState(pod).Finished || r.isReleased(pod) {
+			continue
+		}
+		namespaceLabels, err := r.PodTrackerConfig.NamespaceLabels(ctx, r.Client, pod.GetNamespace())
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !pt.TracksPod(pod, namespaceLabels) {
+			continue
+		}
+
+		cfg := &tracking.PodInfoConfig{
+			Pod:   pod,
+			Node:  r.nodeOrEmpty(ctx, pod.Spec.NodeName),
+			Event: tracking.PodSnapshotEvent,
+			Owner: r.resolveOwner(ctx, pod),
+		}
+		if pt.Spec.Enrichment != nil && pt.Spec.Enrichment.Services {
+			services, err := r.podServices(ctx, pod)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			cfg.Services = services
+		}
+		if pt.Spec.Enrichment != nil && pt.Spec.Enrichment.NetworkPolicies {
+			networkPolicies, err := r.podNetworkPolicies(ctx, pod)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			cfg.NetworkPolicies = networkPolicies
+		}
+
+		if podErrs := r.writeSnapshot(name, cfg); len(podErrs) > 0 {
+			errs = append(errs, podErrs...)
+			continue
+		}
+		recorded++
+	}
+
+	return recorded, errors.Join(errs...)
+}
+
+// writeSnapshot writes the Snapshot event of a Pod to the writers of the PodTracker with the provided name only,
+// as the other PodTrackers tracking the Pod have recorded it already. Writers which the Pod has already been written to are skipped
+func (r *PodReconciler) writeSnapshot(name string, cfg *tracking.PodInfoConfig) []error {
+	info := tracking.New(cfg)
+
+	// acquire the PodTracker, whose writers are written to without holding the lock
+	registrations, release := r.PodTrackerConfig.Acquire(func(pt *v1.PodTracker) bool { return pt.GetName() == name })
+	defer release()
+
+	for _, registration := range registrations {
+		if !registration.Ready {
+			// the writers for this PodTracker could not be built - fail so that the snapshot is retried once they are
+			return []error{fmt.Errorf("no writers are available for PodTracker %q", name)}
+		}
+		projected, err := registration.PodTracker.ProjectPodInfo(info)
+		if err != nil {
+			return []error{err}
+		}
+		r.Instance.Stamp(projected)
+
+		errs := []error{}
+		for _, w := range registration.Writers {
+			stream := writer.StreamName(w)
+			if r.snapshots.Written(name, cfg.Pod.GetUID(), stream) {
+				continue
+			}
+			if err := w.Write(projected); err != nil && !errors.Is(err, writer.ErrRecordSkipped) {
+				errs = append(errs, err)
+				continue
+			}
+			r.snapshots.MarkWritten(name, cfg.Pod.GetUID(), stream)
+		}
+		return errs
+	}
+
+	// the PodTracker has been removed since the snapshot started
+	return nil
+}
+
+// podTracker returns a copy of the registered PodTracker with the provided name
+func (r *PodReconciler) podTracker(name string) (v1.PodTracker, bool) {
+	// aquire the cached config
+	r.PodTrackerConfig.Lock()
+	defer r.PodTrackerConfig.Unlock()
+
+	for _, pt := range r.PodTrackerConfig.Items {
+		if pt.GetName() == name {
+			return *pt.DeepCopy(), true
+		}
+	}
+	return v1.PodTracker{}, false
+}
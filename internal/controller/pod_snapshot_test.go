@@ -0,0 +1,192 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	networkingv1 "github.com/gccloudone-aurora/podtracker/api/v1"
+	"github.com/gccloudone-aurora/podtracker/internal/config"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+	"github.com/gccloudone-aurora/podtracker/internal/writer"
+)
+
+var _ = Describe("PodReconciler snapshots", func() {
+	var (
+		ctx       context.Context
+		namespace string
+		plugin    *recordingPlugin
+		address   string
+	)
+
+	setup := func(mgr ctrl.Manager, podTrackers *config.CachedPodTrackerConfig, podTrackerReconciler *PodTrackerReconciler) error {
+		r := &PodReconciler{
+			Client:           mgr.GetClient(),
+			Scheme:           mgr.GetScheme(),
+			PodTrackerConfig: podTrackers,
+		}
+		podTrackerReconciler.Snapshots = r
+		return r.SetupWithManager(mgr)
+	}
+
+	watchPods := func(spec *networkingv1.PodTrackerSpec) {
+		spec.NSToWatch = []string{namespace}
+		spec.TrackingMode = networkingv1.WatchTrackingMode
+	}
+
+	// events returns the events recorded for the Pod with the provided name by the named PodTracker
+	events := func(podTracker, name string) func() []tracking.PodEvent {
+		return func() []tracking.PodEvent {
+			recorded := []tracking.PodEvent{}
+			for _, info := range recordsOf[*tracking.PodInfo](plugin) {
+				if info.TrackedBy == podTracker && info.Namespace == namespace && info.Name == name {
+					recorded = append(recorded, info.Event)
+				}
+			}
+			return recorded
+		}
+	}
+
+	BeforeEach(func() {
+		requireTestEnv()
+		ctx = context.Background()
+		namespace = createNamespace(ctx)
+		plugin, address = servePlugin()
+	})
+
+	It("records a snapshot of the existing Pods for a PodTracker registered after they were recorded", func() {
+		node := createNode(ctx, "192.168.0.30")
+		first := newPodTracker(address, watchPods)
+		createPodTracker(ctx, first)
+		startManager(setup)
+
+		createRunningPod(ctx, namespace, "existing", node, "10.30.0.1")
+		Eventually(events(first.GetName(), "existing")).WithTimeout(30 * time.Second).Should(ContainElement(tracking.PodCreateEvent))
+
+		second := newPodTracker(address, watchPods)
+		createPodTracker(ctx, second)
+		Eventually(events(second.GetName(), "existing")).WithTimeout(30 * time.Second).Should(ConsistOf(tracking.PodSnapshotEvent))
+		Consistently(events(first.GetName(), "existing")).WithTimeout(2 * time.Second).ShouldNot(ContainElement(tracking.PodSnapshotEvent))
+	})
+})
+
+var _ = Describe("PodReconciler recording a snapshot", func() {
+	var (
+		ctx     context.Context
+		r       *PodReconciler
+		written map[string]*recordingWriter
+	)
+
+	pod := func(namespace, name, ip string, phase corev1.PodPhase) *corev1.Pod {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, UID: types.UID(name + "-uid")},
+			Status:     corev1.PodStatus{Phase: phase, PodIP: ip},
+		}
+		if ip != "" {
+			p.Status.PodIPs = []corev1.PodIP{{IP: ip}}
+		}
+		return p
+	}
+
+	// snapshots returns the names of the Pods recorded with a Snapshot event by the named PodTracker
+	snapshots := func(podTracker string) []string {
+		names := []string{}
+		for _, info := range recordsOf[*tracking.PodInfo](written[podTracker]) {
+			Expect(info.Event).To(Equal(tracking.PodSnapshotEvent))
+			names = append(names, info.Name)
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps"}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+			pod("apps", "running", "10.30.0.1", corev1.PodRunning),
+			pod("apps", "second", "10.30.0.2", corev1.PodRunning),
+			pod("apps", "pending", "", corev1.PodPending),
+			pod("apps", "succeeded", "10.30.0.3", corev1.PodSucceeded),
+			pod("other", "untracked", "10.30.0.4", corev1.PodRunning),
+		).Build()
+
+		var podTrackers *config.CachedPodTrackerConfig
+		podTrackers, written = registerPodTrackers(
+			&networkingv1.PodTracker{
+				ObjectMeta: metav1.ObjectMeta{Name: "registered"},
+				Spec:       networkingv1.PodTrackerSpec{NSToWatch: []string{"apps"}},
+			},
+			&networkingv1.PodTracker{
+				ObjectMeta: metav1.ObjectMeta{Name: "existing"},
+				Spec:       networkingv1.PodTrackerSpec{NSToWatch: []string{"apps"}},
+			},
+		)
+		r = &PodReconciler{Client: c, PodTrackerConfig: podTrackers}
+	})
+
+	It("records the tracked Pods holding IPs for the requested PodTracker only", func() {
+		recorded, err := r.recordSnapshot(ctx, "registered")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(recorded).To(Equal(2))
+		Expect(snapshots("registered")).To(ConsistOf("running", "second"))
+		Expect(snapshots("existing")).To(BeEmpty())
+	})
+
+	It("does not record the snapshot of a removed PodTracker", func() {
+		recorded, err := r.recordSnapshot(ctx, "removed")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorded).To(BeZero())
+	})
+
+	It("only writes the Pods which an earlier attempt failed to write when it is retried", func() {
+		stream := writer.StreamName(written["registered"])
+		r.snapshots.MarkWritten("registered", "running-uid", stream)
+
+		written["registered"].err = errors.New("backend unavailable")
+		_, err := r.recordSnapshot(ctx, "registered")
+		Expect(err).To(HaveOccurred())
+
+		written["registered"].err = nil
+		_, err = r.recordSnapshot(ctx, "registered")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snapshots("registered")).To(ConsistOf("second"))
+	})
+})
@@ -0,0 +1,253 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package controller
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+// replacedPodRetention is how long the Node of a deleted Pod is remembered for, so that a Pod replacing it with the same name
+// (e.g. a StatefulSet Pod) can be recorded as rescheduled
+const replacedPodRetention = time.Hour
+
+// observedPodState is the state of a Pod as of the last record written for it
+type observedPodState struct {
+	// NetworkStatus is the raw network-status annotation of the Pod
+	NetworkStatus string
+	// PodIPs are the comma separated IPs of the Pod
+	PodIPs   string
+	Node     string
+	Ready    bool
+	Finished bool
+	Evicted  bool
+	// Services are the comma separated names of the Services fronting the Pod. They are only looked up (see podServices)
+	// when a PodTracker records them, so they are not part of the state returned by newObservedPodState
+	Services string
+}
+
+// newObservedPodState returns the current state of the Pod
+func newObservedPodState(pod *corev1.Pod) observedPodState {
+	return observedPodState{
+		NetworkStatus: pod.GetAnnotations()[tracking.NetworkStatusAnnotation],
+		PodIPs:        strings.Join(tracking.PodIPs(pod), ","),
+		Node:          pod.Spec.NodeName,
+		Ready:         tracking.PodIsReady(pod),
+		Finished:      tracking.PodIsTerminated(pod),
+		Evicted:       tracking.PodIsEvicted(pod),
+	}
+}
+
+// podEvents returns the events describing the transition of a Pod from its previous state (nil if the Pod has never been recorded)
+// to its current state, in the order they should be recorded. previousNode is the Node of the Pod that the Pod replaces, if any.
+// Pods that have succeeded or failed have released their IPs, so a delete event is recorded for them
+func podEvents(previous *observedPodState, current observedPodState, previousNode string) []tracking.PodEvent {
+	events := []tracking.PodEvent{}
+	if previous == nil {
+		events = append(events, tracking.PodCreateEvent)
+		if previousNode != "" && previousNode != current.Node {
+			events = append(events, tracking.PodRescheduledEvent)
+		}
+		if current.PodIPs != "" {
+			events = append(events, tracking.PodIPAssignedEvent)
+		}
+		if current.Evicted {
+			events = append(events, tracking.PodEvictedEvent)
+		}
+		if current.Finished {
+			events = append(events, tracking.PodTerminatedEvent, tracking.PodDeleteEvent)
+		}
+		return events
+	}
+
+	switch {
+	case previous.PodIPs == "" && current.PodIPs != "":
+		events = append(events, tracking.PodIPAssignedEvent)
+	case previous.PodIPs != current.PodIPs && current.PodIPs != "":
+		events = append(events, tracking.PodIPChangedEvent)
+	}
+	if previous.NetworkStatus != current.NetworkStatus {
+		events = append(events, tracking.PodNetworkUpdateEvent)
+	}
+	if previous.Services != current.Services {
+		events = append(events, tracking.PodServicesChangedEvent)
+	}
+	if !previous.Ready && current.Ready {
+		events = append(events, tracking.PodReadyEvent)
+	}
+	if !previous.Evicted && current.Evicted {
+		events = append(events, tracking.PodEvictedEvent)
+	}
+	if !previous.Finished && current.Finished {
+		events = append(events, tracking.PodTerminatedEvent, tracking.PodDeleteEvent)
+	}
+	return events
+}
+
+// describesState returns true if the record of the event describes the current state of the Pod (e.g. its IPs), rather than
+// a step of its lifecycle which only happens once
+func describesState(event tracking.PodEvent) bool {
+	switch event {
+	case tracking.PodIPAssignedEvent, tracking.PodIPChangedEvent, tracking.PodNetworkUpdateEvent, tracking.PodServicesChangedEvent:
+		return true
+	}
+	return false
+}
+
+// writtenEvent is an event that has been recorded for a Pod whose transition to its current state has not been fully recorded yet
+type writtenEvent struct {
+	State     observedPodState
+	WrittenAt time.Time
+}
+
+// replacedPod is a deleted Pod whose Node is remembered
+type replacedPod struct {
+	UID       types.UID
+	Node      string
+	DeletedAt time.Time
+}
+
+// observedPods keeps track of the state of Pods as of the last record written for them, so that changes can be recorded as update events.
+// NOTE: the observed state is kept in memory only. After a controller restart, Pods are recorded with a create event again
+type observedPods struct {
+	mu       sync.Mutex
+	state    map[types.UID]observedPodState
+	names    map[types.UID]types.NamespacedName
+	replaced map[types.NamespacedName]replacedPod
+	// written holds the events recorded for Pods whose other events failed to be recorded, so that only the failed events are retried
+	written map[types.UID]map[tracking.PodEvent]writtenEvent
+	swept   time.Time
+}
+
+// Get returns the last observed state of the Pod with the given UID
+func (o *observedPods) Get(uid types.UID) (observedPodState, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	state, ok := o.state[uid]
+	return state, ok
+}
+
+// Set records the observed state of the provided Pod
+func (o *observedPods) Set(pod *corev1.Pod, state observedPodState) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.state == nil {
+		o.state = map[types.UID]observedPodState{}
+		o.names = map[types.UID]types.NamespacedName{}
+	}
+	o.state[pod.GetUID()] = state
+	o.names[pod.GetUID()] = types.NamespacedName{Name: pod.GetName(), Namespace: pod.GetNamespace()}
+	delete(o.written, pod.GetUID())
+}
+
+// Written records that the event has been recorded for the Pod with the given UID, as it transitions to the provided state.
+// It is forgotten once the transition has been fully recorded (see Set and Forget)
+func (o *observedPods) Written(uid types.UID, event tracking.PodEvent, state observedPodState) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.written == nil {
+		o.written = map[types.UID]map[tracking.PodEvent]writtenEvent{}
+	}
+	if o.written[uid] == nil {
+		o.written[uid] = map[tracking.PodEvent]writtenEvent{}
+	}
+	o.written[uid][event] = writtenEvent{State: state, WrittenAt: time.Now()}
+}
+
+// IsWritten returns true if the event has already been recorded for the Pod with the given UID during its transition to the provided state.
+// Events which describe the state of the Pod are recorded again if the Pod changed since
+func (o *observedPods) IsWritten(uid types.UID, event tracking.PodEvent, state observedPodState) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	written, ok := o.written[uid][event]
+	if !ok {
+		return false
+	}
+	return !describesState(event) || written.State == state
+}
+
+// ReplacedNode returns the Node of a recently deleted Pod which had the same name as the provided Pod
+func (o *observedPods) ReplacedNode(pod *corev1.Pod) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	replaced, ok := o.replaced[types.NamespacedName{Name: pod.GetName(), Namespace: pod.GetNamespace()}]
+	if !ok || replaced.UID == pod.GetUID() || time.Since(replaced.DeletedAt) > replacedPodRetention {
+		return ""
+	}
+	return replaced.Node
+}
+
+// Forget removes the observed state of the Pod with the given UID. The Node of the Pod is remembered for a while,
+// so that a Pod replacing it can be recorded as rescheduled
+func (o *observedPods) Forget(uid types.UID) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	if o.replaced == nil {
+		o.replaced = map[types.NamespacedName]replacedPod{}
+	}
+	if name, ok := o.names[uid]; ok {
+		o.replaced[name] = replacedPod{UID: uid, Node: o.state[uid].Node, DeletedAt: now}
+	}
+	delete(o.state, uid)
+	delete(o.names, uid)
+	delete(o.written, uid)
+
+	// periodically drop the Pods which have been deleted for longer than the retention period, along with the events recorded
+	// for Pods which were deleted before their transition was fully recorded
+	if now.Sub(o.swept) > time.Minute {
+		for name, replaced := range o.replaced {
+			if now.Sub(replaced.DeletedAt) > replacedPodRetention {
+				delete(o.replaced, name)
+			}
+		}
+		for uid, events := range o.written {
+			for event, written := range events {
+				if now.Sub(written.WrittenAt) > replacedPodRetention {
+					delete(events, event)
+				}
+			}
+			if len(events) == 0 {
+				delete(o.written, uid)
+			}
+		}
+		o.swept = now
+	}
+}
@@ -0,0 +1,101 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+var _ = Describe("podEvents", func() {
+	running := observedPodState{PodIPs: "10.0.0.1", Node: "node-a", Ready: true}
+
+	// with returns a copy of the running state changed by the provided function
+	with := func(change func(*observedPodState)) observedPodState {
+		state := running
+		change(&state)
+		return state
+	}
+
+	DescribeTable("records the transition of a Pod",
+		func(previous *observedPodState, current observedPodState, previousNode string, expected []tracking.PodEvent) {
+			Expect(podEvents(previous, current, previousNode)).To(Equal(expected))
+		},
+		// Pods which have never been recorded
+		Entry("creates a Pod which hasn't been recorded",
+			nil, running, "", []tracking.PodEvent{tracking.PodCreateEvent, tracking.PodIPAssignedEvent}),
+		Entry("creates a Pod without IPs (e.g. a deleted Pod) without assigning IPs",
+			nil, observedPodState{Node: "node-a"}, "", []tracking.PodEvent{tracking.PodCreateEvent}),
+		Entry("reschedules a Pod replacing a Pod on another Node",
+			nil, running, "node-b", []tracking.PodEvent{tracking.PodCreateEvent, tracking.PodRescheduledEvent, tracking.PodIPAssignedEvent}),
+		Entry("doesn't reschedule a Pod replacing a Pod on the same Node",
+			nil, running, "node-a", []tracking.PodEvent{tracking.PodCreateEvent, tracking.PodIPAssignedEvent}),
+		Entry("evicts a Pod which was evicted before it was recorded",
+			nil, with(func(s *observedPodState) { s.Evicted, s.Finished = true, true }), "",
+			[]tracking.PodEvent{tracking.PodCreateEvent, tracking.PodIPAssignedEvent, tracking.PodEvictedEvent, tracking.PodTerminatedEvent, tracking.PodDeleteEvent}),
+		Entry("releases a Pod which finished before it was recorded",
+			nil, with(func(s *observedPodState) { s.Finished = true }), "",
+			[]tracking.PodEvent{tracking.PodCreateEvent, tracking.PodIPAssignedEvent, tracking.PodTerminatedEvent, tracking.PodDeleteEvent}),
+
+		// Pods which have been recorded
+		Entry("doesn't record a Pod whose state hasn't changed",
+			&running, running, "", []tracking.PodEvent{}),
+		Entry("assigns the IPs of a Pod recorded without IPs",
+			&observedPodState{Node: "node-a", Ready: true}, running, "", []tracking.PodEvent{tracking.PodIPAssignedEvent}),
+		Entry("changes the IPs of a Pod",
+			&running, with(func(s *observedPodState) { s.PodIPs = "10.0.0.1,fd00::1" }), "", []tracking.PodEvent{tracking.PodIPChangedEvent}),
+		Entry("doesn't change the IPs of a Pod which lost them",
+			&running, with(func(s *observedPodState) { s.PodIPs = "" }), "", []tracking.PodEvent{}),
+		Entry("updates the network of a Pod whose network status changed",
+			&running, with(func(s *observedPodState) { s.NetworkStatus = `[{"name":"macvlan"}]` }), "", []tracking.PodEvent{tracking.PodNetworkUpdateEvent}),
+		Entry("changes the Services of a Pod",
+			&running, with(func(s *observedPodState) { s.Services = "web" }), "", []tracking.PodEvent{tracking.PodServicesChangedEvent}),
+		Entry("records a Pod becoming ready",
+			&observedPodState{PodIPs: "10.0.0.1", Node: "node-a"}, running, "", []tracking.PodEvent{tracking.PodReadyEvent}),
+		Entry("doesn't record a Pod becoming unready",
+			&running, with(func(s *observedPodState) { s.Ready = false }), "", []tracking.PodEvent{}),
+		Entry("evicts a Pod",
+			&running, with(func(s *observedPodState) { s.Evicted = true }), "", []tracking.PodEvent{tracking.PodEvictedEvent}),
+		Entry("releases the IPs of a Pod which finished",
+			&running, with(func(s *observedPodState) { s.Ready, s.Finished = false, true }), "",
+			[]tracking.PodEvent{tracking.PodTerminatedEvent, tracking.PodDeleteEvent}),
+		Entry("doesn't release the IPs of a finished Pod again",
+			&observedPodState{PodIPs: "10.0.0.1", Finished: true}, observedPodState{PodIPs: "10.0.0.1", Finished: true}, "", []tracking.PodEvent{}),
+		Entry("ignores the Node of a replaced Pod once the Pod has been recorded",
+			&running, running, "node-b", []tracking.PodEvent{}),
+		Entry("records every change of a Pod in order",
+			&observedPodState{Node: "node-a"},
+			observedPodState{PodIPs: "10.0.0.1", Node: "node-a", NetworkStatus: "[]", Services: "web", Ready: true, Evicted: true, Finished: true}, "",
+			[]tracking.PodEvent{
+				tracking.PodIPAssignedEvent, tracking.PodNetworkUpdateEvent, tracking.PodServicesChangedEvent, tracking.PodReadyEvent,
+				tracking.PodEvictedEvent, tracking.PodTerminatedEvent, tracking.PodDeleteEvent,
+			}),
+	)
+})
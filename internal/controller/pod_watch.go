@@ -0,0 +1,290 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1 "github.com/gccloudone-aurora/podtracker/api/v1"
+	"github.com/gccloudone-aurora/podtracker/internal/config"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+const (
+	// trackerRegistrationTimeout is how long the startup pass waits for the existing PodTrackers to be registered before recording vanished Pods
+	trackerRegistrationTimeout = time.Minute
+	// vanishedPodsRetryInterval is the period in which the startup pass retries recording the vanished Pods it failed to record
+	vanishedPodsRetryInterval = time.Minute
+)
+
+// deletedPod is the final state of a Pod which has been deleted, as observed from a watch event
+type deletedPod struct {
+	Pod *corev1.Pod
+	// StateUnknown is true if the deletion was missed by the watch and the final state of the Pod is its last known state
+	StateUnknown bool
+}
+
+// deletedPods holds the deleted Pods which are waiting to be recorded, by name
+type deletedPods struct {
+	mu   sync.Mutex
+	pods map[types.NamespacedName]deletedPod
+}
+
+// Push holds the provided deleted Pod until it is recorded
+func (d *deletedPods) Push(pod deletedPod) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.pods == nil {
+		d.pods = map[types.NamespacedName]deletedPod{}
+	}
+	d.pods[types.NamespacedName{Name: pod.Pod.GetName(), Namespace: pod.Pod.GetNamespace()}] = pod
+}
+
+// Pop returns and removes the deleted Pod with the provided name, if any
+func (d *deletedPods) Pop(name types.NamespacedName) (deletedPod, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pod, ok := d.pods[name]
+	delete(d.pods, name)
+	return pod, ok
+}
+
+// usesFinalizer returns true if any of the PodTrackers tracking the Pod adds a finalizer to it
+func (r *PodReconciler) usesFinalizer(pod *corev1.Pod, namespaceLabels map[string]string) bool {
+	// aquire the cached config
+	r.PodTrackerConfig.Lock()
+	defer r.PodTrackerConfig.Unlock()
+
+	for _, pt := range r.PodTrackerConfig.Items {
+		if pt.TracksPod(pod, namespaceLabels) && pt.UsesFinalizer(r.DefaultTrackingMode) {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueueDeletedPod enqueues the Pods which have been recorded without a finalizer when they are deleted, holding their final state
+// so that their deletion can be recorded once they are gone
+func (r *PodReconciler) enqueueDeletedPod(ctx context.Context, de event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	pod, ok := de.Object.(*corev1.Pod)
+	if !ok {
+		return
+	}
+
+	if _, observed := r.observed.Get(pod.GetUID()); !observed {
+		// the Pod has either never been recorded, or its deletion or release has already been recorded
+		if r.Store != nil {
+			r.Store.Remove(pod.GetUID())
+		}
+		return
+	}
+
+	r.deleted.Push(deletedPod{Pod: pod, StateUnknown: de.DeleteStateUnknown})
+	q.Add(reconcile.Request{NamespacedName: types.NamespacedName{Name: pod.GetName(), Namespace: pod.GetNamespace()}})
+}
+
+// recordDeletedPod records the deletion of the Pod with the provided name if it has been observed from a watch event.
+// If recording fails, the deleted Pod is held again so that it is retried
+func (r *PodReconciler) recordDeletedPod(ctx context.Context, name types.NamespacedName) error {
+	deleted, ok := r.deleted.Pop(name)
+	if !ok {
+		return nil
+	}
+	if _, observed := r.observed.Get(deleted.Pod.GetUID()); !observed {
+		// the deletion has been recorded since the Pod was deleted (e.g. when its finalizer was removed)
+		return nil
+	}
+
+	if errs := r.writePodInfo(ctx, &tracking.PodInfoConfig{
+		Pod:                  deleted.Pod,
+		Node:                 r.nodeOrEmpty(ctx, deleted.Pod.Spec.NodeName),
+		Event:                tracking.PodDeleteEvent,
+		Owner:                r.resolveOwner(ctx, deleted.Pod),
+		DeletionStateUnknown: deleted.StateUnknown,
+	}); len(errs) > 0 {
+		r.deleted.Push(deleted)
+		return errors.Join(errs...)
+	}
+
+	r.observed.Forget(deleted.Pod.GetUID())
+	if r.Store != nil {
+		r.Store.Remove(deleted.Pod.GetUID())
+	}
+	return nil
+}
+
+// nodeOrEmpty returns the Node with the provided name, or an empty Node if it can't be found (e.g. because it has been removed)
+func (r *PodReconciler) nodeOrEmpty(ctx context.Context, name string) *corev1.Node {
+	node := &corev1.Node{}
+	if name == "" {
+		return node
+	}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: name}, node); err != nil {
+		return &corev1.Node{}
+	}
+	return node
+}
+
+// recordVanishedPods records the deletion of the Pods which were recorded without a finalizer and were deleted while the controller was down.
+// It runs once the controller starts, and retries the Pods it fails to record until it succeeds or the provided context is cancelled
+func (r *PodReconciler) recordVanishedPods(ctx context.Context) error {
+	rl := log.FromContext(ctx).WithName("vanished-pods")
+
+	select {
+	case <-r.Store.Loaded():
+	case <-ctx.Done():
+		return nil
+	}
+	if !r.cache.WaitForCacheSync(ctx) {
+		return nil
+	}
+	waitForPodTrackers(ctx, r.Client, r.PodTrackerConfig)
+
+	for {
+		failed, err := r.recordVanishedPodsOnce(ctx)
+		if err != nil {
+			rl.Error(err, "unable to record the deletion of pods that vanished while the controller was down. will try again later", "pods", failed)
+		} else {
+			rl.Info("recorded the deletion of pods that vanished while the controller was down")
+			return nil
+		}
+
+		select {
+		case <-time.After(vanishedPodsRetryInterval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// recordVanishedPodsOnce records the deletion of every remembered Pod which doesn't exist anymore, returning the number of Pods it failed to record
+func (r *PodReconciler) recordVanishedPodsOnce(ctx context.Context) (int, error) {
+	pods := &corev1.PodList{}
+	if err := r.Client.List(ctx, pods); err != nil {
+		return 0, err
+	}
+	existing := make(map[types.UID]bool, len(pods.Items))
+	for _, pod := range pods.Items {
+		existing[pod.GetUID()] = true
+	}
+
+	var errs []error
+	failed := 0
+	for uid, record := range r.Store.Records() {
+		if existing[uid] {
+			continue
+		}
+		if record.Released {
+			// the release of the Pod's IPs has already been recorded
+			r.Store.Remove(uid)
+			continue
+		}
+
+		pod := record.Pod(uid)
+		if podErrs := r.writePodInfo(ctx, &tracking.PodInfoConfig{
+			Pod:                  pod,
+			Node:                 r.nodeOrEmpty(ctx, pod.Spec.NodeName),
+			Event:                tracking.PodDeleteEvent,
+			DeletionStateUnknown: true,
+		}); len(podErrs) > 0 {
+			errs = append(errs, podErrs...)
+			failed++
+			continue
+		}
+		r.Store.Remove(uid)
+	}
+
+	return failed, errors.Join(errs...)
+}
+
+// waitForPodTrackers waits until every existing PodTracker has been registered in the provided config, so that the objects recorded
+// right after the controller starts are recorded by every PodTracker tracking them
+func waitForPodTrackers(ctx context.Context, c client.Reader, cfg *config.CachedPodTrackerConfig) {
+	ctx, cancel := context.WithTimeout(ctx, trackerRegistrationTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		podTrackers := &v1.PodTrackerList{}
+		if err := c.List(ctx, podTrackers); err == nil && podTrackersRegistered(cfg, podTrackers) {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.FromContext(ctx).Info("timed out waiting for PodTrackers to be registered")
+			return
+		}
+	}
+}
+
+// podTrackersRegisteredChannel returns a channel which is closed once the existing PodTrackers have been registered in the provided config
+// after the manager starts (or once registration times out)
+func podTrackersRegisteredChannel(mgr manager.Manager, cfg *config.CachedPodTrackerConfig) (<-chan struct{}, error) {
+	registered := make(chan struct{})
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		if mgr.GetCache().WaitForCacheSync(ctx) {
+			waitForPodTrackers(ctx, mgr.GetClient(), cfg)
+		}
+		close(registered)
+		return nil
+	})); err != nil {
+		return nil, err
+	}
+	return registered, nil
+}
+
+// podTrackersRegistered returns true if all the provided PodTrackers have been registered in the provided config
+func podTrackersRegistered(cfg *config.CachedPodTrackerConfig, podTrackers *v1.PodTrackerList) bool {
+	// aquire the cached config
+	cfg.Lock()
+	defer cfg.Unlock()
+
+	for i := range podTrackers.Items {
+		if contains, _ := cfg.Contains(&podTrackers.Items[i]); !contains {
+			return false
+		}
+	}
+	return true
+}
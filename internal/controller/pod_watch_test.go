@@ -0,0 +1,190 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	networkingv1 "github.com/gccloudone-aurora/podtracker/api/v1"
+	"github.com/gccloudone-aurora/podtracker/internal/config"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+var _ = Describe("PodReconciler in the Watch tracking mode", func() {
+	var (
+		ctx       context.Context
+		namespace string
+		node      string
+		plugin    *recordingPlugin
+		address   string
+	)
+
+	setup := func(mgr ctrl.Manager, podTrackers *config.CachedPodTrackerConfig, _ *PodTrackerReconciler) error {
+		return (&PodReconciler{
+			Client:           mgr.GetClient(),
+			Scheme:           mgr.GetScheme(),
+			PodTrackerConfig: podTrackers,
+		}).SetupWithManager(mgr)
+	}
+
+	watchPods := func(spec *networkingv1.PodTrackerSpec) {
+		spec.NSToWatch = []string{namespace}
+		spec.TrackingMode = networkingv1.WatchTrackingMode
+	}
+
+	// events returns the events recorded for the Pod with the provided name
+	events := func(name string) func() []tracking.PodEvent {
+		return func() []tracking.PodEvent {
+			recorded := []tracking.PodEvent{}
+			for _, info := range recordsOf[*tracking.PodInfo](plugin) {
+				if info.Namespace == namespace && info.Name == name {
+					recorded = append(recorded, info.Event)
+				}
+			}
+			return recorded
+		}
+	}
+
+	BeforeEach(func() {
+		requireTestEnv()
+		ctx = context.Background()
+		namespace = createNamespace(ctx)
+		node = createNode(ctx, "192.168.0.20")
+		plugin, address = servePlugin()
+	})
+
+	It("records the Pods which exist when the controller starts", func() {
+		createRunningPod(ctx, namespace, "existing", node, "10.20.0.1")
+		createPodTracker(ctx, newPodTracker(address, watchPods))
+		startManager(setup)
+
+		Eventually(events("existing")).WithTimeout(30 * time.Second).Should(ConsistOf(tracking.PodCreateEvent))
+	})
+
+	It("records the deletion of Pods from watch events, without a finalizer", func() {
+		createPodTracker(ctx, newPodTracker(address, watchPods))
+		startManager(setup)
+
+		pod := createRunningPod(ctx, namespace, "deleted", node, "10.20.0.2")
+		Eventually(events("deleted")).WithTimeout(30 * time.Second).Should(ConsistOf(tracking.PodCreateEvent))
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), pod)).To(Succeed())
+		Expect(pod.GetFinalizers()).To(BeEmpty())
+
+		Expect(k8sClient.Delete(ctx, pod, client.GracePeriodSeconds(0))).To(Succeed())
+		Eventually(events("deleted")).WithTimeout(30 * time.Second).Should(Equal([]tracking.PodEvent{tracking.PodCreateEvent, tracking.PodDeleteEvent}))
+	})
+})
+
+var _ = Describe("PodReconciler recording deleted Pods", func() {
+	var (
+		ctx     context.Context
+		pod     *corev1.Pod
+		name    types.NamespacedName
+		r       *PodReconciler
+		written *recordingWriter
+	)
+
+	deletes := func() int {
+		count := 0
+		for _, info := range recordsOf[*tracking.PodInfo](written) {
+			if info.Event == tracking.PodDeleteEvent {
+				count++
+			}
+		}
+		return count
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		pod = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "deleted", Namespace: "apps", UID: "deleted-uid"},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "10.20.0.2", PodIPs: []corev1.PodIP{{IP: "10.20.0.2"}}},
+		}
+		name = client.ObjectKeyFromObject(pod)
+
+		pt := &networkingv1.PodTracker{
+			ObjectMeta: metav1.ObjectMeta{Name: "watch"},
+			Spec:       networkingv1.PodTrackerSpec{NSToWatch: []string{"apps"}, TrackingMode: networkingv1.WatchTrackingMode},
+		}
+		podTrackers, writers := registerPodTrackers(pt)
+		written = writers[pt.GetName()]
+		r = &PodReconciler{
+			Client:           fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps"}}).Build(),
+			PodTrackerConfig: podTrackers,
+		}
+
+		r.observed.Set(pod, newObservedPodState(pod))
+		r.deleted.Push(deletedPod{Pod: pod})
+	})
+
+	It("records the deletion of an observed Pod once", func() {
+		Expect(r.recordDeletedPod(ctx, name)).To(Succeed())
+		Expect(deletes()).To(Equal(1))
+		_, observed := r.observed.Get(pod.GetUID())
+		Expect(observed).To(BeFalse())
+
+		// e.g. a second delete event for the same Pod
+		r.deleted.Push(deletedPod{Pod: pod})
+		Expect(r.recordDeletedPod(ctx, name)).To(Succeed())
+		Expect(deletes()).To(Equal(1))
+	})
+
+	It("does not record the deletion again once it has been recorded when the finalizer was removed", func() {
+		r.observed.Forget(pod.GetUID())
+
+		Expect(r.recordDeletedPod(ctx, name)).To(Succeed())
+		Expect(deletes()).To(BeZero())
+	})
+
+	It("holds the deleted Pod again if recording fails, so that it is retried", func() {
+		written.err = errors.New("backend unavailable")
+		Expect(r.recordDeletedPod(ctx, name)).NotTo(Succeed())
+
+		written.err = nil
+		Expect(r.recordDeletedPod(ctx, name)).To(Succeed())
+		Expect(deletes()).To(Equal(1))
+	})
+
+	It("ignores Pods whose deletion hasn't been observed", func() {
+		Expect(r.recordDeletedPod(ctx, types.NamespacedName{Name: "other", Namespace: "apps"})).To(Succeed())
+		Expect(deletes()).To(BeZero())
+	})
+})
@@ -29,19 +29,25 @@ package controller
 
 import (
 	"context"
+	"errors"
 
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	v1 "github.com/gccloudone-aurora/podtracker/api/v1"
 	"github.com/gccloudone-aurora/podtracker/internal/config"
 	"github.com/gccloudone-aurora/podtracker/internal/finalizer"
+	"github.com/gccloudone-aurora/podtracker/internal/writer"
 )
 
 // PodTrackerReconciler reconciles a PodTracker object
@@ -49,11 +55,21 @@ type PodTrackerReconciler struct {
 	client.Client
 	Scheme           *runtime.Scheme
 	PodTrackerConfig *config.CachedPodTrackerConfig
+
+	// Namespace is the namespace the controller runs in. Secrets referenced by PodTracker writer configurations are looked up in this namespace
+	Namespace string
+	// Secrets resolves the Secrets referenced by PodTracker writer configurations
+	Secrets writer.SecretResolver
+	// Snapshots records a snapshot of the Pods tracked by a PodTracker when it is first registered. Snapshots are not recorded if nil
+	Snapshots SnapshotRequester
+	// SnapshotOnStartup also records a snapshot of the Pods tracked by the existing PodTrackers when the controller starts
+	SnapshotOnStartup bool
 }
 
 //+kubebuilder:rbac:groups=networking.ssc-spc.gc.ca,resources=podtrackers,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=networking.ssc-spc.gc.ca,resources=podtrackers/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=networking.ssc-spc.gc.ca,resources=podtrackers/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",namespace=system,resources=secrets,verbs=get;list;watch
 
 func removePodTrackerAtIndex(podTrackerItems []v1.PodTracker, index int) []v1.PodTracker {
 	podTrackerItems[index] = podTrackerItems[len(podTrackerItems)-1]
@@ -64,10 +80,17 @@ func removePodTrackerAtIndex(podTrackerItems []v1.PodTracker, index int) []v1.Po
 func (r *PodTrackerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	rl := log.FromContext(ctx)
 
-	// aquire the cached config
-	r.PodTrackerConfig.Lock()
-	defer r.PodTrackerConfig.Unlock()
+	// writers which have been replaced or unregistered are closed once the writes in progress through them are done,
+	// so that flushing them does not block writes through the new writers
+	var retired config.RetiredWriters
+	defer func() {
+		if errs := retired.Close(); len(errs) > 0 {
+			rl.Error(errors.Join(errs...), "unable to cleanly close writers", "name", req.Name)
+		}
+	}()
 
+	// NOTE: the cached config is only locked while it is updated, so that the API calls and the writers being built (which may read Secrets
+	// or dial plugins) don't hold up the other controllers. Requests for the same PodTracker are never reconciled concurrently
 	podTracker := &v1.PodTracker{}
 	if err := r.Client.Get(ctx, req.NamespacedName, podTracker); err != nil {
 		if apierrors.IsNotFound(err) {
@@ -83,8 +106,10 @@ func (r *PodTrackerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		// error getting PodTracker from API server - return and requeue
 		return ctrl.Result{}, err
 	}
+	// the key patterns of the PodTracker are compiled before it is registered, rather than for every record it projects
+	podTracker.CompilePatterns()
 
-	if contains, index := r.PodTrackerConfig.Contains(podTracker); contains {
+	if r.registered(podTracker) {
 		if !podTracker.ObjectMeta.DeletionTimestamp.IsZero() {
 			rl.V(2).Info(
 				"PodTracker is queued for deletion",
@@ -102,8 +127,13 @@ func (r *PodTrackerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 				return ctrl.Result{}, err
 			}
 
-			// remove the PodTracker configuration from the in-memory store
-			r.PodTrackerConfig.Items = removePodTrackerAtIndex(r.PodTrackerConfig.Items, index)
+			// remove the PodTracker configuration and its writers from the in-memory store
+			r.PodTrackerConfig.Lock()
+			if contains, index := r.PodTrackerConfig.Contains(podTracker); contains {
+				r.PodTrackerConfig.Items = removePodTrackerAtIndex(r.PodTrackerConfig.Items, index)
+			}
+			retired = r.PodTrackerConfig.RemoveWriters(podTracker.GetName())
+			r.PodTrackerConfig.Unlock()
 			rl.Info(
 				"PodTracker resource has been deleted",
 				"name", podTracker.GetName(),
@@ -113,8 +143,24 @@ func (r *PodTrackerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			return ctrl.Result{}, nil
 		}
 
-		// update the in-memory store with the new PodTracker configuration
-		r.PodTrackerConfig.Items[index] = *podTracker
+		// build the writers for the new configuration before swapping it in, so that the previous writers keep being used if this fails
+		writers, err := podTracker.GetWriters(ctx, r.Secrets)
+		if err != nil {
+			// error building the writers - return and requeue
+			return ctrl.Result{}, err
+		}
+
+		// update the in-memory store with the new PodTracker configuration and writers
+		// (hash chains of the previous writers are continued by the new writers, if integrity is enabled)
+		r.PodTrackerConfig.Lock()
+		previous, _ := r.PodTrackerConfig.WritersFor(podTracker.GetName())
+		writer.ContinueChains(writers, previous)
+		if contains, index := r.PodTrackerConfig.Contains(podTracker); contains {
+			r.PodTrackerConfig.Items[index] = *podTracker
+		}
+		retired = r.PodTrackerConfig.SetWriters(podTracker.GetName(), writers)
+		r.PodTrackerConfig.NotifyRegistered(podTracker)
+		r.PodTrackerConfig.Unlock()
 		rl.Info(
 			"PodTracker resource has been updated",
 			"name", podTracker.GetName(),
@@ -126,7 +172,9 @@ func (r *PodTrackerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 
 	// add a finalizer to the PodTracker so that we can update the in-memory store prior to deletion
-	if !controllerutil.ContainsFinalizer(podTracker, finalizer.POD_TRACKER_FINALIZER_NAME) {
+	// NOTE: PodTrackers without the finalizer are registered for the first time, rather than registered again after a controller restart
+	firstRegistration := !controllerutil.ContainsFinalizer(podTracker, finalizer.POD_TRACKER_FINALIZER_NAME)
+	if firstRegistration {
 		controllerutil.AddFinalizer(podTracker, finalizer.POD_TRACKER_FINALIZER_NAME)
 		if err := r.Update(ctx, podTracker); err != nil {
 			if apierrors.IsNotFound(err) {
@@ -138,9 +186,28 @@ func (r *PodTrackerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			return ctrl.Result{}, err
 		}
 	}
+	writers, writersErr := podTracker.GetWriters(ctx, r.Secrets)
 
 	// add the new PodTracker configuration to the in-memory store
+	// NOTE: the PodTracker is registered even if its writers can't be built so that the Pods it tracks
+	// are retried (rather than silently ignored) until the writers become available
+	r.PodTrackerConfig.Lock()
 	r.PodTrackerConfig.Items = append(r.PodTrackerConfig.Items, *podTracker)
+	if writersErr == nil {
+		retired = r.PodTrackerConfig.SetWriters(podTracker.GetName(), writers)
+		// the objects which existed before the PodTracker was registered are reconciled against it (e.g. the Services it tracks)
+		r.PodTrackerConfig.NotifyRegistered(podTracker)
+	}
+	r.PodTrackerConfig.Unlock()
+
+	if r.Snapshots != nil && (firstRegistration || r.SnapshotOnStartup) {
+		// record a baseline of the Pods which already exist, as they are otherwise only recorded when their state changes
+		r.Snapshots.RequestSnapshot(podTracker.GetName())
+	}
+	if writersErr != nil {
+		// error building the writers - return and requeue
+		return ctrl.Result{}, writersErr
+	}
 	rl.Info(
 		"New PodTracker resource has been registered",
 		"name", podTracker.GetName(),
@@ -151,6 +218,39 @@ func (r *PodTrackerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	return ctrl.Result{}, nil
 }
 
+// registered returns true if the provided PodTracker has been registered in the cached config
+func (r *PodTrackerReconciler) registered(pt *v1.PodTracker) bool {
+	// aquire the cached config
+	r.PodTrackerConfig.Lock()
+	defer r.PodTrackerConfig.Unlock()
+
+	contains, _ := r.PodTrackerConfig.Contains(pt)
+	return contains
+}
+
+// enqueueReferencingPodTrackers enqueues every registered PodTracker whose writers reference the provided Secret,
+// so that their writers pick up rotated credentials
+func (r *PodTrackerReconciler) enqueueReferencingPodTrackers(ctx context.Context, obj client.Object) []reconcile.Request {
+	if obj.GetNamespace() != r.Namespace {
+		return []reconcile.Request{}
+	}
+
+	// aquire the cached config
+	r.PodTrackerConfig.Lock()
+	defer r.PodTrackerConfig.Unlock()
+
+	requests := []reconcile.Request{}
+	for _, pt := range r.PodTrackerConfig.Items {
+		if pt.ReferencesSecret(obj.GetName()) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: pt.GetName()},
+			})
+		}
+	}
+
+	return requests
+}
+
 // SetupWithManager sets up the controller with the Controller Manager.
 func (r *PodTrackerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
@@ -159,5 +259,10 @@ func (r *PodTrackerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			&v1.PodTracker{},
 			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
 		).
+		Watches(
+			&corev1.Secret{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueReferencingPodTrackers),
+			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
+		).
 		Complete(r)
 }
@@ -0,0 +1,297 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkingv1 "github.com/gccloudone-aurora/podtracker/api/v1"
+	"github.com/gccloudone-aurora/podtracker/internal/config"
+	"github.com/gccloudone-aurora/podtracker/internal/finalizer"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+	"github.com/gccloudone-aurora/podtracker/internal/writer"
+)
+
+// closeRecordingWriter is a BackendWriter which remembers whether it has been closed
+type closeRecordingWriter struct {
+	closed bool
+}
+
+func (w *closeRecordingWriter) Write(tracking.Record) error { return nil }
+
+func (w *closeRecordingWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+// lockCheckingResolver is a writer.SecretResolver which remembers whether the cached config was locked while a Secret was resolved
+type lockCheckingResolver struct {
+	podTrackers *config.CachedPodTrackerConfig
+	locked      bool
+}
+
+func (r *lockCheckingResolver) ResolveSecret(context.Context, writer.SecretKeySelector) ([]byte, error) {
+	if r.podTrackers.TryLock() {
+		r.podTrackers.Unlock()
+	} else {
+		r.locked = true
+	}
+	return nil, errors.New("secret not found")
+}
+
+// valueRecordingResolver is a writer.SecretResolver which remembers the values it resolved
+type valueRecordingResolver struct {
+	writer.SecretResolver
+	values []string
+}
+
+func (r *valueRecordingResolver) ResolveSecret(ctx context.Context, ref writer.SecretKeySelector) ([]byte, error) {
+	value, err := r.SecretResolver.ResolveSecret(ctx, ref)
+	if err == nil {
+		r.values = append(r.values, string(value))
+	}
+	return value, err
+}
+
+var _ = Describe("PodTrackerReconciler", func() {
+	var (
+		ctx         context.Context
+		pt          *networkingv1.PodTracker
+		previous    *closeRecordingWriter
+		podTrackers *config.CachedPodTrackerConfig
+	)
+
+	reconcile := func() {
+		r := &PodTrackerReconciler{
+			Client:           fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(pt).Build(),
+			Scheme:           scheme.Scheme,
+			PodTrackerConfig: podTrackers,
+		}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: pt.GetName()}})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		pt = &networkingv1.PodTracker{
+			ObjectMeta: metav1.ObjectMeta{Name: "podtracker", Finalizers: []string{finalizer.POD_TRACKER_FINALIZER_NAME}},
+			Spec: networkingv1.PodTrackerSpec{
+				NSToWatch:           []string{"default"},
+				BackendWriterConfig: writer.BackendWriterConfig{Stdout: &writer.StdoutConfig{Enabled: true}},
+			},
+		}
+
+		// the PodTracker is registered with writers built for its previous configuration
+		previous = &closeRecordingWriter{}
+		podTrackers = &config.CachedPodTrackerConfig{}
+		podTrackers.Items = append(podTrackers.Items, *pt.DeepCopy())
+		podTrackers.SetWriters(pt.GetName(), []writer.BackendWriter{previous})
+	})
+
+	It("swaps in the writers of an updated PodTracker and closes the previous writers", func() {
+		pt.Spec.NSToWatch = []string{"default", "kube-system"}
+		reconcile()
+
+		Expect(previous.closed).To(BeTrue())
+		writers, ok := podTrackers.WritersFor(pt.GetName())
+		Expect(ok).To(BeTrue())
+		Expect(writers).To(HaveLen(1))
+		Expect(writers[0]).To(BeAssignableToTypeOf(&writer.StdoutWriter{}))
+		Expect(podTrackers.Items).To(HaveLen(1))
+		Expect(podTrackers.Items[0].Spec.NSToWatch).To(Equal([]string{"default", "kube-system"}))
+	})
+
+	It("keeps the previous writers open until they are replaced", func() {
+		pt.Spec.BackendWriterConfig = writer.BackendWriterConfig{
+			Plugins: []writer.PluginConfig{{
+				Name:    "unresolvable",
+				Enabled: true,
+				Address: "unix:///nonexistent.sock",
+				Token:   &writer.SecretKeySelector{Name: "missing", Key: "token"},
+			}},
+		}
+		r := &PodTrackerReconciler{
+			Client:           fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(pt).Build(),
+			Scheme:           scheme.Scheme,
+			PodTrackerConfig: podTrackers,
+			Secrets:          &config.SecretResolver{Reader: fake.NewClientBuilder().Build(), Namespace: "podtracker-system"},
+		}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: pt.GetName()}})
+		Expect(err).To(HaveOccurred())
+
+		Expect(previous.closed).To(BeFalse())
+		writers, ok := podTrackers.WritersFor(pt.GetName())
+		Expect(ok).To(BeTrue())
+		Expect(writers).To(ConsistOf(previous))
+	})
+
+	It("unregisters and closes the writers of a deleted PodTracker", func() {
+		now := metav1.Now()
+		pt.SetDeletionTimestamp(&now)
+		reconcile()
+
+		Expect(previous.closed).To(BeTrue())
+		_, ok := podTrackers.WritersFor(pt.GetName())
+		Expect(ok).To(BeFalse())
+		Expect(podTrackers.Items).To(BeEmpty())
+	})
+
+	It("builds writers without holding the cached config", func() {
+		pt.Spec.BackendWriterConfig = writer.BackendWriterConfig{
+			Plugins: []writer.PluginConfig{{
+				Name:    "unresolvable",
+				Enabled: true,
+				Address: "unix:///nonexistent.sock",
+				Token:   &writer.SecretKeySelector{Name: "token", Key: "token"},
+			}},
+		}
+		resolver := &lockCheckingResolver{podTrackers: podTrackers}
+		r := &PodTrackerReconciler{
+			Client:           fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(pt).Build(),
+			Scheme:           scheme.Scheme,
+			PodTrackerConfig: podTrackers,
+			Secrets:          resolver,
+		}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: pt.GetName()}})
+		Expect(err).To(HaveOccurred())
+		Expect(resolver.locked).To(BeFalse())
+	})
+
+	It("registers a new PodTracker whose writers can't be built, so that its events are retried", func() {
+		podTrackers = &config.CachedPodTrackerConfig{}
+		pt.Spec.BackendWriterConfig = writer.BackendWriterConfig{
+			Plugins: []writer.PluginConfig{{
+				Name:    "unresolvable",
+				Enabled: true,
+				Address: "unix:///nonexistent.sock",
+				Token:   &writer.SecretKeySelector{Name: "token", Key: "token"},
+			}},
+		}
+		r := &PodTrackerReconciler{
+			Client:           fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(pt).Build(),
+			Scheme:           scheme.Scheme,
+			PodTrackerConfig: podTrackers,
+			Secrets:          &lockCheckingResolver{podTrackers: podTrackers},
+		}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: pt.GetName()}})
+		Expect(err).To(HaveOccurred())
+
+		Expect(podTrackers.Items).To(HaveLen(1))
+		_, ok := podTrackers.WritersFor(pt.GetName())
+		Expect(ok).To(BeFalse())
+	})
+})
+
+var _ = Describe("PodTrackerReconciler Secret rotation", func() {
+	const namespace = "podtracker-system"
+
+	var (
+		ctx         context.Context
+		c           client.Client
+		pt          *networkingv1.PodTracker
+		secret      *corev1.Secret
+		podTrackers *config.CachedPodTrackerConfig
+		r           *PodTrackerReconciler
+		resolver    *valueRecordingResolver
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		pt = &networkingv1.PodTracker{
+			ObjectMeta: metav1.ObjectMeta{Name: "signed", Finalizers: []string{finalizer.POD_TRACKER_FINALIZER_NAME}},
+			Spec: networkingv1.PodTrackerSpec{
+				NSToWatch:           []string{"default"},
+				BackendWriterConfig: writer.BackendWriterConfig{Stdout: &writer.StdoutConfig{Enabled: true}},
+				Integrity:           &writer.IntegrityConfig{Enabled: true, HMACKey: &writer.SecretKeySelector{Name: "integrity", Key: "hmac.key"}},
+			},
+		}
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "integrity", Namespace: namespace},
+			Data:       map[string][]byte{"hmac.key": []byte("first-key")},
+		}
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(pt, secret).Build()
+
+		podTrackers = &config.CachedPodTrackerConfig{}
+		resolver = &valueRecordingResolver{SecretResolver: &config.SecretResolver{Reader: c, Namespace: namespace}}
+		r = &PodTrackerReconciler{
+			Client:           c,
+			Scheme:           scheme.Scheme,
+			PodTrackerConfig: podTrackers,
+			Namespace:        namespace,
+			Secrets:          resolver,
+		}
+	})
+
+	reconcilePodTracker := func() {
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: pt.GetName()}})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	It("rebuilds the writers of a PodTracker with the rotated value of a Secret it references", func() {
+		reconcilePodTracker()
+		first, ok := podTrackers.WritersFor(pt.GetName())
+		Expect(ok).To(BeTrue())
+
+		secret.Data["hmac.key"] = []byte("rotated-key")
+		Expect(c.Update(ctx, secret)).To(Succeed())
+		Expect(r.enqueueReferencingPodTrackers(ctx, secret)).To(ConsistOf(
+			reconcile.Request{NamespacedName: types.NamespacedName{Name: pt.GetName()}},
+		))
+		reconcilePodTracker()
+
+		Expect(resolver.values).To(Equal([]string{"first-key", "rotated-key"}))
+		rotated, ok := podTrackers.WritersFor(pt.GetName())
+		Expect(ok).To(BeTrue())
+		Expect(rotated).To(HaveLen(1))
+		Expect(rotated[0]).NotTo(BeIdenticalTo(first[0]))
+	})
+
+	It("doesn't enqueue PodTrackers for the Secrets they don't reference", func() {
+		reconcilePodTracker()
+
+		unrelated := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: namespace}}
+		Expect(r.enqueueReferencingPodTrackers(ctx, unrelated)).To(BeEmpty())
+
+		// a Secret of the same name in another namespace isn't the referenced Secret
+		elsewhere := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "integrity", Namespace: "apps"}}
+		Expect(r.enqueueReferencingPodTrackers(ctx, elsewhere)).To(BeEmpty())
+	})
+})
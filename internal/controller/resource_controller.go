@@ -0,0 +1,536 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	v1 "github.com/gccloudone-aurora/podtracker/api/v1"
+	"github.com/gccloudone-aurora/podtracker/internal/config"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+	"github.com/gccloudone-aurora/podtracker/internal/writer"
+)
+
+// ResourceReconciler watches the resources described by the ResourceRules of PodTrackers (`spec.resources`). It reconciles PodTrackers,
+// and starts an informer and a controller (see resourceKindReconciler) for every kind of resource which is not watched yet.
+// NOTE: informers can't be stopped, so the resources of rules which are removed keep being watched (but are no longer recorded) until the controller restarts
+type ResourceReconciler struct {
+	client.Client
+	PodTrackerConfig *config.CachedPodTrackerConfig
+	// Instance identifies the cluster and controller process on every record. Records are not stamped if nil
+	Instance *tracking.Instance
+
+	mu sync.Mutex
+	// kinds are the reconcilers of the kinds of resources being watched
+	kinds map[schema.GroupVersionKind]*resourceKindReconciler
+	// mgr is the manager the reconciler is set up with, which the controllers of the watched kinds are added to
+	mgr ctrl.Manager
+	// registered is closed once the existing PodTrackers have been registered after the controller starts
+	registered <-chan struct{}
+}
+
+// NOTE: the permissions on the resources tracked by PodTrackers can't be known in advance, so they must be granted separately
+// (see rbac.extraRules in the Helm chart)
+
+// Reconcile starts watching the kinds of resources described by the ResourceRules of every PodTracker
+func (r *ResourceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	podTrackers := &v1.PodTrackerList{}
+	if err := r.Client.List(ctx, podTrackers); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	var errs []error
+	for _, pt := range podTrackers.Items {
+		for _, rule := range pt.Spec.Resources {
+			if err := r.watch(ctx, rule.GroupVersionKind()); err != nil {
+				// the kind may not be served (yet), e.g. if the CRD defining it isn't installed - requeue with error
+				errs = append(errs, fmt.Errorf("unable to watch %s for PodTracker %q: %w", rule.GroupVersionKind(), pt.GetName(), err))
+			}
+		}
+	}
+
+	return ctrl.Result{}, errors.Join(errs...)
+}
+
+// watch starts watching the resources of the provided kind, unless they are already watched
+func (r *ResourceReconciler) watch(ctx context.Context, gvk schema.GroupVersionKind) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.kinds[gvk]; ok {
+		return nil
+	}
+	if _, err := r.mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+		return err
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	informer, err := r.mgr.GetCache().GetInformer(ctx, obj, cache.BlockUntilSynced(false))
+	if err != nil {
+		return err
+	}
+
+	kind := &resourceKindReconciler{parent: r, gvk: gvk, cache: r.mgr.GetCache()}
+	c, err := controller.New(resourceControllerName(gvk), r.mgr, controller.Options{Reconciler: kind})
+	if err != nil {
+		return err
+	}
+	// NOTE: created resources are enqueued whether or not they are tracked when the event is received, as the PodTrackers may not be registered yet.
+	// The reconciler only records the resources for the PodTrackers which track them
+	if err := c.Watch(&source.Informer{Informer: informer}, handler.Funcs{
+		CreateFunc: func(ctx context.Context, ce event.CreateEvent, q workqueue.RateLimitingInterface) {
+			q.Add(reconcile.Request{NamespacedName: types.NamespacedName{Name: ce.Object.GetName(), Namespace: ce.Object.GetNamespace()}})
+		},
+		UpdateFunc: func(ctx context.Context, ue event.UpdateEvent, q workqueue.RateLimitingInterface) {
+			if kind.ipsChanged(ctx, ue.ObjectOld, ue.ObjectNew) {
+				q.Add(reconcile.Request{NamespacedName: types.NamespacedName{Name: ue.ObjectNew.GetName(), Namespace: ue.ObjectNew.GetNamespace()}})
+			}
+		},
+		DeleteFunc: func(ctx context.Context, de event.DeleteEvent, q workqueue.RateLimitingInterface) {
+			kind.enqueueDeleted(q, de.Object)
+		},
+	}); err != nil {
+		return err
+	}
+	if err := c.Watch(
+		&source.Channel{Source: r.PodTrackerConfig.Subscribe()},
+		handler.EnqueueRequestsFromMapFunc(kind.enqueueRegistered),
+	); err != nil {
+		return err
+	}
+
+	if r.kinds == nil {
+		r.kinds = map[schema.GroupVersionKind]*resourceKindReconciler{}
+	}
+	r.kinds[gvk] = kind
+	log.FromContext(ctx).Info("watching resources tracked by PodTrackers", "kind", gvk.String())
+	return nil
+}
+
+// resourceControllerName returns the name of the controller of the provided kind of resources, which is unique across the versions of the kind
+func resourceControllerName(gvk schema.GroupVersionKind) string {
+	name := strings.ToLower(gvk.Kind + "." + gvk.Version)
+	if gvk.Group != "" {
+		name += "." + gvk.Group
+	}
+	return fmt.Sprintf("PodTracker-Resource-%s", name)
+}
+
+// SetupWithManager sets up the controller with the Controller Manager.
+func (r *ResourceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	registered, err := podTrackersRegisteredChannel(mgr, r.PodTrackerConfig)
+	if err != nil {
+		return err
+	}
+	r.registered = registered
+	r.mgr = mgr
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("PodTracker-Resources").
+		For(
+			&v1.PodTracker{},
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		Complete(r)
+}
+
+// resourceKey identifies the records of a resource written for a PodTracker
+type resourceKey struct {
+	UID     types.UID
+	Tracker string
+}
+
+// observedResource is a resource as of the last record written for it
+type observedResource struct {
+	// ID is the ID of the resource found by the rule of the PodTracker, which identifies the resource when the release of its IPs is recorded
+	ID  string
+	IPs []tracking.IPAddress
+}
+
+// resourceKindReconciler records the changes of the IPs of the resources of a single kind
+type resourceKindReconciler struct {
+	parent *ResourceReconciler
+	gvk    schema.GroupVersionKind
+	// cache reads the resources of the kind
+	cache client.Reader
+
+	mu sync.Mutex
+	// observed are the resources as of the last record written for them, by PodTracker
+	observed map[resourceKey]observedResource
+	// deleted holds the recorded resources whose deletion has been observed from watch events until their deletion is recorded
+	deleted map[types.NamespacedName]*unstructured.Unstructured
+}
+
+// Reconcile records the changes of the IPs held by a resource, for every PodTracker tracking it
+func (k *resourceKindReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	rl := log.FromContext(ctx)
+
+	// wait until the existing PodTrackers are registered, so that the resources listed when the watch starts are not missed
+	select {
+	case <-k.parent.registered:
+	case <-ctx.Done():
+		return ctrl.Result{}, ctx.Err()
+	}
+
+	// record the release of the IPs of a deleted resource, if its deletion has been observed from a watch event
+	if err := k.recordDeleted(req.NamespacedName); err != nil {
+		// writing to one or more backends failed - return and requeue with error
+		return ctrl.Result{}, err
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(k.gvk)
+	if err := k.cache.Get(ctx, req.NamespacedName, obj); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			rl.V(2).Info(
+				"Request object not found for resource, could have been deleted after reconcile request.",
+				"kind", k.gvk.String(),
+				"name", req.Name,
+				"namespace", req.Namespace,
+			)
+
+			// return and don't requeue
+			return ctrl.Result{}, nil
+		}
+
+		// error getting the resource from the cache - requeue the request
+		return ctrl.Result{}, err
+	}
+	if !obj.GetDeletionTimestamp().IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	namespaceLabels, err := k.parent.PodTrackerConfig.NamespaceLabels(ctx, k.parent.Client, obj.GetNamespace())
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// acquire the PodTrackers tracking the resource, whose writers are written to without holding the lock
+	registrations, release := k.parent.PodTrackerConfig.Acquire(func(pt *v1.PodTracker) bool {
+		_, ok := pt.TracksResource(obj, namespaceLabels)
+		return ok
+	})
+	defer release()
+
+	var errs []error
+	tracked := map[string]bool{}
+	for _, registration := range registrations {
+		pt := registration.PodTracker
+		tracked[pt.GetName()] = true
+		rule, _ := pt.TracksResource(obj, namespaceLabels)
+
+		cfg, err := k.recordConfig(obj, rule, pt.GetName())
+		if err != nil {
+			rl.Error(err, "unable to evaluate the rule of the resource", "kind", k.gvk.String(), "name", obj.GetName(), "podTracker", pt.GetName())
+			continue
+		}
+		if cfg == nil {
+			continue
+		}
+
+		if err := k.write(registration, cfg); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		k.setObserved(resourceKey{UID: obj.GetUID(), Tracker: pt.GetName()}, observedResource{ID: cfg.ResourceID, IPs: cfg.IPs})
+	}
+
+	// the PodTrackers which have recorded the resource but don't track it anymore (e.g. their rule for the kind was removed)
+	// record the release of its IPs
+	if err := k.release(obj, k.observedKeys(func(key resourceKey) bool { return key.UID == obj.GetUID() && !tracked[key.Tracker] })); err != nil {
+		errs = append(errs, err)
+	}
+
+	// returns nil if there are no errors, so the request isn't requeued
+	return ctrl.Result{}, errors.Join(errs...)
+}
+
+// recordConfig returns the record to write for the resource to the named PodTracker, or nil if its IPs haven't changed
+func (k *resourceKindReconciler) recordConfig(obj *unstructured.Unstructured, rule tracking.ResourceRule, tracker string) (*tracking.ResourceRecordConfig, error) {
+	id, err := rule.ID(obj)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := rule.IPs(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tracking.ResourceRecordConfig{Object: obj, Event: tracking.ResourceCreateEvent, ResourceID: id, IPs: ips}
+	previous, observed := k.getObserved(resourceKey{UID: obj.GetUID(), Tracker: tracker})
+	switch {
+	case !observed && len(ips) == 0:
+		// no IPs have been allocated to the resource yet
+		return nil, nil
+	case !observed:
+		return cfg, nil
+	case reflect.DeepEqual(previous.IPs, ips):
+		return nil, nil
+	default:
+		cfg.Event = tracking.ResourceIPChangedEvent
+		cfg.PreviousIPs = previous.IPs
+		return cfg, nil
+	}
+}
+
+// recordDeleted records the release of the IPs of the deleted resource with the provided name, for every PodTracker which recorded it
+func (k *resourceKindReconciler) recordDeleted(name types.NamespacedName) error {
+	k.mu.Lock()
+	deleted, ok := k.deleted[name]
+	delete(k.deleted, name)
+	k.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	if err := k.release(deleted, k.observedKeys(func(key resourceKey) bool { return key.UID == deleted.GetUID() })); err != nil {
+		// hold the resource again so that the PodTrackers which failed to record it are retried
+		k.mu.Lock()
+		k.deleted[name] = deleted
+		k.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// release records the release of the IPs of the resource for the PodTrackers it was recorded for with the provided keys,
+// and forgets the keys once the release has been recorded
+func (k *resourceKindReconciler) release(obj *unstructured.Unstructured, keys []resourceKey) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	names := map[string]bool{}
+	for _, key := range keys {
+		names[key.Tracker] = true
+	}
+
+	// acquire the PodTrackers which recorded the resource, whose writers are written to without holding the lock
+	registrations, release := k.parent.PodTrackerConfig.Acquire(func(pt *v1.PodTracker) bool { return names[pt.GetName()] })
+	defer release()
+
+	registered := map[string]config.Registration{}
+	for _, registration := range registrations {
+		registered[registration.PodTracker.GetName()] = registration
+	}
+
+	var errs []error
+	for _, key := range keys {
+		previous, _ := k.getObserved(key)
+		if registration, ok := registered[key.Tracker]; ok {
+			cfg := &tracking.ResourceRecordConfig{Object: obj, Event: tracking.ResourceDeleteEvent, ResourceID: previous.ID, IPs: previous.IPs}
+			if err := k.write(registration, cfg); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		// the release has been recorded, or the PodTracker has been removed
+		k.forget(key)
+	}
+	return errors.Join(errs...)
+}
+
+// write writes the described ResourceRecord to the writers of the acquired PodTracker
+func (k *resourceKindReconciler) write(registration config.Registration, cfg *tracking.ResourceRecordConfig) error {
+	if !registration.Ready {
+		// the writers for this PodTracker could not be built - fail so that the event is retried once they are
+		return fmt.Errorf("no writers are available for PodTracker %q", registration.PodTracker.GetName())
+	}
+
+	record := registration.PodTracker.ProjectResourceRecord(tracking.NewResourceRecord(cfg))
+	k.parent.Instance.Stamp(record)
+	return errors.Join(writer.WriteToAll(registration.Writers, record)...)
+}
+
+// trackers returns the PodTrackers tracking the provided resource, along with their rules
+func (k *resourceKindReconciler) trackers(ctx context.Context, obj client.Object) (map[string]tracking.ResourceRule, error) {
+	namespaceLabels, err := k.parent.PodTrackerConfig.NamespaceLabels(ctx, k.parent.Client, obj.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+
+	// aquire the cached config
+	k.parent.PodTrackerConfig.Lock()
+	defer k.parent.PodTrackerConfig.Unlock()
+
+	rules := map[string]tracking.ResourceRule{}
+	for _, pt := range k.parent.PodTrackerConfig.Items {
+		if rule, ok := pt.TracksResource(obj, namespaceLabels); ok {
+			rules[pt.GetName()] = rule
+		}
+	}
+	return rules, nil
+}
+
+// ipsChanged returns true if the IPs found by the rule of any PodTracker tracking the resource differ between its old and new state.
+// The resource is assumed to have changed if the PodTrackers tracking it can't be determined, as the reconciler only records the changes of tracked resources
+func (k *resourceKindReconciler) ipsChanged(ctx context.Context, oldObj, newObj client.Object) bool {
+	oldU, ok := oldObj.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+	newU, ok := newObj.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+
+	rules, err := k.trackers(ctx, newObj)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "unable to get the Namespace of resource", "kind", k.gvk.String(), "name", newObj.GetName(), "namespace", newObj.GetNamespace())
+		return true
+	}
+	for _, rule := range rules {
+		oldIPs, oldErr := rule.IPs(oldU)
+		newIPs, newErr := rule.IPs(newU)
+		if oldErr != nil || newErr != nil || !reflect.DeepEqual(oldIPs, newIPs) {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueueRegistered enqueues every cached resource of the kind when a PodTracker with a rule for the kind has been registered or updated,
+// as the resources which existed before are otherwise only recorded for the PodTracker once their IPs change
+func (k *resourceKindReconciler) enqueueRegistered(ctx context.Context, obj client.Object) []reconcile.Request {
+	rl := log.FromContext(ctx)
+
+	pt, ok := obj.(*v1.PodTracker)
+	if !ok {
+		return []reconcile.Request{}
+	}
+	hasRule := false
+	for _, rule := range pt.Spec.Resources {
+		if rule.GroupVersionKind() == k.gvk {
+			hasRule = true
+			break
+		}
+	}
+	// the resources are enqueued for the PodTrackers which have recorded them too, so that the release of their IPs is recorded once they aren't tracked anymore
+	recorded := len(k.observedKeys(func(key resourceKey) bool { return key.Tracker == pt.GetName() })) > 0
+	if !hasRule && !recorded {
+		return []reconcile.Request{}
+	}
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(k.gvk.GroupVersion().WithKind(k.gvk.Kind + "List"))
+	if err := k.cache.List(ctx, list); err != nil {
+		rl.Error(err, "unable to list the resources tracked by PodTracker", "kind", k.gvk.String(), "podtracker", pt.GetName())
+		return []reconcile.Request{}
+	}
+
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, item := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: item.GetName(), Namespace: item.GetNamespace()}})
+	}
+	return requests
+}
+
+// enqueueDeleted holds the final state of the recorded resources which are deleted, so that the release of their IPs can be recorded once they are gone
+func (k *resourceKindReconciler) enqueueDeleted(q workqueue.RateLimitingInterface, obj client.Object) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	if len(k.observedKeys(func(key resourceKey) bool { return key.UID == u.GetUID() })) == 0 {
+		return
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.deleted == nil {
+		k.deleted = map[types.NamespacedName]*unstructured.Unstructured{}
+	}
+	name := types.NamespacedName{Name: u.GetName(), Namespace: u.GetNamespace()}
+	k.deleted[name] = u
+	q.Add(reconcile.Request{NamespacedName: name})
+}
+
+// getObserved returns a resource as of the last record written for it for a PodTracker
+func (k *resourceKindReconciler) getObserved(key resourceKey) (observedResource, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	observed, ok := k.observed[key]
+	return observed, ok
+}
+
+// setObserved remembers a resource as recorded for a PodTracker
+func (k *resourceKindReconciler) setObserved(key resourceKey, observed observedResource) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.observed == nil {
+		k.observed = map[resourceKey]observedResource{}
+	}
+	k.observed[key] = observed
+}
+
+// observedKeys returns the keys of the recorded resources which match the provided function
+func (k *resourceKindReconciler) observedKeys(matches func(resourceKey) bool) []resourceKey {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	keys := []resourceKey{}
+	for key := range k.observed {
+		if matches(key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// forget removes a resource recorded for a PodTracker once the release of its IPs has been recorded
+func (k *resourceKindReconciler) forget(key resourceKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	delete(k.observed, key)
+}
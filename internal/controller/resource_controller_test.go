@@ -0,0 +1,274 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	networkingv1 "github.com/gccloudone-aurora/podtracker/api/v1"
+	"github.com/gccloudone-aurora/podtracker/internal/config"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+var _ = Describe("ResourceReconciler", func() {
+	var (
+		ctx       context.Context
+		namespace string
+		plugin    *recordingPlugin
+		address   string
+	)
+
+	setup := func(mgr ctrl.Manager, podTrackers *config.CachedPodTrackerConfig, _ *PodTrackerReconciler) error {
+		return (&ResourceReconciler{Client: mgr.GetClient(), PodTrackerConfig: podTrackers}).SetupWithManager(mgr)
+	}
+
+	trackConfigMaps := func(spec *networkingv1.PodTrackerSpec) {
+		spec.NSToWatch = []string{namespace}
+		spec.Resources = []tracking.ResourceRule{{Version: "v1", Kind: "ConfigMap", IPPaths: []string{"{.data.ip}"}}}
+	}
+
+	// created returns the names of the resources recorded with a create event for the named PodTracker
+	created := func(podTracker string) func() []string {
+		return func() []string {
+			names := []string{}
+			for _, record := range recordsOf[*tracking.ResourceRecord](plugin) {
+				if record.TrackedBy == podTracker && record.Namespace == namespace && record.Event == tracking.ResourceCreateEvent {
+					names = append(names, record.Name)
+				}
+			}
+			return names
+		}
+	}
+
+	BeforeEach(func() {
+		requireTestEnv()
+		ctx = context.Background()
+		namespace = createNamespace(ctx)
+		plugin, address = servePlugin()
+
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: namespace},
+			Data:       map[string]string{"ip": "10.10.0.1"},
+		}
+		Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+	})
+
+	It("records the resources which exist when the controller starts", func() {
+		pt := newPodTracker(address, trackConfigMaps)
+		createPodTracker(ctx, pt)
+		startManager(setup)
+
+		Eventually(created(pt.GetName())).WithTimeout(30 * time.Second).Should(ConsistOf("existing"))
+	})
+
+	It("records the existing resources for a PodTracker registered after they were recorded", func() {
+		first := newPodTracker(address, trackConfigMaps)
+		createPodTracker(ctx, first)
+		startManager(setup)
+		Eventually(created(first.GetName())).WithTimeout(30 * time.Second).Should(ConsistOf("existing"))
+
+		second := newPodTracker(address, trackConfigMaps)
+		createPodTracker(ctx, second)
+		Eventually(created(second.GetName())).WithTimeout(30 * time.Second).Should(ConsistOf("existing"))
+		Consistently(created(first.GetName())).WithTimeout(2 * time.Second).Should(ConsistOf("existing"))
+	})
+
+	It("records the IP changes and the release of the IPs of a resource", func() {
+		pt := newPodTracker(address, trackConfigMaps)
+		createPodTracker(ctx, pt)
+		startManager(setup)
+		Eventually(created(pt.GetName())).WithTimeout(30 * time.Second).Should(ConsistOf("existing"))
+
+		cm := &corev1.ConfigMap{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Name: "existing", Namespace: namespace}, cm)).To(Succeed())
+		cm.Data["ip"] = "10.10.0.2"
+		Expect(k8sClient.Update(ctx, cm)).To(Succeed())
+		Expect(k8sClient.Delete(ctx, cm)).To(Succeed())
+
+		Eventually(func() []tracking.ResourceEvent {
+			recorded := []tracking.ResourceEvent{}
+			for _, record := range recordsOf[*tracking.ResourceRecord](plugin) {
+				if record.TrackedBy == pt.GetName() && record.Namespace == namespace {
+					recorded = append(recorded, record.Event)
+				}
+			}
+			return recorded
+		}).WithTimeout(30 * time.Second).Should(Equal([]tracking.ResourceEvent{
+			tracking.ResourceCreateEvent, tracking.ResourceIPChangedEvent, tracking.ResourceDeleteEvent,
+		}))
+	})
+})
+
+var _ = Describe("resourceKindReconciler recording resources", func() {
+	var (
+		ctx         context.Context
+		c           client.Client
+		cm          *corev1.ConfigMap
+		k           *resourceKindReconciler
+		podTrackers *config.CachedPodTrackerConfig
+		written     *recordingWriter
+	)
+
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	name := types.NamespacedName{Name: "endpoint", Namespace: "apps"}
+
+	reconcile := func() error {
+		_, err := k.Reconcile(ctx, ctrl.Request{NamespacedName: name})
+		return err
+	}
+
+	update := func(ips string) {
+		Expect(c.Get(ctx, name, cm)).To(Succeed())
+		cm.Data["ips"] = ips
+		Expect(c.Update(ctx, cm)).To(Succeed())
+	}
+
+	events := func() []tracking.ResourceEvent {
+		recorded := []tracking.ResourceEvent{}
+		for _, record := range recordsOf[*tracking.ResourceRecord](written) {
+			recorded = append(recorded, record.Event)
+		}
+		return recorded
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name.Name, Namespace: name.Namespace, UID: "endpoint-uid"},
+			Data:       map[string]string{"id": "endpoint-17", "ip": "10.10.0.1"},
+		}
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps"}},
+			cm,
+		).Build()
+
+		pt := &networkingv1.PodTracker{
+			ObjectMeta: metav1.ObjectMeta{Name: "resources"},
+			Spec: networkingv1.PodTrackerSpec{
+				NSToWatch: []string{"apps"},
+				Resources: []tracking.ResourceRule{{Version: "v1", Kind: "ConfigMap", IDPath: "{.data.id}", IPPaths: []string{"{.data.ip}", "{.data.ips}"}}},
+			},
+		}
+		var writers map[string]*recordingWriter
+		podTrackers, writers = registerPodTrackers(pt)
+		written = writers[pt.GetName()]
+
+		registered := make(chan struct{})
+		close(registered)
+		k = &resourceKindReconciler{
+			parent: &ResourceReconciler{Client: c, PodTrackerConfig: podTrackers, registered: registered},
+			gvk:    gvk,
+			cache:  c,
+		}
+	})
+
+	It("records the IPs and the ID found by the JSONPath expressions of the rule", func() {
+		Expect(reconcile()).To(Succeed())
+		Expect(reconcile()).To(Succeed())
+
+		records := recordsOf[*tracking.ResourceRecord](written)
+		Expect(records).To(HaveLen(1))
+		Expect(records[0].Event).To(Equal(tracking.ResourceCreateEvent))
+		Expect(records[0].ResourceID).To(Equal("endpoint-17"))
+		Expect(records[0].IPs).To(HaveLen(1))
+		Expect(records[0].IPs[0].IP).To(Equal("10.10.0.1"))
+	})
+
+	It("records the IP changes of a resource with its previous IPs", func() {
+		Expect(reconcile()).To(Succeed())
+		update("10.10.0.2")
+		Expect(reconcile()).To(Succeed())
+
+		Expect(events()).To(Equal([]tracking.ResourceEvent{tracking.ResourceCreateEvent, tracking.ResourceIPChangedEvent}))
+		changed := recordsOf[*tracking.ResourceRecord](written)[1]
+		Expect(changed.IPs).To(HaveLen(2))
+		Expect(changed.PreviousIPs).To(HaveLen(1))
+		Expect(changed.PreviousIPs[0].IP).To(Equal("10.10.0.1"))
+	})
+
+	It("does not record resources without IPs", func() {
+		Expect(c.Get(ctx, name, cm)).To(Succeed())
+		delete(cm.Data, "ip")
+		Expect(c.Update(ctx, cm)).To(Succeed())
+		Expect(reconcile()).To(Succeed())
+
+		Expect(events()).To(BeEmpty())
+	})
+
+	It("records the release of the IPs of a deleted resource", func() {
+		Expect(reconcile()).To(Succeed())
+
+		deleted := &unstructured.Unstructured{}
+		deleted.SetGroupVersionKind(gvk)
+		Expect(c.Get(ctx, name, deleted)).To(Succeed())
+		Expect(c.Delete(ctx, deleted)).To(Succeed())
+		k.deleted = map[types.NamespacedName]*unstructured.Unstructured{name: deleted}
+		Expect(reconcile()).To(Succeed())
+		Expect(reconcile()).To(Succeed())
+
+		Expect(events()).To(Equal([]tracking.ResourceEvent{tracking.ResourceCreateEvent, tracking.ResourceDeleteEvent}))
+		released := recordsOf[*tracking.ResourceRecord](written)[1]
+		Expect(released.ResourceID).To(Equal("endpoint-17"))
+		Expect(released.IPs[0].IP).To(Equal("10.10.0.1"))
+	})
+
+	It("records the release of the IPs of a resource once the rule for its kind is removed", func() {
+		Expect(reconcile()).To(Succeed())
+
+		podTrackers.Items[0].Spec.Resources = nil
+		Expect(k.enqueueRegistered(ctx, &podTrackers.Items[0])).To(ConsistOf(ctrl.Request{NamespacedName: name}))
+		Expect(reconcile()).To(Succeed())
+		Expect(reconcile()).To(Succeed())
+
+		Expect(events()).To(Equal([]tracking.ResourceEvent{tracking.ResourceCreateEvent, tracking.ResourceDeleteEvent}))
+		Expect(recordsOf[*tracking.ResourceRecord](written)[1].ResourceID).To(Equal("endpoint-17"))
+	})
+})
+
+var _ = Describe("resourceControllerName", func() {
+	It("names the controllers of the kinds by their version", func() {
+		Expect(resourceControllerName(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"})).
+			To(Equal("PodTracker-Resource-configmap.v1"))
+		Expect(resourceControllerName(schema.GroupVersionKind{Group: "cilium.io", Version: "v2", Kind: "CiliumEndpoint"})).
+			To(Equal("PodTracker-Resource-ciliumendpoint.v2.cilium.io"))
+	})
+})
@@ -0,0 +1,313 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	v1 "github.com/gccloudone-aurora/podtracker/api/v1"
+	"github.com/gccloudone-aurora/podtracker/internal/config"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+	"github.com/gccloudone-aurora/podtracker/internal/writer"
+)
+
+// ServiceReconciler records the IPs allocated to the Services tracked by PodTrackers (see PodTracker.TracksService):
+// when they are first assigned, when they change (e.g. when a load balancer is provisioned) and when they are released.
+// Services are recorded separately for every PodTracker, so that a PodTracker registered after a Service was recorded records it too.
+// NOTE: Services are recorded without a finalizer. Like the observed state of Pods, the recorded IPs are kept in memory only,
+// so Services are recorded with a create event again after a controller restart, and Services deleted while the controller is down are not recorded
+type ServiceReconciler struct {
+	client.Client
+	PodTrackerConfig *config.CachedPodTrackerConfig
+	// Instance identifies the cluster and controller process on every record. Records are not stamped if nil
+	Instance *tracking.Instance
+
+	// recorded are the IPs of the Services as of the last record written for them, for every PodTracker
+	recorded keyedStore[recordedKey, tracking.ServiceIPs]
+	// deleted holds the recorded Services whose deletion has been observed from watch events until their deletion is recorded
+	deleted keyedStore[types.NamespacedName, *corev1.Service]
+	// registered is closed once the existing PodTrackers have been registered after the controller starts
+	registered <-chan struct{}
+}
+
+//+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch
+
+// Reconcile records the changes of the IPs allocated to a Service
+func (r *ServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	rl := log.FromContext(ctx)
+
+	// wait until the existing PodTrackers are registered, so that the Services listed when the controller starts are not missed
+	select {
+	case <-r.registered:
+	case <-ctx.Done():
+		return ctrl.Result{}, ctx.Err()
+	}
+
+	// record the release of the IPs of a deleted Service, if its deletion has been observed from a watch event
+	if deleted, ok := r.deleted.Pop(req.NamespacedName); ok {
+		if err := r.recordDeletedService(deleted); err != nil {
+			// writing to one or more backends failed - hold the Service again and requeue with error
+			r.deleted.Set(req.NamespacedName, deleted)
+			return ctrl.Result{}, err
+		}
+	}
+
+	svc := &corev1.Service{}
+	if err := r.Client.Get(ctx, req.NamespacedName, svc); err != nil {
+		if apierrors.IsNotFound(err) {
+			rl.V(2).Info(
+				"Request object not found for Service, could have been deleted after reconcile request.",
+				"name", req.Name,
+				"namespace", req.Namespace,
+			)
+
+			// return and don't requeue
+			return ctrl.Result{}, nil
+		}
+
+		// error getting Service from Kubernetes API server - requeue the request
+		return ctrl.Result{}, err
+	}
+	namespaceLabels, err := r.PodTrackerConfig.NamespaceLabels(ctx, r.Client, svc.GetNamespace())
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !svc.GetDeletionTimestamp().IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.recordService(svc, namespaceLabels); err != nil {
+		// writing to one or more backends failed - return and requeue with error
+		return ctrl.Result{}, err
+	}
+
+	// reconciliation was successful - return and don't requeue
+	return ctrl.Result{}, nil
+}
+
+// recordService records the IPs of the Service for every PodTracker tracking it, unless the PodTracker has recorded them already.
+// The Service is recorded with a create event for the PodTrackers which haven't recorded it before, and with an IPChanged event otherwise
+func (r *ServiceReconciler) recordService(svc *corev1.Service, namespaceLabels map[string]string) error {
+	current := tracking.NewServiceIPs(svc)
+
+	// acquire the PodTrackers tracking the Service, whose writers are written to without holding the lock
+	registrations, release := r.PodTrackerConfig.Acquire(func(pt *v1.PodTracker) bool { return pt.TracksService(svc, namespaceLabels) })
+	defer release()
+
+	var errs []error
+	tracked := map[string]bool{}
+	for _, registration := range registrations {
+		pt := registration.PodTracker
+		tracked[pt.GetName()] = true
+		key := recordedKey{PodTracker: pt.GetName(), UID: svc.GetUID()}
+		cfg := &tracking.ServiceRecordConfig{Service: svc, Event: tracking.ServiceCreateEvent}
+		if previous, recorded := r.recorded.Get(key); recorded {
+			if reflect.DeepEqual(previous, current) {
+				continue
+			}
+			cfg.Event = tracking.ServiceIPChangedEvent
+			cfg.PreviousIPs = &previous
+		} else if current.IsEmpty() {
+			// headless Services have no IPs to record
+			continue
+		}
+
+		if err := r.writeServiceRecord(registration, cfg); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		r.recorded.Set(key, current)
+	}
+
+	// the PodTrackers which have recorded the Service but don't track it anymore (e.g. their namespaces changed) record the release of its IPs,
+	// so that the IPs are not attributed to the Service indefinitely
+	untracked := r.recorded.Keys(func(key recordedKey) bool { return key.UID == svc.GetUID() && !tracked[key.PodTracker] })
+	if err := r.releaseService(svc, untracked); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// recordDeletedService records the release of the IPs of a deleted Service for every PodTracker which has recorded the Service
+func (r *ServiceReconciler) recordDeletedService(svc *corev1.Service) error {
+	return r.releaseService(svc, r.recorded.Keys(func(key recordedKey) bool { return key.UID == svc.GetUID() }))
+}
+
+// releaseService records the release of the IPs of the Service for the PodTrackers it was recorded for with the provided keys,
+// and forgets the keys once the release has been recorded
+func (r *ServiceReconciler) releaseService(svc *corev1.Service, keys []recordedKey) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	registrations, release := acquireRecorded(r.PodTrackerConfig, keys)
+	defer release()
+
+	var errs []error
+	for _, key := range keys {
+		if registration, ok := registrations[key.PodTracker]; ok {
+			if err := r.writeServiceRecord(registration, &tracking.ServiceRecordConfig{Service: svc, Event: tracking.ServiceDeleteEvent}); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		// the deletion has been recorded, or the PodTracker has been removed
+		r.recorded.Forget(key)
+	}
+
+	return errors.Join(errs...)
+}
+
+// writeServiceRecord writes the described ServiceRecord to the writers of the acquired PodTracker
+func (r *ServiceReconciler) writeServiceRecord(registration config.Registration, cfg *tracking.ServiceRecordConfig) error {
+	if !registration.Ready {
+		// the writers for this PodTracker could not be built - fail so that the event is retried once they are
+		return fmt.Errorf("no writers are available for PodTracker %q", registration.PodTracker.GetName())
+	}
+
+	record := registration.PodTracker.ProjectServiceRecord(tracking.NewServiceRecord(cfg))
+	r.Instance.Stamp(record)
+	return errors.Join(writer.WriteToAll(registration.Writers, record)...)
+}
+
+// enqueueRegisteredServices enqueues the existing Services tracked (or recorded) by a PodTracker which has been registered or updated, as the Services
+// which existed before are otherwise only recorded for the PodTracker once their IPs change
+func (r *ServiceReconciler) enqueueRegisteredServices(ctx context.Context, obj client.Object) []reconcile.Request {
+	rl := log.FromContext(ctx)
+
+	pt, ok := obj.(*v1.PodTracker)
+	if !ok {
+		return []reconcile.Request{}
+	}
+
+	services := &corev1.ServiceList{}
+	if err := r.Client.List(ctx, services); err != nil {
+		rl.Error(err, "unable to list the Services tracked by PodTracker", "podtracker", pt.GetName())
+		return []reconcile.Request{}
+	}
+
+	requests := []reconcile.Request{}
+	namespaceLabels := map[string]map[string]string{}
+	for i := range services.Items {
+		svc := &services.Items[i]
+		labels, ok := namespaceLabels[svc.GetNamespace()]
+		if !ok {
+			var err error
+			if labels, err = r.PodTrackerConfig.NamespaceLabels(ctx, r.Client, svc.GetNamespace()); err != nil {
+				// the reconciler only records the Services which are tracked, so the Service is enqueued if the labels can't be read
+				rl.Error(err, "unable to get the labels of namespace", "namespace", svc.GetNamespace())
+			}
+			namespaceLabels[svc.GetNamespace()] = labels
+		}
+		// the Services recorded for the PodTracker are enqueued too, so that the release of the Services it doesn't track anymore is recorded
+		_, recorded := r.recorded.Get(recordedKey{PodTracker: pt.GetName(), UID: svc.GetUID()})
+		if labels == nil || recorded || pt.TracksService(svc, labels) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: svc.GetName(), Namespace: svc.GetNamespace()}})
+		}
+	}
+	return requests
+}
+
+// enqueueDeletedService holds the final state of the recorded Services which are deleted, so that the release of their IPs can be recorded once they are gone
+func (r *ServiceReconciler) enqueueDeletedService(ctx context.Context, de event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	svc, ok := de.Object.(*corev1.Service)
+	if !ok {
+		return
+	}
+	if len(r.recorded.Keys(func(key recordedKey) bool { return key.UID == svc.GetUID() })) == 0 {
+		return
+	}
+
+	name := types.NamespacedName{Name: svc.GetName(), Namespace: svc.GetNamespace()}
+	r.deleted.Set(name, svc)
+	q.Add(reconcile.Request{NamespacedName: name})
+}
+
+// SetupWithManager sets up the controller with the Controller Manager.
+func (r *ServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	registered, err := podTrackersRegisteredChannel(mgr, r.PodTrackerConfig)
+	if err != nil {
+		return err
+	}
+	r.registered = registered
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("PodTracker-Service").
+		// NOTE: Services are enqueued whether or not they are tracked when the event is received, as the PodTrackers may not be registered yet.
+		// The reconciler only records the Services which are tracked
+		Watches(
+			&corev1.Service{},
+			&handler.EnqueueRequestForObject{},
+			builder.WithPredicates(
+				predicate.Funcs{
+					CreateFunc: func(ce event.CreateEvent) bool { return true },
+					UpdateFunc: func(ue event.UpdateEvent) bool {
+						oldSvc, ok := ue.ObjectOld.(*corev1.Service)
+						if !ok {
+							return false
+						}
+						newSvc, ok := ue.ObjectNew.(*corev1.Service)
+						if !ok {
+							return false
+						}
+
+						// only enqueue Services whose IPs have changed
+						return !reflect.DeepEqual(tracking.NewServiceIPs(oldSvc), tracking.NewServiceIPs(newSvc))
+					},
+					DeleteFunc:  func(de event.DeleteEvent) bool { return false },
+					GenericFunc: func(ge event.GenericEvent) bool { return false },
+				},
+			),
+		).
+		Watches(
+			&corev1.Service{},
+			handler.Funcs{DeleteFunc: r.enqueueDeletedService},
+		).
+		WatchesRawSource(
+			&source.Channel{Source: r.PodTrackerConfig.Subscribe()},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueRegisteredServices),
+		).
+		Complete(r)
+}
@@ -0,0 +1,228 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	networkingv1 "github.com/gccloudone-aurora/podtracker/api/v1"
+	"github.com/gccloudone-aurora/podtracker/internal/config"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+var _ = Describe("ServiceReconciler", func() {
+	var (
+		ctx       context.Context
+		namespace string
+		plugin    *recordingPlugin
+		address   string
+	)
+
+	setup := func(mgr ctrl.Manager, podTrackers *config.CachedPodTrackerConfig, _ *PodTrackerReconciler) error {
+		return (&ServiceReconciler{Client: mgr.GetClient(), PodTrackerConfig: podTrackers}).SetupWithManager(mgr)
+	}
+
+	trackServices := func(spec *networkingv1.PodTrackerSpec) {
+		spec.NSToWatch = []string{namespace}
+		spec.TrackServices = true
+	}
+
+	// created returns the names of the Services recorded with a create event for the named PodTracker
+	created := func(podTracker string) func() []string {
+		return func() []string {
+			names := []string{}
+			for _, record := range recordsOf[*tracking.ServiceRecord](plugin) {
+				if record.TrackedBy == podTracker && record.Namespace == namespace && record.Event == tracking.ServiceCreateEvent {
+					names = append(names, record.Name)
+				}
+			}
+			return names
+		}
+	}
+
+	BeforeEach(func() {
+		requireTestEnv()
+		ctx = context.Background()
+		namespace = createNamespace(ctx)
+		plugin, address = servePlugin()
+
+		svc := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: namespace},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+		}
+		Expect(k8sClient.Create(ctx, svc)).To(Succeed())
+	})
+
+	It("records the Services which exist when the controller starts", func() {
+		pt := newPodTracker(address, trackServices)
+		createPodTracker(ctx, pt)
+		startManager(setup)
+
+		Eventually(created(pt.GetName())).WithTimeout(30 * time.Second).Should(ConsistOf("existing"))
+	})
+
+	It("records the existing Services for a PodTracker registered after they were recorded", func() {
+		first := newPodTracker(address, trackServices)
+		createPodTracker(ctx, first)
+		startManager(setup)
+		Eventually(created(first.GetName())).WithTimeout(30 * time.Second).Should(ConsistOf("existing"))
+
+		second := newPodTracker(address, trackServices)
+		createPodTracker(ctx, second)
+		Eventually(created(second.GetName())).WithTimeout(30 * time.Second).Should(ConsistOf("existing"))
+		Consistently(created(first.GetName())).WithTimeout(2 * time.Second).Should(ConsistOf("existing"))
+	})
+
+	It("records the IP changes and the release of the IPs of a Service", func() {
+		pt := newPodTracker(address, trackServices)
+		createPodTracker(ctx, pt)
+		startManager(setup)
+		Eventually(created(pt.GetName())).WithTimeout(30 * time.Second).Should(ConsistOf("existing"))
+
+		svc := &corev1.Service{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Name: "existing", Namespace: namespace}, svc)).To(Succeed())
+		svc.Spec.ExternalIPs = []string{"192.0.2.10"}
+		Expect(k8sClient.Update(ctx, svc)).To(Succeed())
+		Expect(k8sClient.Delete(ctx, svc)).To(Succeed())
+
+		events := func() []tracking.ServiceEvent {
+			recorded := []tracking.ServiceEvent{}
+			for _, record := range recordsOf[*tracking.ServiceRecord](plugin) {
+				if record.TrackedBy == pt.GetName() && record.Namespace == namespace {
+					recorded = append(recorded, record.Event)
+				}
+			}
+			return recorded
+		}
+		Eventually(events).WithTimeout(30 * time.Second).Should(Equal([]tracking.ServiceEvent{
+			tracking.ServiceCreateEvent, tracking.ServiceIPChangedEvent, tracking.ServiceDeleteEvent,
+		}))
+	})
+})
+
+var _ = Describe("ServiceReconciler recording Services", func() {
+	var (
+		svc         *corev1.Service
+		r           *ServiceReconciler
+		podTrackers *config.CachedPodTrackerConfig
+		written     *recordingWriter
+	)
+
+	events := func() []tracking.ServiceEvent {
+		recorded := []tracking.ServiceEvent{}
+		for _, record := range recordsOf[*tracking.ServiceRecord](written) {
+			recorded = append(recorded, record.Event)
+		}
+		return recorded
+	}
+
+	BeforeEach(func() {
+		svc = &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "apps", UID: "api-uid"},
+			Spec:       corev1.ServiceSpec{ClusterIP: "10.96.0.10", ClusterIPs: []string{"10.96.0.10"}},
+		}
+
+		pt := &networkingv1.PodTracker{
+			ObjectMeta: metav1.ObjectMeta{Name: "services"},
+			Spec:       networkingv1.PodTrackerSpec{NSToWatch: []string{"apps"}, TrackServices: true},
+		}
+		var writers map[string]*recordingWriter
+		podTrackers, writers = registerPodTrackers(pt)
+		written = writers[pt.GetName()]
+		r = &ServiceReconciler{PodTrackerConfig: podTrackers}
+	})
+
+	It("records a Service once, until its IPs change", func() {
+		Expect(r.recordService(svc, nil)).To(Succeed())
+		Expect(r.recordService(svc, nil)).To(Succeed())
+
+		svc.Spec.ExternalIPs = []string{"192.0.2.10"}
+		Expect(r.recordService(svc, nil)).To(Succeed())
+
+		Expect(events()).To(Equal([]tracking.ServiceEvent{tracking.ServiceCreateEvent, tracking.ServiceIPChangedEvent}))
+		changed := recordsOf[*tracking.ServiceRecord](written)[1]
+		Expect(changed.PreviousIPs).NotTo(BeNil())
+		Expect(changed.PreviousIPs.ExternalIPs).To(BeEmpty())
+		Expect(changed.IPs.ExternalIPs).To(HaveLen(1))
+	})
+
+	It("does not record headless Services", func() {
+		svc.Spec.ClusterIP = corev1.ClusterIPNone
+		svc.Spec.ClusterIPs = []string{corev1.ClusterIPNone}
+		Expect(r.recordService(svc, nil)).To(Succeed())
+
+		Expect(events()).To(BeEmpty())
+	})
+
+	It("records the release of the IPs of a deleted Service", func() {
+		Expect(r.recordService(svc, nil)).To(Succeed())
+		Expect(r.recordDeletedService(svc)).To(Succeed())
+		Expect(r.recordDeletedService(svc)).To(Succeed())
+
+		Expect(events()).To(Equal([]tracking.ServiceEvent{tracking.ServiceCreateEvent, tracking.ServiceDeleteEvent}))
+	})
+
+	It("records the release of the IPs of a Service which the PodTracker stops tracking", func() {
+		Expect(r.recordService(svc, nil)).To(Succeed())
+
+		podTrackers.Items[0].Spec.NSToWatch = []string{"other"}
+		Expect(r.recordService(svc, nil)).To(Succeed())
+		Expect(events()).To(Equal([]tracking.ServiceEvent{tracking.ServiceCreateEvent, tracking.ServiceDeleteEvent}))
+		_, recorded := r.recorded.Get(recordedKey{PodTracker: "services", UID: svc.GetUID()})
+		Expect(recorded).To(BeFalse())
+
+		// the Service is recorded again once it is tracked again
+		podTrackers.Items[0].Spec.NSToWatch = []string{"apps"}
+		Expect(r.recordService(svc, nil)).To(Succeed())
+		Expect(events()).To(Equal([]tracking.ServiceEvent{tracking.ServiceCreateEvent, tracking.ServiceDeleteEvent, tracking.ServiceCreateEvent}))
+	})
+
+	It("keeps the Service recorded until the release of its IPs has been recorded", func() {
+		Expect(r.recordService(svc, nil)).To(Succeed())
+
+		podTrackers.Items[0].Spec.NSToWatch = []string{"other"}
+		written.err = errors.New("backend unavailable")
+		Expect(r.recordService(svc, nil)).NotTo(Succeed())
+		_, recorded := r.recorded.Get(recordedKey{PodTracker: "services", UID: svc.GetUID()})
+		Expect(recorded).To(BeTrue())
+
+		written.err = nil
+		Expect(r.recordService(svc, nil)).To(Succeed())
+		Expect(events()).To(Equal([]tracking.ServiceEvent{tracking.ServiceCreateEvent, tracking.ServiceDeleteEvent}))
+	})
+})
@@ -0,0 +1,119 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package controller
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	v1 "github.com/gccloudone-aurora/podtracker/api/v1"
+	"github.com/gccloudone-aurora/podtracker/internal/config"
+)
+
+// keyedStore is a map which is safe for concurrent use. The reconcilers use it to hold the recorded state of the objects they track,
+// and the deleted objects which are waiting to be recorded
+type keyedStore[K comparable, V any] struct {
+	mu    sync.Mutex
+	items map[K]V
+}
+
+// Get returns the value stored for the key, if any
+func (s *keyedStore[K, V]) Get(key K) (V, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, ok := s.items[key]
+	return value, ok
+}
+
+// Set stores the value for the key
+func (s *keyedStore[K, V]) Set(key K, value V) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.items == nil {
+		s.items = map[K]V{}
+	}
+	s.items[key] = value
+}
+
+// Pop returns and removes the value stored for the key, if any
+func (s *keyedStore[K, V]) Pop(key K) (V, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, ok := s.items[key]
+	delete(s.items, key)
+	return value, ok
+}
+
+// Forget removes the value stored for the key
+func (s *keyedStore[K, V]) Forget(key K) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.items, key)
+}
+
+// Keys returns the keys which match the provided function
+func (s *keyedStore[K, V]) Keys(matches func(K) bool) []K {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := []K{}
+	for key := range s.items {
+		if matches(key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// recordedKey identifies an object as recorded for a single PodTracker. Objects are recorded separately for every PodTracker,
+// so that a PodTracker registered after an object was recorded for another PodTracker records the object too
+type recordedKey struct {
+	PodTracker string
+	UID        types.UID
+}
+
+// acquireRecorded acquires the registered PodTrackers which the provided keys were recorded for, by name (see config.CachedPodTrackerConfig.Acquire).
+// The keys of the PodTrackers which are missing have been removed since the object was recorded
+func acquireRecorded(cfg *config.CachedPodTrackerConfig, keys []recordedKey) (map[string]config.Registration, func()) {
+	names := map[string]bool{}
+	for _, key := range keys {
+		names[key.PodTracker] = true
+	}
+
+	registrations, release := cfg.Acquire(func(pt *v1.PodTracker) bool { return names[pt.GetName()] })
+	byName := make(map[string]config.Registration, len(registrations))
+	for _, registration := range registrations {
+		byName[registration.PodTracker.GetName()] = registration
+	}
+	return byName, release
+}
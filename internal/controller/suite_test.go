@@ -28,22 +28,36 @@ SOFTWARE.
 package controller
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	networkingv1 "github.com/gccloudone-aurora/podtracker/api/v1"
+	"github.com/gccloudone-aurora/podtracker/internal/config"
+	"github.com/gccloudone-aurora/podtracker/internal/plugin"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+	"github.com/gccloudone-aurora/podtracker/internal/writer"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -63,31 +77,35 @@ func TestControllers(t *testing.T) {
 var _ = BeforeSuite(func() {
 	logf.SetLogger(zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)))
 
+	err := networkingv1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+
+	//+kubebuilder:scaffold:scheme
+
+	// The BinaryAssetsDirectory is only required if you want to run the tests directly
+	// without call the makefile target test. If not informed it will look for the
+	// default path defined in controller-runtime which is /usr/local/kubebuilder/.
+	// Note that you must have the required binaries setup under the bin directory to perform
+	// the tests directly. When we run make test it will be setup and used automatically.
+	assets := filepath.Join("..", "..", "bin", "k8s", fmt.Sprintf("1.28.3-%s-%s", runtime.GOOS, runtime.GOARCH))
+	if _, err := os.Stat(assets); err != nil && os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		// the specs which need a test environment are skipped (see requireTestEnv), the others still run
+		GinkgoWriter.Println("envtest binaries not found, skipping the specs which need a test environment")
+		return
+	}
+
 	By("bootstrapping test environment")
 	testEnv = &envtest.Environment{
 		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd", "bases")},
 		ErrorIfCRDPathMissing: true,
-
-		// The BinaryAssetsDirectory is only required if you want to run the tests directly
-		// without call the makefile target test. If not informed it will look for the
-		// default path defined in controller-runtime which is /usr/local/kubebuilder/.
-		// Note that you must have the required binaries setup under the bin directory to perform
-		// the tests directly. When we run make test it will be setup and used automatically.
-		BinaryAssetsDirectory: filepath.Join("..", "..", "bin", "k8s",
-			fmt.Sprintf("1.28.3-%s-%s", runtime.GOOS, runtime.GOARCH)),
+		BinaryAssetsDirectory: assets,
 	}
 
-	var err error
 	// cfg is defined in this file globally.
 	cfg, err = testEnv.Start()
 	Expect(err).NotTo(HaveOccurred())
 	Expect(cfg).NotTo(BeNil())
 
-	err = networkingv1.AddToScheme(scheme.Scheme)
-	Expect(err).NotTo(HaveOccurred())
-
-	//+kubebuilder:scaffold:scheme
-
 	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
@@ -95,7 +113,227 @@ var _ = BeforeSuite(func() {
 })
 
 var _ = AfterSuite(func() {
+	if testEnv == nil {
+		return
+	}
 	By("tearing down the test environment")
 	err := testEnv.Stop()
 	Expect(err).NotTo(HaveOccurred())
 })
+
+// requireTestEnv skips the current spec if the test environment isn't available
+func requireTestEnv() {
+	if k8sClient == nil {
+		Skip("the test environment is not available")
+	}
+}
+
+// recordingPlugin is a writer plugin which keeps every record it receives, so that specs can inspect what the controllers recorded
+type recordingPlugin struct {
+	mu      sync.Mutex
+	records []tracking.Record
+}
+
+func (p *recordingPlugin) Name() string { return "recording" }
+
+func (p *recordingPlugin) Write(_ context.Context, info *tracking.PodInfo) error { return p.add(info) }
+
+func (p *recordingPlugin) WriteService(_ context.Context, record *tracking.ServiceRecord) error {
+	return p.add(record)
+}
+
+func (p *recordingPlugin) WriteNode(_ context.Context, record *tracking.NodeRecord) error {
+	return p.add(record)
+}
+
+func (p *recordingPlugin) WriteResource(_ context.Context, record *tracking.ResourceRecord) error {
+	return p.add(record)
+}
+
+func (p *recordingPlugin) WriteInventory(_ context.Context, record *tracking.InventoryRecord) error {
+	return p.add(record)
+}
+
+func (p *recordingPlugin) add(record tracking.Record) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.records = append(p.records, record)
+	return nil
+}
+
+// Records returns a copy of the records received by the plugin
+func (p *recordingPlugin) Records() []tracking.Record {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]tracking.Record{}, p.records...)
+}
+
+// recordingWriter is a BackendWriter which keeps every record written to it, or fails every write with err if it is set
+type recordingWriter struct {
+	mu      sync.Mutex
+	records []tracking.Record
+	err     error
+}
+
+func (w *recordingWriter) Write(record tracking.Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	w.records = append(w.records, record)
+	return nil
+}
+
+func (w *recordingWriter) Close() error { return nil }
+
+// Records returns a copy of the records written to the writer
+func (w *recordingWriter) Records() []tracking.Record {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return append([]tracking.Record{}, w.records...)
+}
+
+// registerPodTrackers registers the provided PodTrackers in a new config, with a recordingWriter each (by name).
+// It lets the reconcilers be tested without a test environment
+func registerPodTrackers(podTrackers ...*networkingv1.PodTracker) (*config.CachedPodTrackerConfig, map[string]*recordingWriter) {
+	cfg := &config.CachedPodTrackerConfig{}
+	writers := map[string]*recordingWriter{}
+	for _, pt := range podTrackers {
+		cfg.Items = append(cfg.Items, *pt.DeepCopy())
+		writers[pt.GetName()] = &recordingWriter{}
+		cfg.SetWriters(pt.GetName(), []writer.BackendWriter{writers[pt.GetName()]})
+	}
+	return cfg, writers
+}
+
+// recordsOf returns the records of type T received by the plugin or writer
+func recordsOf[T tracking.Record](p interface{ Records() []tracking.Record }) []T {
+	records := []T{}
+	for _, record := range p.Records() {
+		if r, ok := record.(T); ok {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// servePlugin serves a new recordingPlugin on a unix socket until the spec ends, and returns it along with its address
+func servePlugin() (*recordingPlugin, string) {
+	socket := filepath.Join(GinkgoT().TempDir(), "plugin.sock")
+	lis, err := net.Listen("unix", socket)
+	Expect(err).NotTo(HaveOccurred())
+
+	p := &recordingPlugin{}
+	server := plugin.NewServer(p)
+	go func() {
+		defer GinkgoRecover()
+		Expect(server.Serve(lis)).To(Or(Succeed(), MatchError(grpc.ErrServerStopped)))
+	}()
+	DeferCleanup(server.Stop)
+	return p, "unix://" + socket
+}
+
+// newPodTracker returns a PodTracker with a unique name which writes to the plugin served on the provided address
+func newPodTracker(address string, spec func(*networkingv1.PodTrackerSpec)) *networkingv1.PodTracker {
+	pt := &networkingv1.PodTracker{
+		ObjectMeta: metav1.ObjectMeta{Name: "podtracker-" + rand.String(5)},
+		Spec: networkingv1.PodTrackerSpec{
+			BackendWriterConfig: writer.BackendWriterConfig{
+				Plugins: []writer.PluginConfig{{Name: "recording", Enabled: true, Address: address}},
+			},
+		},
+	}
+	spec(&pt.Spec)
+	return pt
+}
+
+// createPodTracker creates the PodTracker, and deletes it once the spec ends
+func createPodTracker(ctx context.Context, pt *networkingv1.PodTracker) {
+	Expect(k8sClient.Create(ctx, pt)).To(Succeed())
+	DeferCleanup(func(ctx context.Context) {
+		// the finalizer is removed directly, as the manager may have been stopped already
+		current := &networkingv1.PodTracker{}
+		if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(pt), current); err != nil {
+			Expect(client.IgnoreNotFound(err)).To(Succeed())
+			return
+		}
+		current.SetFinalizers(nil)
+		Expect(client.IgnoreNotFound(k8sClient.Update(ctx, current))).To(Succeed())
+		Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, current))).To(Succeed())
+	})
+}
+
+// createNamespace creates a namespace with a unique name, and returns its name
+func createNamespace(ctx context.Context) string {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test-" + rand.String(5)}}
+	Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+	return ns.GetName()
+}
+
+// createNode creates a Node with a unique name and the provided internal IP, and returns its name
+func createNode(ctx context.Context, ip string) string {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-" + rand.String(5)}}
+	Expect(k8sClient.Create(ctx, node)).To(Succeed())
+	node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: ip}}
+	Expect(k8sClient.Status().Update(ctx, node)).To(Succeed())
+	DeferCleanup(func(ctx context.Context) {
+		Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, node))).To(Succeed())
+	})
+	return node.GetName()
+}
+
+// createRunningPod creates a Pod scheduled to the provided Node, and marks it as running with the provided IP
+func createRunningPod(ctx context.Context, namespace, name, node, ip string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: corev1.PodSpec{
+			NodeName:   node,
+			Containers: []corev1.Container{{Name: "app", Image: "app:latest"}},
+		},
+	}
+	Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+	pod.Status.Phase = corev1.PodRunning
+	pod.Status.PodIP = ip
+	pod.Status.PodIPs = []corev1.PodIP{{IP: ip}}
+	Expect(k8sClient.Status().Update(ctx, pod)).To(Succeed())
+	return pod
+}
+
+// startManager starts a manager running the PodTrackerReconciler along with the components set up by the provided function,
+// which all share the returned config. The manager is stopped once the spec ends
+func startManager(setup func(ctrl.Manager, *config.CachedPodTrackerConfig, *PodTrackerReconciler) error) *config.CachedPodTrackerConfig {
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:                 scheme.Scheme,
+		Metrics:                metricsserver.Options{BindAddress: "0"},
+		HealthProbeBindAddress: "0",
+	})
+	Expect(err).NotTo(HaveOccurred())
+
+	podTrackers := &config.CachedPodTrackerConfig{}
+	podTrackerReconciler := &PodTrackerReconciler{
+		Client:           mgr.GetClient(),
+		Scheme:           mgr.GetScheme(),
+		PodTrackerConfig: podTrackers,
+	}
+	Expect(setup(mgr, podTrackers, podTrackerReconciler)).To(Succeed())
+	Expect(podTrackerReconciler.SetupWithManager(mgr)).To(Succeed())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer GinkgoRecover()
+		defer close(done)
+		Expect(mgr.Start(ctx)).To(Succeed())
+	}()
+	DeferCleanup(func() {
+		cancel()
+		<-done
+		podTrackers.Close()
+	})
+	return podTrackers
+}
@@ -0,0 +1,179 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	v1 "github.com/gccloudone-aurora/podtracker/api/v1"
+	"github.com/gccloudone-aurora/podtracker/internal/config"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+	"github.com/gccloudone-aurora/podtracker/internal/writer"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// Recorder is a runnable component which periodically records an inventory of the Pods holding IPs tracked by each PodTracker
+// which enables them (see PodTrackerSpec.InventoryIntervalMinutes)
+type Recorder struct {
+	client.Client
+	// CheckInterval is the period in which the Recorder checks whether the inventory of a PodTracker is due.
+	// Inventories are recorded up to CheckInterval after they are due
+	CheckInterval time.Duration
+
+	PodTrackerConfig *config.CachedPodTrackerConfig
+	// Instance identifies the cluster and controller process on every record. Records are not stamped if nil
+	Instance *tracking.Instance
+}
+
+// a blank assignment of Recorder as a manager.Runnable to ensure that the interface is implemented
+var _ manager.Runnable = &Recorder{}
+
+// Start records the inventories of the PodTrackers as they become due, until the provided context is cancelled.
+// The first inventory of a PodTracker is recorded one interval after it is first observed by the Recorder.
+// Inventories which fail to be recorded are retried on the next check
+func (r *Recorder) Start(ctx context.Context) error {
+	rl := log.FromContext(ctx).WithName("inventory")
+	ticker := time.NewTicker(r.CheckInterval)
+	defer ticker.Stop()
+
+	rl.Info("starting inventory recorder", "period", r.CheckInterval)
+	due := map[string]time.Time{}
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+
+		now := time.Now()
+		trackers := r.podTrackers()
+		for name := range due {
+			if _, ok := trackers[name]; !ok {
+				delete(due, name)
+			}
+		}
+
+		for name, pt := range trackers {
+			interval := pt.InventoryInterval()
+			next, scheduled := due[name]
+			switch {
+			case interval == 0:
+				delete(due, name)
+			case !scheduled:
+				due[name] = now.Add(interval)
+			case !now.Before(next):
+				pods, err := r.record(ctx, pt, interval)
+				if err != nil {
+					rl.Error(err, "unable to record the inventory of PodTracker. will try again later", "name", name)
+					continue
+				}
+				rl.V(2).Info("recorded the inventory of PodTracker", "name", name, "pods", pods)
+				due[name] = now.Add(interval)
+			}
+		}
+	}
+}
+
+// podTrackers returns a copy of the registered PodTrackers, by name
+func (r *Recorder) podTrackers() map[string]v1.PodTracker {
+	// aquire the cached config
+	r.PodTrackerConfig.Lock()
+	defer r.PodTrackerConfig.Unlock()
+
+	trackers := make(map[string]v1.PodTracker, len(r.PodTrackerConfig.Items))
+	for _, pt := range r.PodTrackerConfig.Items {
+		trackers[pt.GetName()] = *pt.DeepCopy()
+	}
+	return trackers
+}
+
+// record writes the inventory of the Pods holding IPs tracked by the provided PodTracker, returning the number of Pods in the inventory
+func (r *Recorder) record(ctx context.Context, pt v1.PodTracker, interval time.Duration) (int, error) {
+	pods := &corev1.PodList{}
+	if err := r.Client.List(ctx, pods); err != nil {
+		return 0, err
+	}
+
+	tracked := []*corev1.Pod{}
+	namespaces := map[string]map[string]string{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		namespaceLabels, ok := namespaces[pod.GetNamespace()]
+		if !ok {
+			var err error
+			if namespaceLabels, err = r.PodTrackerConfig.NamespaceLabels(ctx, r.Client, pod.GetNamespace()); err != nil {
+				return 0, err
+			}
+			namespaces[pod.GetNamespace()] = namespaceLabels
+		}
+		if pt.TracksPod(pod, namespaceLabels) && holdsIPs(pod) {
+			tracked = append(tracked, pod)
+		}
+	}
+
+	records := tracking.NewInventoryRecords(&tracking.InventoryRecordConfig{
+		Pods:     tracked,
+		Interval: interval,
+	})
+
+	// acquire the writers of the PodTracker, which are written to without holding the lock
+	registrations, release := r.PodTrackerConfig.Acquire(func(registered *v1.PodTracker) bool { return registered.GetName() == pt.GetName() })
+	defer release()
+
+	if len(registrations) == 0 {
+		// the PodTracker has been removed since the check started
+		return 0, nil
+	}
+	if !registrations[0].Ready {
+		return 0, fmt.Errorf("no writers are available for PodTracker %q", pt.GetName())
+	}
+	// the pages are written in order, and the whole inventory is recorded again on the next check if writing any page fails
+	for _, record := range records {
+		projected := pt.ProjectInventoryRecord(record)
+		r.Instance.Stamp(projected)
+		if errs := writer.WriteToAll(registrations[0].Writers, projected); len(errs) > 0 {
+			return 0, errors.Join(errs...)
+		}
+	}
+	return len(tracked), nil
+}
+
+// holdsIPs returns true if the Pod has been assigned IPs and hasn't released them yet.
+// Pods that succeed or fail release their IPs before they are deleted
+func holdsIPs(pod *corev1.Pod) bool {
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false
+	}
+	return len(tracking.PodIPs(pod)) > 0
+}
@@ -0,0 +1,180 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1 "github.com/gccloudone-aurora/podtracker/api/v1"
+	"github.com/gccloudone-aurora/podtracker/internal/config"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+	"github.com/gccloudone-aurora/podtracker/internal/writer"
+)
+
+// recordingWriter is a BackendWriter which keeps the inventory records written to it, or fails every write with err if it is set
+type recordingWriter struct {
+	records []*tracking.InventoryRecord
+	err     error
+}
+
+func (w *recordingWriter) Write(record tracking.Record) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.records = append(w.records, record.(*tracking.InventoryRecord))
+	return nil
+}
+
+func (w *recordingWriter) Close() error { return nil }
+
+// newPod returns a Pod in the apps namespace with the provided IP
+func newPod(name, ip string, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "apps", UID: types.UID(name + "-uid")},
+		Status:     corev1.PodStatus{Phase: phase, PodIP: ip, PodIPs: []corev1.PodIP{{IP: ip}}},
+	}
+}
+
+var _ = Describe("Recorder", func() {
+	var (
+		ctx     context.Context
+		c       client.Client
+		pt      v1.PodTracker
+		r       *Recorder
+		written *recordingWriter
+	)
+
+	// names returns the names of the Pods listed by the pages of the last inventory written
+	names := func() []string {
+		names := []string{}
+		for _, record := range written.records {
+			if record.Page == 1 {
+				names = names[:0]
+			}
+			for _, pod := range record.Pods {
+				names = append(names, pod.Name)
+			}
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		c = fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps"}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+			newPod("running", "10.40.0.1", corev1.PodRunning),
+			newPod("succeeded", "10.40.0.2", corev1.PodSucceeded),
+			&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "apps", UID: "pending-uid"}},
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "untracked", Namespace: "other", UID: "untracked-uid"},
+				Status:     corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "10.40.0.3"},
+			},
+		).Build()
+
+		pt = v1.PodTracker{
+			ObjectMeta: metav1.ObjectMeta{Name: "inventory"},
+			Spec:       v1.PodTrackerSpec{NSToWatch: []string{"apps"}, InventoryIntervalMinutes: 5},
+		}
+		podTrackers := &config.CachedPodTrackerConfig{}
+		podTrackers.Items = []v1.PodTracker{pt}
+		written = &recordingWriter{}
+		podTrackers.SetWriters(pt.GetName(), []writer.BackendWriter{written})
+		r = &Recorder{Client: c, PodTrackerConfig: podTrackers}
+	})
+
+	It("lists the tracked Pods holding IPs", func() {
+		pods, err := r.record(ctx, pt, 5*time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(pods).To(Equal(1))
+		Expect(written.records).To(HaveLen(1))
+		Expect(written.records[0].PodCount).To(Equal(1))
+		Expect(names()).To(ConsistOf("running"))
+	})
+
+	It("reflects the Pods created and deleted since the previous inventory", func() {
+		_, err := r.record(ctx, pt, 5*time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Delete(ctx, newPod("running", "10.40.0.1", corev1.PodRunning))).To(Succeed())
+		Expect(c.Create(ctx, newPod("created", "10.40.0.4", corev1.PodRunning))).To(Succeed())
+		_, err = r.record(ctx, pt, 5*time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(names()).To(ConsistOf("created"))
+	})
+
+	It("splits large inventories into pages", func() {
+		for i := 0; i < tracking.DefaultInventoryPageSize; i++ {
+			Expect(c.Create(ctx, newPod(fmt.Sprintf("pod-%03d", i), fmt.Sprintf("10.41.%d.%d", i/250, i%250+1), corev1.PodRunning))).To(Succeed())
+		}
+
+		pods, err := r.record(ctx, pt, 5*time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pods).To(Equal(tracking.DefaultInventoryPageSize + 1))
+
+		Expect(written.records).To(HaveLen(2))
+		for i, record := range written.records {
+			Expect(record.Page).To(Equal(i + 1))
+			Expect(record.PageCount).To(Equal(2))
+			Expect(record.PodCount).To(Equal(tracking.DefaultInventoryPageSize + 1))
+		}
+		Expect(written.records[0].Pods).To(HaveLen(tracking.DefaultInventoryPageSize))
+		Expect(written.records[1].Pods).To(HaveLen(1))
+		Expect(names()).To(HaveLen(tracking.DefaultInventoryPageSize + 1))
+	})
+
+	It("fails the inventory if a page can't be written, so that it is recorded again", func() {
+		written.err = errors.New("backend unavailable")
+
+		_, err := r.record(ctx, pt, 5*time.Minute)
+		Expect(err).To(MatchError(ContainSubstring("backend unavailable")))
+	})
+
+	It("does not record the inventory of a PodTracker which has been removed", func() {
+		r.PodTrackerConfig = &config.CachedPodTrackerConfig{}
+
+		pods, err := r.record(ctx, pt, 5*time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pods).To(BeZero())
+		Expect(written.records).To(BeEmpty())
+	})
+})
@@ -0,0 +1,178 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package owner
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+const (
+	// maxDepth is the maximum number of owners which are followed when resolving the top-level controller of an object
+	maxDepth = 8
+	// maxEntries is the maximum number of resolved owners kept in the cache
+	maxEntries = 4096
+)
+
+// Resolver resolves the top-level controller of Pods by following their chain of controller owner references
+// (e.g. Pod → ReplicaSet → Deployment, or Pod → Job → CronJob). Owners of any kind (including custom resources) are looked up
+// through the metadata-only API, and the resolved owners are cached so that mass rollouts don't multiply API calls.
+type Resolver struct {
+	client.Reader
+	// TTL is how long a resolved owner is cached for
+	TTL time.Duration
+
+	mu    sync.Mutex
+	cache map[types.UID]entry
+}
+
+// entry is a cached top-level owner
+type entry struct {
+	owner   *tracking.Owner
+	expires time.Time
+}
+
+// NewResolver returns a Resolver which looks up owners using the provided reader and caches them for the provided duration.
+// An uncached reader is preferred, as the owners are cached by the Resolver itself and a cached reader would start an informer
+// for every kind of owner.
+func NewResolver(reader client.Reader, ttl time.Duration) *Resolver {
+	return &Resolver{
+		Reader: reader,
+		TTL:    ttl,
+		cache:  map[types.UID]entry{},
+	}
+}
+
+// Resolve returns the top-level controller of the provided object, or nil if the object has no controller.
+// Owners which can't be looked up (e.g. because they have been deleted or the controller isn't allowed to read them) end the chain,
+// in which case the last known owner is returned. If an unexpected error occurs, the owner resolved so far is returned along with the error
+func (r *Resolver) Resolve(ctx context.Context, obj client.Object) (*tracking.Owner, error) {
+	ref := metav1.GetControllerOf(obj)
+	if ref == nil {
+		return nil, nil
+	}
+
+	immediate := ref.UID
+	if owner, ok := r.cached(immediate); ok {
+		return owner, nil
+	}
+
+	owner := ownerFromReference(ref)
+	namespace := obj.GetNamespace()
+	for depth := 0; depth < maxDepth; depth++ {
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil {
+			break
+		}
+
+		current := &metav1.PartialObjectMetadata{}
+		current.SetGroupVersionKind(gv.WithKind(ref.Kind))
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, current); err != nil {
+			if apierrors.IsNotFound(err) || apierrors.IsForbidden(err) || meta.IsNoMatchError(err) {
+				// the chain can't be followed any further - the last known owner is the top-level controller
+				break
+			}
+
+			// unexpected error - return what has been resolved so far without caching it
+			return owner, err
+		}
+
+		if current.GetUID() != ref.UID {
+			// the owner has been replaced by another object with the same name
+			break
+		}
+
+		ref = metav1.GetControllerOf(current)
+		if ref == nil {
+			break
+		}
+		owner = ownerFromReference(ref)
+	}
+
+	r.store(immediate, owner)
+	return owner, nil
+}
+
+// cached returns the cached top-level owner for the provided immediate owner, if it has not expired
+func (r *Resolver) cached(uid types.UID) (*tracking.Owner, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.cache[uid]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.owner, true
+}
+
+// store caches the top-level owner for the provided immediate owner
+func (r *Resolver) store(uid types.UID, owner *tracking.Owner) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cache == nil {
+		r.cache = map[types.UID]entry{}
+	}
+
+	now := time.Now()
+	if len(r.cache) >= maxEntries {
+		// evict expired entries first, then arbitrary entries until there is room
+		for k, e := range r.cache {
+			if now.After(e.expires) {
+				delete(r.cache, k)
+			}
+		}
+		for k := range r.cache {
+			if len(r.cache) < maxEntries {
+				break
+			}
+			delete(r.cache, k)
+		}
+	}
+
+	r.cache[uid] = entry{owner: owner, expires: now.Add(r.TTL)}
+}
+
+func ownerFromReference(ref *metav1.OwnerReference) *tracking.Owner {
+	return &tracking.Owner{
+		APIVersion: ref.APIVersion,
+		Kind:       ref.Kind,
+		Name:       ref.Name,
+		UID:        ref.UID,
+	}
+}
@@ -0,0 +1,124 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package owner
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+// controllerReference returns a controller owner reference to the provided object
+func controllerReference(apiVersion, kind, name string, uid types.UID) metav1.OwnerReference {
+	isController := true
+	return metav1.OwnerReference{APIVersion: apiVersion, Kind: kind, Name: name, UID: uid, Controller: &isController}
+}
+
+// countingReader counts the Get calls made through it
+type countingReader struct {
+	client.Reader
+	gets int
+}
+
+func (c *countingReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	c.gets++
+	return c.Reader.Get(ctx, key, obj, opts...)
+}
+
+var _ = Describe("Resolver", func() {
+	var (
+		reader *countingReader
+		pod    *corev1.Pod
+	)
+
+	BeforeEach(func() {
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "app", UID: "deployment-uid"},
+		}
+		replicaSet := &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "api-7d9f8c6b5",
+				Namespace:       "app",
+				UID:             "replicaset-uid",
+				OwnerReferences: []metav1.OwnerReference{controllerReference("apps/v1", "Deployment", "api", "deployment-uid")},
+			},
+		}
+		pod = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "api-7d9f8c6b5-xk2lp",
+				Namespace:       "app",
+				OwnerReferences: []metav1.OwnerReference{controllerReference("apps/v1", "ReplicaSet", "api-7d9f8c6b5", "replicaset-uid")},
+			},
+		}
+
+		reader = &countingReader{
+			Reader: fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(deployment, replicaSet).Build(),
+		}
+	})
+
+	It("resolves the top-level controller and caches it", func() {
+		resolver := NewResolver(reader, time.Minute)
+
+		owner, err := resolver.Resolve(context.Background(), pod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(owner).To(Equal(&tracking.Owner{APIVersion: "apps/v1", Kind: "Deployment", Name: "api", UID: "deployment-uid"}))
+		gets := reader.gets
+
+		owner, err = resolver.Resolve(context.Background(), pod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(owner.Name).To(Equal("api"))
+		Expect(reader.gets).To(Equal(gets))
+	})
+
+	It("stops at owners which can't be looked up", func() {
+		pod.OwnerReferences = []metav1.OwnerReference{controllerReference("example.com/v1", "Workload", "api", "workload-uid")}
+
+		owner, err := NewResolver(reader, time.Minute).Resolve(context.Background(), pod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(owner).To(Equal(&tracking.Owner{APIVersion: "example.com/v1", Kind: "Workload", Name: "api", UID: "workload-uid"}))
+	})
+
+	It("returns nil for pods without a controller", func() {
+		pod.OwnerReferences = nil
+
+		owner, err := NewResolver(reader, time.Minute).Resolve(context.Background(), pod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(owner).To(BeNil())
+	})
+})
@@ -0,0 +1,243 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+// Client is a connection from PodTracker to a single external writer plugin.
+//
+// The connection is established lazily on the first call to Write: the client performs the handshake, verifies that the
+// plugin reports itself as healthy and then opens a long-lived Write stream. If the stream breaks, it is re-established on the next Write.
+type Client struct {
+	mu sync.Mutex
+
+	conn     *grpc.ClientConn
+	stream   grpc.ClientStream
+	cancel   context.CancelFunc
+	sequence uint64
+
+	// PluginName is the name reported by the plugin during the handshake
+	PluginName string
+	// ProtocolVersion is the protocol version negotiated during the handshake
+	ProtocolVersion uint32
+	// RecordTypes are the types of records other than PodInfo that the plugin reported it writes during the handshake
+	RecordTypes []string
+}
+
+// NewClient creates a new Client for the plugin listening on the provided target.
+// The target uses gRPC naming syntax, e.g. "unix:///var/run/podtracker/plugin.sock" or "localhost:9090"
+func NewClient(target string, opts ...grpc.DialOption) (*Client, error) {
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{conn: conn}, nil
+}
+
+// ErrUnsupportedRecord is returned by Client.Write for records which are not written by the plugin
+var ErrUnsupportedRecord = errors.New("plugin does not write records of this type")
+
+// Write sends the provided record to the plugin and blocks until the plugin acknowledges it or the context is done.
+// A non-nil error is returned if the record could not be delivered or if the plugin reported a failure to write it.
+// Records other than PodInfo are skipped for plugins which don't write them, in which case ErrUnsupportedRecord is returned
+func (c *Client) Write(ctx context.Context, record tracking.Record) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stream == nil {
+		if err := c.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	req := &WriteRequest{}
+	switch r := record.(type) {
+	case *tracking.PodInfo:
+		req.Record = r
+	case *tracking.ServiceRecord:
+		if !c.writes(tracking.ServiceRecordType) {
+			return ErrUnsupportedRecord
+		}
+		req.ServiceRecord = r
+	case *tracking.NodeRecord:
+		if !c.writes(tracking.NodeRecordType) {
+			return ErrUnsupportedRecord
+		}
+		req.NodeRecord = r
+	case *tracking.ResourceRecord:
+		if !c.writes(tracking.ResourceRecordType) {
+			return ErrUnsupportedRecord
+		}
+		req.ResourceRecord = r
+	case *tracking.InventoryRecord:
+		if !c.writes(tracking.InventoryRecordType) {
+			return ErrUnsupportedRecord
+		}
+		req.InventoryRecord = r
+	default:
+		return fmt.Errorf("plugin %q can't write records of type %T", c.PluginName, record)
+	}
+
+	c.sequence++
+	req.Sequence = c.sequence
+	stream := c.stream
+
+	result := make(chan error, 1)
+	go func() {
+		if err := stream.SendMsg(req); err != nil {
+			result <- err
+			return
+		}
+
+		ack := &WriteAck{}
+		if err := stream.RecvMsg(ack); err != nil {
+			result <- err
+			return
+		}
+		if ack.Sequence != req.Sequence {
+			result <- fmt.Errorf("plugin acknowledged sequence %d, expected %d", ack.Sequence, req.Sequence)
+			return
+		}
+		if ack.Error != "" {
+			// the stream is still usable, the plugin simply could not write this record
+			result <- &WriteError{Plugin: c.PluginName, Message: ack.Error}
+			return
+		}
+		result <- nil
+	}()
+
+	select {
+	case err := <-result:
+		if _, isWriteErr := err.(*WriteError); err != nil && !isWriteErr {
+			c.reset()
+			return fmt.Errorf("plugin %q stream failed: %w", c.PluginName, err)
+		}
+		return err
+	case <-ctx.Done():
+		// the acknowledgement may still arrive, so the stream can no longer be trusted to be in sync
+		c.reset()
+		return fmt.Errorf("plugin %q did not acknowledge write: %w", c.PluginName, ctx.Err())
+	}
+}
+
+// Close tears down any open stream and closes the underlying connection
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stream != nil {
+		_ = c.stream.CloseSend()
+	}
+	c.reset()
+	return c.conn.Close()
+}
+
+// connect performs the handshake and health check and opens the Write stream
+func (c *Client) connect(ctx context.Context) error {
+	resp := &HandshakeResponse{}
+	if err := c.conn.Invoke(ctx, handshakeMethod, &HandshakeRequest{
+		ProtocolVersions: SupportedProtocolVersions,
+		ClientName:       "podtracker",
+	}, resp, grpc.CallContentSubtype(CodecName)); err != nil {
+		return fmt.Errorf("plugin handshake failed: %w", err)
+	}
+	if _, ok := negotiateVersion([]uint32{resp.ProtocolVersion}, SupportedProtocolVersions); !ok {
+		return fmt.Errorf("plugin %q selected unsupported protocol version %d", resp.PluginName, resp.ProtocolVersion)
+	}
+	c.PluginName = resp.PluginName
+	c.ProtocolVersion = resp.ProtocolVersion
+	c.RecordTypes = nil
+	if resp.ProtocolVersion >= ProtocolVersion {
+		c.RecordTypes = resp.RecordTypes
+	}
+
+	health, err := healthpb.NewHealthClient(c.conn).Check(ctx, &healthpb.HealthCheckRequest{Service: ServiceName})
+	if err != nil {
+		return fmt.Errorf("plugin %q health check failed: %w", c.PluginName, err)
+	}
+	if health.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("plugin %q is not serving (status: %s)", c.PluginName, health.GetStatus())
+	}
+
+	// the stream outlives the context of the write that opened it, so it gets its own context
+	streamCtx, cancel := context.WithCancel(context.Background())
+	streamCtx = metadata.AppendToOutgoingContext(streamCtx, ProtocolVersionMetadataKey, strconv.FormatUint(uint64(c.ProtocolVersion), 10))
+
+	stream, err := c.conn.NewStream(streamCtx, &serviceDesc.Streams[0], writeMethod, grpc.CallContentSubtype(CodecName))
+	if err != nil {
+		cancel()
+		return fmt.Errorf("unable to open write stream to plugin %q: %w", c.PluginName, err)
+	}
+
+	c.stream = stream
+	c.cancel = cancel
+	c.sequence = 0
+	return nil
+}
+
+// writes returns true if the plugin reported that it writes records of the provided type
+func (c *Client) writes(recordType string) bool {
+	for _, t := range c.RecordTypes {
+		if t == recordType {
+			return true
+		}
+	}
+	return false
+}
+
+// reset discards the current stream so that a new one is established on the next write
+func (c *Client) reset() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.stream = nil
+	c.cancel = nil
+}
+
+// WriteError is returned when a plugin acknowledged a record but reported that it failed to write it
+type WriteError struct {
+	Plugin  string
+	Message string
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("plugin %q failed to write record: %s", e.Plugin, e.Message)
+}
@@ -0,0 +1,137 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package plugin
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc/encoding"
+
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+const (
+	// ServiceName is the fully qualified name of the gRPC service that external writer plugins must serve.
+	// It is also the service name reported through the standard gRPC health checking protocol
+	ServiceName = "podtracker.plugin.v1.WriterPlugin"
+
+	// ProtocolVersion is the latest version of the plugin protocol understood by PodTracker.
+	// Version 2 adds ServiceRecords, NodeRecords, ResourceRecords and InventoryRecords to the Write stream, version 1 only carries PodInfo records
+	ProtocolVersion uint32 = 2
+
+	// podInfoProtocolVersion is the plugin protocol version which only carries PodInfo records
+	podInfoProtocolVersion uint32 = 1
+
+	// ProtocolVersionMetadataKey is the gRPC metadata key used to carry the negotiated protocol version on every Write stream
+	ProtocolVersionMetadataKey = "podtracker-protocol-version"
+
+	// CodecName is the gRPC content-subtype used for all plugin messages.
+	// Messages are encoded as JSON so that PodInfo keeps the same shape on the wire as it does for every other writer
+	CodecName = "json"
+
+	handshakeMethod = "/" + ServiceName + "/Handshake"
+	writeMethod     = "/" + ServiceName + "/Write"
+)
+
+// SupportedProtocolVersions lists every plugin protocol version that PodTracker can speak, in order of preference
+var SupportedProtocolVersions = []uint32{ProtocolVersion, podInfoProtocolVersion}
+
+// HandshakeRequest is sent by PodTracker when it first connects to a plugin to negotiate a protocol version
+type HandshakeRequest struct {
+	// ProtocolVersions is the list of protocol versions the client supports
+	ProtocolVersions []uint32 `json:"protocolVersions"`
+	// ClientName identifies the connecting client (typically "podtracker")
+	ClientName string `json:"clientName,omitempty"`
+}
+
+// HandshakeResponse is returned by a plugin and contains the protocol version selected for the connection
+type HandshakeResponse struct {
+	// ProtocolVersion is the protocol version selected by the plugin. It must be one of the versions offered in the HandshakeRequest
+	ProtocolVersion uint32 `json:"protocolVersion"`
+	// PluginName is a human readable name for the plugin, used in logs and errors
+	PluginName string `json:"pluginName,omitempty"`
+	// RecordTypes are the types of records other than PodInfo that the plugin writes (e.g. "Service", "Node", "Resource").
+	// Records of other types are not sent to the plugin. It is only used on protocol version 2 and above
+	RecordTypes []string `json:"recordTypes,omitempty"`
+}
+
+// WriteRequest carries a single PodInfo, ServiceRecord, NodeRecord, ResourceRecord or InventoryRecord on the Write stream
+type WriteRequest struct {
+	// Sequence is a per-stream counter used to correlate a WriteRequest with its WriteAck
+	Sequence uint64 `json:"sequence"`
+	// Record is the PodInfo record to be written by the plugin
+	Record *tracking.PodInfo `json:"record,omitempty"`
+	// ServiceRecord is the ServiceRecord to be written by the plugin. It is only sent on protocol version 2 and above
+	ServiceRecord *tracking.ServiceRecord `json:"serviceRecord,omitempty"`
+	// NodeRecord is the NodeRecord to be written by the plugin. It is only sent on protocol version 2 and above
+	NodeRecord *tracking.NodeRecord `json:"nodeRecord,omitempty"`
+	// ResourceRecord is the ResourceRecord to be written by the plugin. It is only sent on protocol version 2 and above
+	ResourceRecord *tracking.ResourceRecord `json:"resourceRecord,omitempty"`
+	// InventoryRecord is the InventoryRecord to be written by the plugin. It is only sent on protocol version 2 and above
+	InventoryRecord *tracking.InventoryRecord `json:"inventoryRecord,omitempty"`
+}
+
+// WriteAck is sent by a plugin once it has handled the WriteRequest with the same Sequence
+type WriteAck struct {
+	// Sequence is the sequence number of the acknowledged WriteRequest
+	Sequence uint64 `json:"sequence"`
+	// Error is a non-empty description of the failure if the plugin could not write the record
+	Error string `json:"error,omitempty"`
+}
+
+// jsonCodec implements encoding.Codec to marshal plugin messages as JSON
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return CodecName
+}
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// negotiateVersion returns the highest protocol version that is contained in both offered and supported
+func negotiateVersion(offered []uint32, supported []uint32) (uint32, bool) {
+	var selected uint32
+	for _, o := range offered {
+		for _, s := range supported {
+			if o == s && o > selected {
+				selected = o
+			}
+		}
+	}
+	return selected, selected != 0
+}
@@ -0,0 +1,110 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+// Package reference contains a minimal external writer plugin. It serves as an example for plugin authors
+// and is used to exercise the plugin protocol in tests.
+package reference
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/gccloudone-aurora/podtracker/internal/plugin"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+// Plugin writes every PodInfo, ServiceRecord, NodeRecord, ResourceRecord and InventoryRecord it receives as a line of JSON to Out
+type Plugin struct {
+	mu sync.Mutex
+
+	// Out is where records are written to
+	Out io.Writer
+
+	// Reject, if set, is called for every record. A non-nil error is returned to PodTracker instead of writing the record
+	Reject func(*tracking.PodInfo) error
+}
+
+// Blank assignments to ensure that Plugin implements plugin.Handler and the optional handlers of the other record types
+var (
+	_ plugin.Handler          = &Plugin{}
+	_ plugin.ServiceHandler   = &Plugin{}
+	_ plugin.NodeHandler      = &Plugin{}
+	_ plugin.ResourceHandler  = &Plugin{}
+	_ plugin.InventoryHandler = &Plugin{}
+)
+
+// Name implements plugin.Handler
+func (p *Plugin) Name() string {
+	return "reference"
+}
+
+// Write implements plugin.Handler
+func (p *Plugin) Write(_ context.Context, info *tracking.PodInfo) error {
+	if p.Reject != nil {
+		if err := p.Reject(info); err != nil {
+			return err
+		}
+	}
+
+	return p.writeJSON(info)
+}
+
+// WriteService implements plugin.ServiceHandler
+func (p *Plugin) WriteService(_ context.Context, record *tracking.ServiceRecord) error {
+	return p.writeJSON(record)
+}
+
+// WriteNode implements plugin.NodeHandler
+func (p *Plugin) WriteNode(_ context.Context, record *tracking.NodeRecord) error {
+	return p.writeJSON(record)
+}
+
+// WriteResource implements plugin.ResourceHandler
+func (p *Plugin) WriteResource(_ context.Context, record *tracking.ResourceRecord) error {
+	return p.writeJSON(record)
+}
+
+// WriteInventory implements plugin.InventoryHandler
+func (p *Plugin) WriteInventory(_ context.Context, record *tracking.InventoryRecord) error {
+	return p.writeJSON(record)
+}
+
+// writeJSON writes the provided record as a line of JSON to Out
+func (p *Plugin) writeJSON(record interface{}) error {
+	resp, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err = p.Out.Write(append(resp, byte('\n')))
+	return err
+}
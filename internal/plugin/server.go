@@ -0,0 +1,266 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+// Handler is implemented by external writer plugins. It is the only piece of the plugin protocol that a plugin author
+// needs to provide - handshakes, health checking and acknowledgements are handled by the Server
+type Handler interface {
+	// Name returns a human readable name for the plugin
+	Name() string
+
+	// Write persists a single PodInfo record. A returned error is reported back to PodTracker in the WriteAck
+	// and causes the originating reconcile to be retried
+	Write(ctx context.Context, info *tracking.PodInfo) error
+}
+
+// ServiceHandler is optionally implemented by Handlers which write ServiceRecords.
+// ServiceRecords are only sent to plugins whose Handler implements it
+type ServiceHandler interface {
+	// WriteService persists a single ServiceRecord. A returned error is reported back to PodTracker in the WriteAck
+	WriteService(ctx context.Context, record *tracking.ServiceRecord) error
+}
+
+// NodeHandler is optionally implemented by Handlers which write NodeRecords.
+// NodeRecords are only sent to plugins whose Handler implements it
+type NodeHandler interface {
+	// WriteNode persists a single NodeRecord. A returned error is reported back to PodTracker in the WriteAck
+	WriteNode(ctx context.Context, record *tracking.NodeRecord) error
+}
+
+// ResourceHandler is optionally implemented by Handlers which write ResourceRecords.
+// ResourceRecords are only sent to plugins whose Handler implements it
+type ResourceHandler interface {
+	// WriteResource persists a single ResourceRecord. A returned error is reported back to PodTracker in the WriteAck
+	WriteResource(ctx context.Context, record *tracking.ResourceRecord) error
+}
+
+// InventoryHandler is optionally implemented by Handlers which write InventoryRecords.
+// InventoryRecords are only sent to plugins whose Handler implements it
+type InventoryHandler interface {
+	// WriteInventory persists a single InventoryRecord. A returned error is reported back to PodTracker in the WriteAck
+	WriteInventory(ctx context.Context, record *tracking.InventoryRecord) error
+}
+
+// writerPluginServer is the server-side API of the WriterPlugin gRPC service
+type writerPluginServer interface {
+	handshake(context.Context, *HandshakeRequest) (*HandshakeResponse, error)
+	write(grpc.ServerStream) error
+}
+
+// serviceDesc describes the WriterPlugin gRPC service
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*writerPluginServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Handshake",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := &HandshakeRequest{}
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(writerPluginServer).handshake(ctx, req)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: handshakeMethod}
+				return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(writerPluginServer).handshake(ctx, req.(*HandshakeRequest))
+				})
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Write",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(writerPluginServer).write(stream)
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
+
+// Server adapts a Handler to the WriterPlugin gRPC service
+type Server struct {
+	handler Handler
+}
+
+// A blank assignment to ensure that Server implements writerPluginServer
+var _ writerPluginServer = &Server{}
+
+// NewServer creates a gRPC server which serves the WriterPlugin service and the standard gRPC health service using the provided Handler
+func NewServer(handler Handler, opts ...grpc.ServerOption) *grpc.Server {
+	srv := grpc.NewServer(opts...)
+	srv.RegisterService(&serviceDesc, &Server{handler: handler})
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, healthServer)
+
+	return srv
+}
+
+// recordTypes returns the types of records other than PodInfo that the Handler of the Server writes
+func (s *Server) recordTypes() []string {
+	recordTypes := []string{}
+	if _, ok := s.handler.(ServiceHandler); ok {
+		recordTypes = append(recordTypes, tracking.ServiceRecordType)
+	}
+	if _, ok := s.handler.(NodeHandler); ok {
+		recordTypes = append(recordTypes, tracking.NodeRecordType)
+	}
+	if _, ok := s.handler.(ResourceHandler); ok {
+		recordTypes = append(recordTypes, tracking.ResourceRecordType)
+	}
+	if _, ok := s.handler.(InventoryHandler); ok {
+		recordTypes = append(recordTypes, tracking.InventoryRecordType)
+	}
+	return recordTypes
+}
+
+// supportedVersions returns the protocol versions which the Handler of the Server can serve
+func (s *Server) supportedVersions() []uint32 {
+	if len(s.recordTypes()) > 0 {
+		return SupportedProtocolVersions
+	}
+	return []uint32{podInfoProtocolVersion}
+}
+
+func (s *Server) handshake(_ context.Context, req *HandshakeRequest) (*HandshakeResponse, error) {
+	version, ok := negotiateVersion(req.ProtocolVersions, s.supportedVersions())
+	if !ok {
+		return nil, status.Errorf(
+			codes.FailedPrecondition,
+			"no common protocol version: client supports %v, plugin supports %v", req.ProtocolVersions, s.supportedVersions(),
+		)
+	}
+
+	resp := &HandshakeResponse{
+		ProtocolVersion: version,
+		PluginName:      s.handler.Name(),
+	}
+	if version >= ProtocolVersion {
+		resp.RecordTypes = s.recordTypes()
+	}
+	return resp, nil
+}
+
+func (s *Server) write(stream grpc.ServerStream) error {
+	if err := s.checkStreamVersion(stream.Context()); err != nil {
+		return err
+	}
+
+	for {
+		req := &WriteRequest{}
+		if err := stream.RecvMsg(req); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		ack := &WriteAck{Sequence: req.Sequence}
+		if err := s.handle(stream.Context(), req); err != nil {
+			ack.Error = err.Error()
+		}
+
+		if err := stream.SendMsg(ack); err != nil {
+			return err
+		}
+	}
+}
+
+// handle passes the record of the WriteRequest to the Handler
+func (s *Server) handle(ctx context.Context, req *WriteRequest) error {
+	switch {
+	case req.Record != nil:
+		return s.handler.Write(ctx, req.Record)
+	case req.ServiceRecord != nil:
+		serviceHandler, ok := s.handler.(ServiceHandler)
+		if !ok {
+			return errors.New("plugin does not write service records")
+		}
+		return serviceHandler.WriteService(ctx, req.ServiceRecord)
+	case req.NodeRecord != nil:
+		nodeHandler, ok := s.handler.(NodeHandler)
+		if !ok {
+			return errors.New("plugin does not write node records")
+		}
+		return nodeHandler.WriteNode(ctx, req.NodeRecord)
+	case req.ResourceRecord != nil:
+		resourceHandler, ok := s.handler.(ResourceHandler)
+		if !ok {
+			return errors.New("plugin does not write resource records")
+		}
+		return resourceHandler.WriteResource(ctx, req.ResourceRecord)
+	case req.InventoryRecord != nil:
+		inventoryHandler, ok := s.handler.(InventoryHandler)
+		if !ok {
+			return errors.New("plugin does not write inventory records")
+		}
+		return inventoryHandler.WriteInventory(ctx, req.InventoryRecord)
+	default:
+		return errors.New("write request did not contain a record")
+	}
+}
+
+// checkStreamVersion ensures that the client has negotiated a protocol version supported by this server before it starts writing
+func (s *Server) checkStreamVersion(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(ProtocolVersionMetadataKey)
+	if len(values) == 0 {
+		return status.Error(codes.FailedPrecondition, "missing protocol version, a handshake must be performed before writing")
+	}
+
+	version, err := strconv.ParseUint(values[0], 10, 32)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid protocol version %q", values[0])
+	}
+	if _, ok := negotiateVersion([]uint32{uint32(version)}, s.supportedVersions()); !ok {
+		return status.Errorf(codes.FailedPrecondition, "unsupported protocol version %d", version)
+	}
+
+	return nil
+}
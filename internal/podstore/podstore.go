@@ -0,0 +1,430 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package podstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+const (
+	// minShardCount is the number of ConfigMaps the recorded Pods are spread across until they outgrow them
+	minShardCount = 16
+	// shardNamePrefix is the prefix of the names of the ConfigMaps the recorded Pods are stored in
+	shardNamePrefix = "podtracker-pods-"
+	// dataKey is the key of the ConfigMap data which holds the recorded Pods
+	dataKey = "pods.json"
+	// StoreLabel is set on the ConfigMaps the recorded Pods are stored in
+	StoreLabel = "networking.aurora.gc.ca/podtracker-store"
+)
+
+var (
+	// maxShardSize is the size of the recorded Pods of a ConfigMap above which the Pods are spread across more ConfigMaps.
+	// It leaves room for the rest of the ConfigMap below the size limit of Kubernetes objects (1 MiB)
+	maxShardSize = 900 * 1024
+	// maxShardCount is the largest number of ConfigMaps the recorded Pods are spread across
+	maxShardCount = 1024
+)
+
+// ErrStoreFull is returned when flushing the recorded Pods if they don't fit in maxShardCount ConfigMaps
+var ErrStoreFull = errors.New("the recorded pods don't fit in the store")
+
+// PodRecord is what is remembered about a recorded Pod, so that its deletion can be recorded if it vanishes while the controller is down
+type PodRecord struct {
+	Name              string      `json:"name"`
+	Namespace         string      `json:"namespace"`
+	Node              string      `json:"node,omitempty"`
+	PodIPs            []string    `json:"podIPs,omitempty"`
+	CreationTimestamp metav1.Time `json:"creationTimestamp"`
+	// IPAssignedTimestamp is when the Pod was assigned its IPs
+	IPAssignedTimestamp *metav1.MicroTime `json:"ipAssignedTimestamp,omitempty"`
+	// Released is true if the Pod has succeeded or failed and the release of its IPs has been recorded
+	Released bool `json:"released,omitempty"`
+}
+
+// Pod returns a Pod with the details of the PodRecord
+func (p PodRecord) Pod(uid types.UID) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              p.Name,
+			Namespace:         p.Namespace,
+			UID:               uid,
+			CreationTimestamp: p.CreationTimestamp,
+		},
+		Spec: corev1.PodSpec{NodeName: p.Node},
+	}
+	for _, ip := range p.PodIPs {
+		pod.Status.PodIPs = append(pod.Status.PodIPs, corev1.PodIP{IP: ip})
+	}
+	if len(p.PodIPs) > 0 {
+		pod.Status.PodIP = p.PodIPs[0]
+	}
+	if p.IPAssignedTimestamp != nil {
+		pod.Status.StartTime = &metav1.Time{Time: p.IPAssignedTimestamp.Time}
+	}
+	return pod
+}
+
+// Store persists the Pods which have been recorded without a finalizer in ConfigMaps, so that the Pods which vanish while the controller
+// is down can be detected when it starts again. It also remembers the Pods whose release has been recorded (whatever their tracking mode)
+// until they are deleted, so that they aren't recorded again. Changes are kept in memory and flushed periodically.
+type Store struct {
+	// Client writes the ConfigMaps
+	Client client.Client
+	// Reader reads the ConfigMaps when the Store is started. An uncached reader is preferred, so that ConfigMaps are not cached cluster-wide
+	Reader client.Reader
+	// Namespace is the namespace the ConfigMaps are stored in
+	Namespace string
+	// FlushInterval is the period in which changes are written to the ConfigMaps
+	FlushInterval time.Duration
+
+	mu      sync.Mutex
+	records map[types.UID]PodRecord
+	dirty   bool
+	// shardCount is the number of ConfigMaps the records are spread across. It grows with the records, so that no ConfigMap exceeds
+	// the size limit of Kubernetes objects, and never shrinks
+	shardCount int
+	// written is the data last written to (or loaded from) the ConfigMap of each shard, so that only the ConfigMaps which changed are written
+	written map[int]string
+	removed map[types.UID]bool
+	loaded  chan struct{}
+	once    sync.Once
+}
+
+// a blank assignment of Store as a manager.Runnable to ensure that the interface is implemented
+var _ manager.Runnable = &Store{}
+
+// init lazily initializes the in-memory state of the Store
+func (s *Store) init() {
+	s.once.Do(func() {
+		s.records = map[types.UID]PodRecord{}
+		s.shardCount = minShardCount
+		s.written = map[int]string{}
+		s.removed = map[types.UID]bool{}
+		s.loaded = make(chan struct{})
+	})
+}
+
+// shard returns the index of the shard the Pod with the provided UID is stored in, out of the provided number of shards
+func shard(uid types.UID, count int) int {
+	h := fnv.New32a()
+	h.Write([]byte(uid))
+	return int(h.Sum32() % uint32(count))
+}
+
+// Add remembers the provided Pod
+func (s *Store) Add(pod *corev1.Pod) {
+	s.add(pod, false)
+}
+
+// Release remembers that the release of the IPs of the provided Pod has been recorded, so that it isn't recorded again
+func (s *Store) Release(pod *corev1.Pod) {
+	s.add(pod, true)
+}
+
+// Get returns what is remembered about the Pod with the provided UID
+func (s *Store) Get(uid types.UID) (PodRecord, bool) {
+	s.init()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[uid]
+	return record, ok
+}
+
+func (s *Store) add(pod *corev1.Pod, released bool) {
+	s.init()
+	record := PodRecord{
+		Released:          released,
+		Name:              pod.GetName(),
+		Namespace:         pod.GetNamespace(),
+		Node:              pod.Spec.NodeName,
+		CreationTimestamp: pod.GetCreationTimestamp(),
+	}
+	for _, ip := range pod.Status.PodIPs {
+		record.PodIPs = append(record.PodIPs, ip.IP)
+	}
+	if len(record.PodIPs) == 0 && pod.Status.PodIP != "" {
+		record.PodIPs = []string{pod.Status.PodIP}
+	}
+	if assigned := tracking.IPAssignedTime(pod); len(record.PodIPs) > 0 && !assigned.IsZero() {
+		record.IPAssignedTimestamp = &metav1.MicroTime{Time: assigned}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.records[pod.GetUID()]; ok && equalRecords(existing, record) {
+		return
+	}
+	s.records[pod.GetUID()] = record
+	s.dirty = true
+	delete(s.removed, pod.GetUID())
+}
+
+// Remove forgets the Pod with the provided UID
+func (s *Store) Remove(uid types.UID) {
+	s.init()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.records[uid]; ok {
+		delete(s.records, uid)
+		s.dirty = true
+	}
+
+	// Pods removed before the ConfigMaps are loaded must not be restored by loading them
+	select {
+	case <-s.loaded:
+	default:
+		s.removed[uid] = true
+	}
+}
+
+// Loaded returns a channel which is closed once the ConfigMaps have been loaded
+func (s *Store) Loaded() <-chan struct{} {
+	s.init()
+	return s.loaded
+}
+
+// Records returns a copy of all the remembered Pods
+func (s *Store) Records() map[types.UID]PodRecord {
+	s.init()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := make(map[types.UID]PodRecord, len(s.records))
+	for uid, record := range s.records {
+		records[uid] = record
+	}
+	return records
+}
+
+// Start loads the ConfigMaps and periodically flushes changes to them until the provided context is cancelled
+func (s *Store) Start(ctx context.Context) error {
+	s.init()
+	sl := log.FromContext(ctx).WithName("podstore")
+
+	if err := s.load(ctx); err != nil {
+		return fmt.Errorf("unable to load recorded pods: %w", err)
+	}
+	close(s.loaded)
+	sl.Info("loaded recorded pods", "pods", len(s.Records()))
+
+	ticker := time.NewTicker(s.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Flush(ctx); err != nil {
+				sl.Error(err, "unable to flush recorded pods. will try again later")
+			}
+		case <-ctx.Done():
+			// flush once more so that the Pods recorded since the last flush are not lost
+			flushContext, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := s.Flush(flushContext); err != nil {
+				sl.Error(err, "unable to flush recorded pods")
+			}
+			return nil
+		}
+	}
+}
+
+// load reads the ConfigMaps into memory, keeping any change that has been made since the Store was created.
+// The ConfigMaps of the shards are written in order, so they are read until one is missing past the minimum number of shards
+func (s *Store) load(ctx context.Context) error {
+	for i := 0; ; i++ {
+		cm := &corev1.ConfigMap{}
+		if err := s.Reader.Get(ctx, types.NamespacedName{Name: shardName(i), Namespace: s.Namespace}, cm); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return err
+			}
+			if i < minShardCount {
+				// shards without any recorded Pod may not have been written
+				continue
+			}
+			break
+		}
+
+		records := map[types.UID]PodRecord{}
+		data, ok := cm.Data[dataKey]
+		if ok {
+			if err := json.Unmarshal([]byte(data), &records); err != nil {
+				return fmt.Errorf("unable to parse ConfigMap %s: %w", cm.GetName(), err)
+			}
+		}
+
+		s.mu.Lock()
+		s.written[i] = data
+		if i >= s.shardCount {
+			s.shardCount = i + 1
+		}
+		for uid, record := range records {
+			if _, ok := s.records[uid]; ok || s.removed[uid] {
+				s.dirty = true
+				continue
+			}
+			s.records[uid] = record
+		}
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	s.removed = map[types.UID]bool{}
+	s.mu.Unlock()
+	return nil
+}
+
+// Flush writes the shards which have changed to their ConfigMaps. It returns ErrStoreFull if the recorded Pods don't fit in the ConfigMaps
+func (s *Store) Flush(ctx context.Context) error {
+	s.init()
+
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	shards, err := s.encode()
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.dirty = false
+	s.mu.Unlock()
+
+	var errs []error
+	for i, data := range shards {
+		s.mu.Lock()
+		unchanged := s.written[i] == data
+		s.mu.Unlock()
+		if unchanged {
+			continue
+		}
+
+		if err := s.write(ctx, i, data); err != nil {
+			// mark the store as dirty again so that the shard is written on the next flush
+			s.mu.Lock()
+			s.dirty = true
+			s.mu.Unlock()
+			errs = append(errs, err)
+			continue
+		}
+		s.mu.Lock()
+		s.written[i] = data
+		s.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// encode spreads the recorded Pods across the shards and returns the data of each shard. The number of shards is doubled until the data
+// of every shard fits in a ConfigMap. The caller must hold the lock
+func (s *Store) encode() ([]string, error) {
+	for count := s.shardCount; count <= maxShardCount; count *= 2 {
+		shards := make([]map[types.UID]PodRecord, count)
+		for i := range shards {
+			shards[i] = map[types.UID]PodRecord{}
+		}
+		for uid, record := range s.records {
+			shards[shard(uid, count)][uid] = record
+		}
+
+		data := make([]string, count)
+		fits := true
+		for i := range shards {
+			encoded, err := json.Marshal(shards[i])
+			if err != nil {
+				return nil, err
+			}
+			if len(encoded) > maxShardSize {
+				fits = false
+				break
+			}
+			data[i] = string(encoded)
+		}
+		if fits {
+			s.shardCount = count
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %d pods exceed %d ConfigMaps of %d bytes", ErrStoreFull, len(s.records), maxShardCount, maxShardSize)
+}
+
+// write creates or updates the ConfigMap of a shard
+func (s *Store) write(ctx context.Context, i int, data string) error {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      shardName(i),
+			Namespace: s.Namespace,
+			Labels:    map[string]string{StoreLabel: "true"},
+		},
+		Data: map[string]string{dataKey: data},
+	}
+
+	if err := s.Client.Update(ctx, cm); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		return s.Client.Create(ctx, cm)
+	}
+	return nil
+}
+
+func shardName(i int) string {
+	return fmt.Sprintf("%s%d", shardNamePrefix, i)
+}
+
+func equalRecords(a, b PodRecord) bool {
+	if a.Name != b.Name || a.Namespace != b.Namespace || a.Node != b.Node || a.Released != b.Released || !a.CreationTimestamp.Equal(&b.CreationTimestamp) || !a.IPAssignedTimestamp.Equal(b.IPAssignedTimestamp) || len(a.PodIPs) != len(b.PodIPs) {
+		return false
+	}
+	for i := range a.PodIPs {
+		if a.PodIPs[i] != b.PodIPs[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,173 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package podstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newPod returns a running Pod with the provided UID
+func newPod(uid types.UID) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "api-" + string(uid), Namespace: "app", UID: uid},
+		Spec:       corev1.PodSpec{NodeName: "node-1"},
+		Status: corev1.PodStatus{
+			PodIP:     "10.244.0.17",
+			PodIPs:    []corev1.PodIP{{IP: "10.244.0.17"}},
+			StartTime: &metav1.Time{Time: time.Date(2026, 10, 19, 12, 0, 0, 250000, time.UTC)},
+		},
+	}
+}
+
+var _ = Describe("Store", func() {
+	var c client.Client
+
+	BeforeEach(func() {
+		c = fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+	})
+
+	// start starts a new Store and waits for it to be loaded
+	start := func(ctx context.Context) *Store {
+		store := &Store{Client: c, Reader: c, Namespace: "podtracker-system", FlushInterval: time.Hour}
+		go func() {
+			defer GinkgoRecover()
+			Expect(store.Start(ctx)).To(Succeed())
+		}()
+		Eventually(store.Loaded()).Should(BeClosed())
+		return store
+	}
+
+	It("persists the recorded pods across restarts", func(ctx SpecContext) {
+		runCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		store := start(runCtx)
+		store.Add(newPod("a"))
+		store.Add(newPod("b"))
+		store.Release(newPod("c"))
+		store.Remove("b")
+		Expect(store.Flush(ctx)).To(Succeed())
+
+		records := start(runCtx).Records()
+		Expect(records).To(HaveLen(2))
+		pod := records["a"].Pod("a")
+		Expect(pod.Status.StartTime.Equal(newPod("a").Status.StartTime)).To(BeTrue())
+		pod.Status.StartTime = nil
+		Expect(pod).To(Equal(&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "api-a", Namespace: "app", UID: "a"},
+			Spec:       corev1.PodSpec{NodeName: "node-1"},
+			Status:     corev1.PodStatus{PodIP: "10.244.0.17", PodIPs: []corev1.PodIP{{IP: "10.244.0.17"}}},
+		}))
+		Expect(records["c"].Released).To(BeTrue())
+	})
+
+	It("keeps the changes made before the pods are loaded", func(ctx SpecContext) {
+		runCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		store := start(runCtx)
+		store.Add(newPod("a"))
+		store.Add(newPod("b"))
+		Expect(store.Flush(ctx)).To(Succeed())
+
+		restarted := &Store{Client: c, Reader: c, Namespace: "podtracker-system", FlushInterval: time.Hour}
+		restarted.Remove("a")
+		restarted.Add(newPod("c"))
+		go func() {
+			defer GinkgoRecover()
+			Expect(restarted.Start(runCtx)).To(Succeed())
+		}()
+		Eventually(restarted.Loaded()).Should(BeClosed())
+
+		Expect(restarted.Records()).To(HaveLen(2))
+		Expect(restarted.Records()).To(HaveKey(types.UID("b")))
+		Expect(restarted.Records()).To(HaveKey(types.UID("c")))
+	})
+
+	Context("when the recorded pods outgrow the ConfigMaps", func() {
+		BeforeEach(func() {
+			// a shard holds only a few records
+			size := maxShardSize
+			maxShardSize = 1024
+			DeferCleanup(func() { maxShardSize = size })
+		})
+
+		It("spreads the recorded pods across more ConfigMaps", func(ctx SpecContext) {
+			runCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+
+			store := start(runCtx)
+			for i := 0; i < 200; i++ {
+				store.Add(newPod(types.UID(fmt.Sprintf("pod-%d", i))))
+			}
+			Expect(store.Flush(ctx)).To(Succeed())
+
+			configMaps := &corev1.ConfigMapList{}
+			Expect(c.List(ctx, configMaps, client.InNamespace("podtracker-system"))).To(Succeed())
+			Expect(len(configMaps.Items)).To(BeNumerically(">", minShardCount))
+			for _, cm := range configMaps.Items {
+				Expect(len(cm.Data[dataKey])).To(BeNumerically("<=", maxShardSize))
+			}
+
+			Expect(start(runCtx).Records()).To(HaveLen(200))
+		})
+
+		It("returns an error once the recorded pods don't fit in the ConfigMaps", func(ctx SpecContext) {
+			count := maxShardCount
+			maxShardCount = minShardCount
+			DeferCleanup(func() { maxShardCount = count })
+
+			runCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+
+			store := start(runCtx)
+			for i := 0; i < 200; i++ {
+				store.Add(newPod(types.UID(fmt.Sprintf("pod-%d", i))))
+			}
+			Expect(store.Flush(ctx)).To(MatchError(ErrStoreFull))
+
+			// the records are kept, and written once they fit again
+			for i := 10; i < 200; i++ {
+				store.Remove(types.UID(fmt.Sprintf("pod-%d", i)))
+			}
+			Expect(store.Flush(ctx)).To(Succeed())
+			Expect(start(runCtx).Records()).To(HaveLen(10))
+		})
+	})
+})
@@ -0,0 +1,299 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gobwas/glob"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// EnrichmentConfig selects the optional Pod details which are recorded in addition to the network configuration of the Pod.
+// Every detail is disabled by default so that records stay small
+// +kubebuilder:object:generate=true
+type EnrichmentConfig struct {
+	// ServiceAccount records the name of the service account the Pod runs as
+	//+optional
+	ServiceAccount bool `json:"serviceAccount,omitempty"`
+
+	// Containers records the name of every container (including init containers) of the Pod
+	//+optional
+	Containers bool `json:"containers,omitempty"`
+
+	// Images records the image of every container, along with the digest of the image that was resolved by the container runtime.
+	// Requires containers
+	//+optional
+	Images bool `json:"images,omitempty"`
+
+	// Ports records the ports declared by every container. Requires containers
+	//+optional
+	Ports bool `json:"ports,omitempty"`
+
+	// HostNamespaces records whether the Pod uses the host's network and PID namespaces
+	//+optional
+	HostNamespaces bool `json:"hostNamespaces,omitempty"`
+
+	// Services records the Services fronting the Pod (with their cluster IPs and ports), from the EndpointSlices referencing the Pod
+	//+optional
+	Services bool `json:"services,omitempty"`
+
+	// NetworkPolicies records the NetworkPolicies selecting the Pod, and whether its ingress and egress traffic is isolated,
+	// when the Pod is created (i.e. when it is assigned its IPs)
+	//+optional
+	NetworkPolicies bool `json:"networkPolicies,omitempty"`
+
+	// Node selects details of the Node the Pod is assigned to
+	//+optional
+	Node *NodeEnrichment `json:"node,omitempty"`
+}
+
+// NodeEnrichment selects the details of the Node a Pod is assigned to which are recorded
+// +kubebuilder:object:generate=true
+type NodeEnrichment struct {
+	// Topology records the zone, region and instance type of the Node (from the well-known topology labels)
+	//+optional
+	Topology bool `json:"topology,omitempty"`
+
+	// Labels is a list of additional Node labels to record. Every entry accepts a (globbable) key, e.g. "node.example.com/*"
+	//+optional
+	Labels []string `json:"labels,omitempty"`
+
+	// PodCIDRs records the Pod IP ranges assigned to the Node
+	//+optional
+	PodCIDRs bool `json:"podCIDRs,omitempty"`
+
+	// compiledLabels holds the compiled label patterns, once the NodeEnrichment has been compiled (see EnrichmentConfig.Compile)
+	compiledLabels *compiledNodeLabels `json:"-"`
+}
+
+// compiledNodeLabels holds the compiled label patterns of a NodeEnrichment
+type compiledNodeLabels struct {
+	globs []glob.Glob
+}
+
+// DeepCopyInto copies the compiled patterns into out. Compiled patterns are never modified, so the copies share them
+func (in *compiledNodeLabels) DeepCopyInto(out *compiledNodeLabels) {
+	*out = *in
+}
+
+// NodeTopology describes where a Node runs
+type NodeTopology struct {
+	Zone         string `json:"zone,omitempty"`
+	Region       string `json:"region,omitempty"`
+	InstanceType string `json:"instanceType,omitempty"`
+}
+
+// ContainerInfo describes a container of a Pod. Which fields are set depends on the EnrichmentConfig of the PodTracker
+type ContainerInfo struct {
+	Name        string          `json:"name"`
+	Init        bool            `json:"init,omitempty"`
+	Image       string          `json:"image,omitempty"`
+	ImageDigest string          `json:"imageDigest,omitempty"`
+	Ports       []ContainerPort `json:"ports,omitempty"`
+}
+
+// ContainerPort is a port declared by a container
+type ContainerPort struct {
+	Name     string          `json:"name,omitempty"`
+	Port     int32           `json:"port"`
+	Protocol corev1.Protocol `json:"protocol,omitempty"`
+	HostPort int32           `json:"hostPort,omitempty"`
+}
+
+// imageDigest returns the digest of the image reported by the container runtime (e.g. "docker.io/library/nginx@sha256:...").
+// Runtimes that don't report a digest are recorded with the image ID as-is
+func imageDigest(imageID string) string {
+	if _, digest, ok := strings.Cut(imageID, "@"); ok {
+		return digest
+	}
+	return imageID
+}
+
+// nodeTopology returns the topology of the Node from its well-known labels, or nil if none of them are set
+func nodeTopology(node *corev1.Node) *NodeTopology {
+	labels := node.GetLabels()
+	topology := NodeTopology{
+		Zone:         labels[corev1.LabelTopologyZone],
+		Region:       labels[corev1.LabelTopologyRegion],
+		InstanceType: labels[corev1.LabelInstanceTypeStable],
+	}
+	if topology == (NodeTopology{}) {
+		return nil
+	}
+	return &topology
+}
+
+// nodePodCIDRs returns the Pod IP ranges assigned to the Node. Older API servers may only set the singular PodCIDR
+func nodePodCIDRs(node *corev1.Node) []string {
+	if len(node.Spec.PodCIDRs) == 0 && node.Spec.PodCIDR != "" {
+		return []string{node.Spec.PodCIDR}
+	}
+	return node.Spec.PodCIDRs
+}
+
+// containers returns the init containers and containers of the Pod, with their images as resolved by the container runtime (if known)
+func containers(pod *corev1.Pod) []ContainerInfo {
+	imageIDs := map[string]string{}
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			imageIDs[status.Name] = status.ImageID
+		}
+	}
+
+	infos := []ContainerInfo{}
+	add := func(container corev1.Container, init bool) {
+		info := ContainerInfo{
+			Name:        container.Name,
+			Init:        init,
+			Image:       container.Image,
+			ImageDigest: imageDigest(imageIDs[container.Name]),
+		}
+		for _, port := range container.Ports {
+			info.Ports = append(info.Ports, ContainerPort{
+				Name:     port.Name,
+				Port:     port.ContainerPort,
+				Protocol: port.Protocol,
+				HostPort: port.HostPort,
+			})
+		}
+		infos = append(infos, info)
+	}
+
+	for _, container := range pod.Spec.InitContainers {
+		add(container, true)
+	}
+	for _, container := range pod.Spec.Containers {
+		add(container, false)
+	}
+
+	return infos
+}
+
+// Enrich removes the details which are not enabled by the EnrichmentConfig from the provided PodInfo.
+// The containers of the PodInfo are replaced with copies, so the slice that they referenced originally is never modified.
+// An error is returned if any of the Node label patterns is not a valid glob
+func (e *EnrichmentConfig) Enrich(info *PodInfo) error {
+	if e == nil {
+		e = &EnrichmentConfig{}
+	}
+
+	if !e.ServiceAccount {
+		info.ServiceAccount = ""
+	}
+	if !e.HostNamespaces {
+		info.HostNetwork = nil
+		info.HostPID = nil
+	}
+	if !e.Services {
+		info.Services = nil
+		info.PreviousServices = nil
+	}
+	if !e.NetworkPolicies {
+		info.NetworkPolicies = nil
+	}
+	if err := e.Node.enrich(info); err != nil {
+		return err
+	}
+
+	// images and ports are details of the containers, which are only recorded along with them
+	if !e.Containers {
+		info.Containers = nil
+		return nil
+	}
+
+	enriched := make([]ContainerInfo, 0, len(info.Containers))
+	for _, container := range info.Containers {
+		if !e.Images {
+			container.Image = ""
+			container.ImageDigest = ""
+		}
+		if !e.Ports {
+			container.Ports = nil
+		}
+		enriched = append(enriched, container)
+	}
+	info.Containers = enriched
+	return nil
+}
+
+// enrich removes the Node details which are not enabled by the NodeEnrichment from the provided PodInfo.
+// The Node labels of the PodInfo are replaced with a filtered copy, so the map that they referenced originally is never modified
+func (n *NodeEnrichment) enrich(info *PodInfo) error {
+	if n == nil {
+		n = &NodeEnrichment{}
+	}
+
+	if !n.Topology {
+		info.NodeTopology = nil
+	}
+	if !n.PodCIDRs {
+		info.NodePodCIDRs = nil
+	}
+
+	compiled := n.compiledLabels
+	if compiled == nil {
+		var err error
+		if compiled, err = n.compileLabels(); err != nil {
+			return fmt.Errorf("unable to enrich node labels: %w", err)
+		}
+	}
+
+	var labels map[string]string
+	for key, value := range info.NodeLabels {
+		if keyMatches(key, compiled.globs) {
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			labels[key] = value
+		}
+	}
+	info.NodeLabels = labels
+	return nil
+}
+
+// compileLabels compiles the label patterns of the NodeEnrichment
+func (n *NodeEnrichment) compileLabels() (*compiledNodeLabels, error) {
+	globs, err := compileKeyPatterns(n.Labels)
+	if err != nil {
+		return nil, err
+	}
+	return &compiledNodeLabels{globs: globs}, nil
+}
+
+// Compile compiles the Node label patterns of the EnrichmentConfig once, so that they aren't compiled again for every record enriched
+// with it (or with its deep copies). The patterns are left uncompiled if any of them is not a valid glob, so that Enrich keeps reporting the error
+func (e *EnrichmentConfig) Compile() {
+	if e == nil || e.Node == nil {
+		return
+	}
+	if compiled, err := e.Node.compileLabels(); err == nil {
+		e.Node.compiledLabels = compiled
+	}
+}
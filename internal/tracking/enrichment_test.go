@@ -0,0 +1,128 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("EnrichmentConfig", func() {
+	var info *PodInfo
+
+	BeforeEach(func() {
+		info = New(&PodInfoConfig{
+			Pod: &corev1.Pod{
+				Spec: corev1.PodSpec{
+					ServiceAccountName: "api",
+					HostNetwork:        true,
+					InitContainers:     []corev1.Container{{Name: "migrate", Image: "migrate:1.2"}},
+					Containers: []corev1.Container{{
+						Name:  "api",
+						Image: "nginx:1.27",
+						Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080, Protocol: corev1.ProtocolTCP}},
+					}},
+				},
+				Status: corev1.PodStatus{
+					ContainerStatuses: []corev1.ContainerStatus{
+						{Name: "api", ImageID: "docker.io/library/nginx@sha256:0ab1"},
+					},
+				},
+			},
+			Node: &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						corev1.LabelTopologyZone:   "canadacentral-1",
+						corev1.LabelTopologyRegion: "canadacentral",
+						"node.example.com/pool":    "system",
+						"kubernetes.io/os":         "linux",
+					},
+				},
+				Spec: corev1.NodeSpec{PodCIDR: "10.244.0.0/24"},
+			},
+			Event: PodCreateEvent,
+		})
+	})
+
+	It("records nothing unless enabled", func() {
+		var enrichment *EnrichmentConfig
+		Expect(enrichment.Enrich(info)).To(Succeed())
+
+		Expect(info.ServiceAccount).To(BeEmpty())
+		Expect(info.Containers).To(BeNil())
+		Expect(info.HostNetwork).To(BeNil())
+		Expect(info.HostPID).To(BeNil())
+		Expect(info.NodeTopology).To(BeNil())
+		Expect(info.NodeLabels).To(BeNil())
+		Expect(info.NodePodCIDRs).To(BeNil())
+	})
+
+	It("records the enabled details only", func() {
+		original := info.Containers
+		Expect((&EnrichmentConfig{Containers: true, Images: true, HostNamespaces: true}).Enrich(info)).To(Succeed())
+
+		Expect(*info.HostNetwork).To(BeTrue())
+		Expect(*info.HostPID).To(BeFalse())
+		Expect(info.Containers).To(Equal([]ContainerInfo{
+			{Name: "migrate", Init: true, Image: "migrate:1.2"},
+			{Name: "api", Image: "nginx:1.27", ImageDigest: "sha256:0ab1"},
+		}))
+		Expect(original[1].Ports).To(HaveLen(1))
+	})
+
+	It("records images and ports only along with containers", func() {
+		Expect((&EnrichmentConfig{Images: true, Ports: true}).Enrich(info)).To(Succeed())
+		Expect(info.Containers).To(BeNil())
+	})
+
+	It("records the enabled node details", func() {
+		Expect((&EnrichmentConfig{Node: &NodeEnrichment{Topology: true, PodCIDRs: true, Labels: []string{"node.example.com/*"}}}).Enrich(info)).To(Succeed())
+
+		Expect(info.NodeTopology).To(Equal(&NodeTopology{Zone: "canadacentral-1", Region: "canadacentral"}))
+		Expect(info.NodeLabels).To(Equal(map[string]string{"node.example.com/pool": "system"}))
+		Expect(info.NodePodCIDRs).To(Equal([]string{"10.244.0.0/24"}))
+	})
+
+	It("records the Node labels matching the compiled patterns", func() {
+		enrichment := &EnrichmentConfig{Node: &NodeEnrichment{Labels: []string{"node.example.com/*"}}}
+		enrichment.Compile()
+		Expect(enrichment.Node.compiledLabels).NotTo(BeNil())
+
+		Expect(enrichment.DeepCopy().Enrich(info)).To(Succeed())
+		Expect(info.NodeLabels).To(Equal(map[string]string{"node.example.com/pool": "system"}))
+	})
+
+	It("returns an error for invalid Node label patterns, which are left uncompiled", func() {
+		enrichment := &EnrichmentConfig{Node: &NodeEnrichment{Labels: []string{"node-["}}}
+		enrichment.Compile()
+		Expect(enrichment.Node.compiledLabels).To(BeNil())
+		Expect(enrichment.Enrich(info)).NotTo(Succeed())
+	})
+})
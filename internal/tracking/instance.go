@@ -0,0 +1,72 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import "sync/atomic"
+
+// Instance identifies the cluster and the controller process that records are emitted by, so that the records of several clusters
+// can be told apart once they are shipped to the same backend
+type Instance struct {
+	// ClusterName is a human readable name for the cluster
+	ClusterName string
+	// ClusterID uniquely identifies the cluster (by default, the UID of the kube-system namespace)
+	ClusterID string
+	// Controller is the name of the controller Pod
+	Controller string
+
+	sequence atomic.Uint64
+}
+
+// InstanceInfo holds the cluster and controller details that every record is stamped with (see Instance)
+type InstanceInfo struct {
+	ClusterName        string `json:"clusterName,omitempty"`
+	ClusterID          string `json:"clusterID,omitempty"`
+	Controller         string `json:"controller,omitempty"`
+	ControllerSequence uint64 `json:"controllerSequence,omitempty"`
+}
+
+// instanceInfo implements Record for every record which embeds an InstanceInfo
+func (i *InstanceInfo) instanceInfo() *InstanceInfo {
+	return i
+}
+
+// Stamp sets the cluster and controller details of the Instance on the provided record, along with the next sequence number of the process.
+// Sequence numbers are monotonic within a process, so they restart whenever the controller does. Records are stamped once they have been
+// projected for a PodTracker, right before they are written, so that the record written for every PodTracker gets its own sequence number
+func (i *Instance) Stamp(record Record) {
+	if i == nil {
+		return
+	}
+
+	*record.instanceInfo() = InstanceInfo{
+		ClusterName:        i.ClusterName,
+		ClusterID:          i.ClusterID,
+		Controller:         i.Controller,
+		ControllerSequence: i.sequence.Add(1),
+	}
+}
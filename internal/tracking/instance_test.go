@@ -0,0 +1,66 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Instance", func() {
+	It("stamps records with the cluster, the controller and a monotonic sequence number", func() {
+		instance := &Instance{ClusterName: "prod", ClusterID: "7c1b", Controller: "podtracker-5d9f"}
+
+		first, second := &PodInfo{}, &PodInfo{}
+		instance.Stamp(first)
+		instance.Stamp(second)
+		Expect(first.ClusterName).To(Equal("prod"))
+		Expect(first.ClusterID).To(Equal("7c1b"))
+		Expect(first.Controller).To(Equal("podtracker-5d9f"))
+		Expect(first.ControllerSequence).To(Equal(uint64(1)))
+		Expect(second.ControllerSequence).To(Equal(uint64(2)))
+	})
+
+	It("stamps every type of record from the same sequence", func() {
+		instance := &Instance{Controller: "podtracker-5d9f"}
+
+		pod, service, node := &PodInfo{}, &ServiceRecord{}, &NodeRecord{}
+		for _, record := range []Record{pod, service, node} {
+			instance.Stamp(record)
+		}
+		Expect(service.Controller).To(Equal("podtracker-5d9f"))
+		Expect(node.ControllerSequence).To(Equal(uint64(3)))
+	})
+
+	It("leaves records unchanged if there is no instance", func() {
+		var instance *Instance
+		info := &PodInfo{}
+		instance.Stamp(info)
+		Expect(info).To(Equal(&PodInfo{}))
+	})
+})
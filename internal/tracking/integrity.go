@@ -0,0 +1,233 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Record is a record written by BackendWriters: a PodInfo, ServiceRecord, NodeRecord, ResourceRecord or InventoryRecord
+type Record interface {
+	// Link returns the integrity fields of the record, which link it into the hash chain of a writer
+	Link() ChainLink
+	// withLink returns a shallow copy of the record with the provided integrity fields
+	withLink(ChainLink) Record
+	// instanceInfo returns the cluster and controller details of the record, which are set by Instance.Stamp
+	instanceInfo() *InstanceInfo
+}
+
+// ChainLink holds the integrity fields of a record (see IntegrityConfig)
+type ChainLink struct {
+	// Chain identifies the hash chain of the record. A chain keeps its ID when it restarts with the controller, but a new chain
+	// (e.g. of a recreated PodTracker, or of a PodTracker which enabled integrity again) gets a new ID
+	Chain        string
+	Sequence     uint64
+	PreviousHash string
+	Signature    string
+}
+
+// Link implements Record
+func (p *PodInfo) Link() ChainLink {
+	return ChainLink{Chain: p.Chain, Sequence: p.Sequence, PreviousHash: p.PreviousHash, Signature: p.Signature}
+}
+
+func (p *PodInfo) withLink(link ChainLink) Record {
+	linked := *p
+	linked.Chain, linked.Sequence, linked.PreviousHash, linked.Signature = link.Chain, link.Sequence, link.PreviousHash, link.Signature
+	return &linked
+}
+
+// Chain holds the state of the hash chain of a single writer stream. It is not safe for concurrent use
+type Chain struct {
+	id       string
+	sequence uint64
+	lastHash string
+	key      []byte
+}
+
+// NewChain creates a new hash chain with the provided ID. If key is not empty, every record is also signed with an HMAC-SHA256 using the key
+func NewChain(id string, key []byte) *Chain {
+	return &Chain{id: id, key: key}
+}
+
+// Next returns a copy of the provided record that is linked to the previous record of the chain.
+// The chain does not advance until the returned record is passed to Commit, so that a record which failed to be written can be retried
+func (c *Chain) Next(record Record) (Record, error) {
+	link := ChainLink{Chain: c.id, Sequence: c.sequence + 1, PreviousHash: c.lastHash}
+	linked := record.withLink(link)
+
+	if len(c.key) > 0 {
+		signature, err := Sign(linked, c.key)
+		if err != nil {
+			return nil, err
+		}
+		link.Signature = signature
+		linked = linked.withLink(link)
+	}
+
+	return linked, nil
+}
+
+// Commit advances the chain past the provided record, which must have been returned by Next
+func (c *Chain) Commit(linked Record) error {
+	hash, err := RecordHash(linked)
+	if err != nil {
+		return err
+	}
+
+	c.sequence = linked.Link().Sequence
+	c.lastHash = hash
+	return nil
+}
+
+// Continue carries over the ID and position of the previous chain, so that a rebuilt writer continues the same stream
+func (c *Chain) Continue(previous *Chain) {
+	c.id = previous.id
+	c.sequence = previous.sequence
+	c.lastHash = previous.lastHash
+}
+
+// canonicalJSON returns the canonical encoding of a record, which is the input of its hash and signature.
+// encoding/json sorts map keys, so the same record always produces the same encoding
+func canonicalJSON(record Record) ([]byte, error) {
+	return json.Marshal(record)
+}
+
+// RecordHash returns the hex encoded SHA-256 hash of the canonical encoding of the record (including its signature)
+func RecordHash(record Record) (string, error) {
+	data, err := canonicalJSON(record)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the canonical encoding of the record, computed without its signature
+func Sign(record Record, key []byte) (string, error) {
+	link := record.Link()
+	link.Signature = ""
+
+	data, err := canonicalJSON(record.withLink(link))
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Verifier walks the records of a single writer stream in the order they were written and reports any broken links of the hash chain.
+// Records written by different PodTrackers belong to different streams, so each needs its own Verifier
+type Verifier struct {
+	// Key is the HMAC key used to verify record signatures. If empty, signatures are not verified
+	Key []byte
+
+	// Restarts counts the chains that were restarted by a controller restart in the verified records.
+	// A restart is expected, but the records written just before it cannot be verified
+	Restarts int
+	// NewChains counts the new chains (i.e. with a different chain ID) which began after the first verified record,
+	// e.g. because the PodTracker was recreated or enabled integrity again
+	NewChains int
+
+	previous         *ChainLink
+	previousHash     string
+	previousInstance InstanceInfo
+}
+
+// controllerRestarted returns true if the controller which emitted a record is not the process which emitted the previous record
+func controllerRestarted(previous, current InstanceInfo) bool {
+	if current.ControllerSequence == 0 || previous.ControllerSequence == 0 {
+		// records which were not stamped by a controller can't tell
+		return false
+	}
+	return current.Controller != previous.Controller || current.ControllerSequence <= previous.ControllerSequence
+}
+
+// newChain returns true if a record of the chain with the current ID doesn't belong to the chain of the previous record.
+// Records written before chains had IDs can't tell
+func newChain(previous, current string) bool {
+	return previous != "" && current != "" && previous != current
+}
+
+// Verify checks the provided record against the previously verified record and returns a description of every problem found.
+// raw must be the bytes that the record was read from: the hash chain links the records as they were written, so the hash of a record
+// is computed from its raw bytes rather than from a re-encoding that may differ (e.g. by dropping fields this version does not know)
+func (v *Verifier) Verify(record Record, raw []byte) []string {
+	problems := []string{}
+
+	info := record.Link()
+	if info.Sequence == 0 {
+		return append(problems, "record has no sequence number, was integrity enabled for the PodTracker?")
+	}
+
+	instance := *record.instanceInfo()
+
+	if len(v.Key) > 0 {
+		expected, err := Sign(record, v.Key)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("unable to compute signature: %v", err))
+		} else if !hmac.Equal([]byte(expected), []byte(info.Signature)) {
+			problems = append(problems, "signature does not match, the record was modified or signed with a different key")
+		}
+	}
+
+	if v.previous != nil {
+		restarted := info.Sequence == 1 && info.PreviousHash == ""
+		switch {
+		case restarted && newChain(v.previous.Chain, info.Chain):
+			// a new chain began, e.g. for a recreated PodTracker
+			v.NewChains++
+		case restarted && controllerRestarted(v.previousInstance, instance):
+			// the controller restarted and began a new chain
+			v.Restarts++
+		case restarted:
+			problems = append(problems, "chain restarted without a controller restart, the records before it may have been removed")
+		case info.Sequence == v.previous.Sequence:
+			problems = append(problems, fmt.Sprintf("duplicate sequence %d", info.Sequence))
+		case info.Sequence < v.previous.Sequence:
+			problems = append(problems, fmt.Sprintf("sequence %d is out of order, previous record had sequence %d", info.Sequence, v.previous.Sequence))
+		case info.Sequence > v.previous.Sequence+1:
+			problems = append(problems, fmt.Sprintf("missing records with sequence %d to %d", v.previous.Sequence+1, info.Sequence-1))
+		case info.PreviousHash != v.previousHash:
+			problems = append(problems, "previous hash does not match, the preceding record was modified")
+		}
+	}
+
+	sum := sha256.Sum256(raw)
+	v.previous = &info
+	v.previousHash = hex.EncodeToString(sum[:])
+	v.previousInstance = instance
+	return problems
+}
@@ -0,0 +1,166 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Chain", func() {
+	key := []byte("hmac-key")
+
+	// linkChain builds a chain with the provided ID of n records emitted by the provided controller process, and returns them
+	// as they would be read back from an exported file
+	linkChain := func(id string, n int, instance *Instance) []*PodInfo {
+		chain := NewChain(id, key)
+		records := []*PodInfo{}
+		for i := 0; i < n; i++ {
+			info := &PodInfo{SchemaVersion: CurrentSchemaVersion, ID: "pod", Event: PodCreateEvent, Labels: map[string]string{"b": "2", "a": "1"}}
+			instance.Stamp(info)
+			linked, err := chain.Next(info)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(chain.Commit(linked)).To(Succeed())
+
+			data, err := json.Marshal(linked)
+			Expect(err).NotTo(HaveOccurred())
+			exported := &PodInfo{}
+			Expect(json.Unmarshal(data, exported)).To(Succeed())
+			records = append(records, exported)
+		}
+		return records
+	}
+
+	// link builds a chain of n records emitted by the provided controller process
+	link := func(n int, instance *Instance) []*PodInfo {
+		return linkChain("podtracker-uid/1", n, instance)
+	}
+
+	// verify verifies the records as they would be written to an exported file
+	verify := func(v *Verifier, records []*PodInfo) []string {
+		problems := []string{}
+		for _, r := range records {
+			raw, err := json.Marshal(r)
+			Expect(err).NotTo(HaveOccurred())
+			problems = append(problems, v.Verify(r, raw)...)
+		}
+		return problems
+	}
+
+	It("produces records which verify", func() {
+		records := link(3, nil)
+		Expect(records[0].Chain).To(Equal("podtracker-uid/1"))
+		Expect(records[0].Sequence).To(Equal(uint64(1)))
+		Expect(records[0].PreviousHash).To(BeEmpty())
+		Expect(records[2].Sequence).To(Equal(uint64(3)))
+		Expect(verify(&Verifier{Key: key}, records)).To(BeEmpty())
+	})
+
+	It("does not advance until a record is committed", func() {
+		chain := NewChain("chain", nil)
+		first, err := chain.Next(&PodInfo{ID: "pod"})
+		Expect(err).NotTo(HaveOccurred())
+		retry, err := chain.Next(&PodInfo{ID: "pod"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(retry.Link().Sequence).To(Equal(first.Link().Sequence))
+	})
+
+	It("detects modified records", func() {
+		records := link(3, nil)
+		records[1].Name = "tampered"
+		Expect(verify(&Verifier{Key: key}, records)).To(ConsistOf(
+			ContainSubstring("signature does not match"),
+			ContainSubstring("previous hash does not match"),
+		))
+	})
+
+	It("detects removed records", func() {
+		records := link(4, nil)
+		Expect(verify(&Verifier{Key: key}, append(records[:1], records[2:]...))).To(ConsistOf(
+			"missing records with sequence 2 to 2",
+		))
+	})
+
+	It("detects records signed with a different key", func() {
+		records := link(1, nil)
+		Expect(verify(&Verifier{Key: []byte("another-key")}, records)).To(ConsistOf(ContainSubstring("signature does not match")))
+	})
+
+	It("hashes the raw bytes of records", func() {
+		records := link(2, nil)
+		// a field unknown to the verifier is part of the hash, even though it is dropped when the record is parsed
+		raw, err := json.Marshal(records[0])
+		Expect(err).NotTo(HaveOccurred())
+		raw = append([]byte(`{"unknown":true,`), raw[1:]...)
+
+		v := &Verifier{Key: key}
+		Expect(v.Verify(records[0], raw)).To(BeEmpty())
+		Expect(verify(v, records[1:])).To(ConsistOf(ContainSubstring("previous hash does not match")))
+	})
+
+	It("accepts chain restarts at controller restarts only", func() {
+		before := link(2, &Instance{Controller: "podtracker-a"})
+		after := link(2, &Instance{Controller: "podtracker-b"})
+		v := &Verifier{Key: key}
+		Expect(verify(v, append(before, after...))).To(BeEmpty())
+		Expect(v.Restarts).To(Equal(1))
+
+		// records after the restart of a chain by the same controller process
+		instance := &Instance{Controller: "podtracker-a"}
+		records := append(link(2, instance), link(1, instance)...)
+		v = &Verifier{Key: key}
+		Expect(verify(v, records)).To(ConsistOf(ContainSubstring("chain restarted without a controller restart")))
+		Expect(v.Restarts).To(BeZero())
+	})
+	It("accepts new chains without a controller restart", func() {
+		// e.g. the records of a PodTracker which was recreated, or which enabled integrity again, by the same controller process
+		instance := &Instance{Controller: "podtracker-a"}
+		records := append(linkChain("podtracker-uid/1", 2, instance), linkChain("podtracker-uid/4", 2, instance)...)
+		records = append(records, linkChain("recreated-uid/1", 1, instance)...)
+		v := &Verifier{Key: key}
+		Expect(verify(v, records)).To(BeEmpty())
+		Expect(v.NewChains).To(Equal(2))
+		Expect(v.Restarts).To(BeZero())
+	})
+
+	It("continues the ID of the previous chain", func() {
+		previous := NewChain("podtracker-uid/1", key)
+		linked, err := previous.Next(&PodInfo{ID: "pod"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(previous.Commit(linked)).To(Succeed())
+
+		next := NewChain("podtracker-uid/2", key)
+		next.Continue(previous)
+		linked, err = next.Next(&PodInfo{ID: "pod"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(linked.Link().Chain).To(Equal("podtracker-uid/1"))
+		Expect(linked.Link().Sequence).To(Equal(uint64(2)))
+	})
+})
@@ -0,0 +1,166 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// InventoryRecordType is the recordType of every InventoryRecord, which tells them apart from PodInfo records in the same stream
+const InventoryRecordType = "Inventory"
+
+// DefaultInventoryPageSize is the maximum number of Pods listed by a single InventoryRecord, unless configured otherwise (see InventoryRecordConfig).
+// It bounds the size of the records, which some backends limit (e.g. the size of a message or of a log line)
+const DefaultInventoryPageSize = 500
+
+// InventoryPod is the compact description of a Pod in an InventoryRecord
+type InventoryPod struct {
+	UID       types.UID `json:"uid"`
+	Name      string    `json:"name"`
+	Namespace string    `json:"namespace"`
+	IPs       []string  `json:"ips"`
+	Node      string    `json:"node"`
+}
+
+// NewInventoryPod returns the compact description of the provided Pod
+func NewInventoryPod(pod *corev1.Pod) InventoryPod {
+	ips := PodIPs(pod)
+	if ips == nil {
+		ips = []string{}
+	}
+	return InventoryPod{
+		UID:       pod.GetUID(),
+		Name:      pod.GetName(),
+		Namespace: pod.GetNamespace(),
+		IPs:       ips,
+		Node:      pod.Spec.NodeName,
+	}
+}
+
+// InventoryRecordConfig describes an InventoryRecord
+type InventoryRecordConfig struct {
+	// Pods are the Pods holding IPs at the time of the inventory
+	Pods []*corev1.Pod
+	// Interval is the period in which inventories are recorded
+	Interval time.Duration
+	// PageSize is the maximum number of Pods listed by each InventoryRecord (DefaultInventoryPageSize if 0)
+	PageSize int
+}
+
+// InventoryRecord lists every Pod holding IPs at a point in time, so that consumers can reconcile their state with it and detect the
+// records they have missed (e.g. while the controller was down, or because a record was dropped).
+// InventoryRecords are written by the same BackendWriters as PodInfo records, and are told apart by their recordType.
+// Large inventories are split into pages, which share the same timestamp
+type InventoryRecord struct {
+	SchemaVersion SchemaVersion `json:"schemaVersion"`
+	RecordType    string        `json:"recordType"`
+	TrackedBy     string        `json:"trackedBy,omitempty"`
+	Timestamp     string        `json:"timestamp"`
+	// IntervalSeconds is the period in which inventories are recorded, so that consumers can tell when the next one is due
+	IntervalSeconds int64 `json:"intervalSeconds"`
+	// Page is the index of the page of the inventory, starting at 1, and PageCount the number of pages of the inventory
+	Page      int `json:"page"`
+	PageCount int `json:"pageCount"`
+	// PodCount is the number of Pods in the inventory, across every page
+	PodCount int            `json:"podCount"`
+	Pods     []InventoryPod `json:"pods"`
+
+	// InstanceInfo identifies the cluster and the controller process which emitted the record (see Instance)
+	InstanceInfo
+
+	// Chain, Sequence, PreviousHash and Signature are only set when integrity is enabled for the PodTracker (see IntegrityConfig)
+	Chain        string `json:"chain,omitempty"`
+	Sequence     uint64 `json:"sequence,omitempty"`
+	PreviousHash string `json:"previousHash,omitempty"`
+	Signature    string `json:"signature,omitempty"`
+
+	// timestamp is the unformatted timestamp of the InventoryRecord
+	timestamp time.Time
+}
+
+// NewInventoryRecords creates the pages of a new inventory. Pods are listed by namespace and name, and an empty inventory has a single page
+func NewInventoryRecords(cfg *InventoryRecordConfig) []*InventoryRecord {
+	pods := make([]InventoryPod, 0, len(cfg.Pods))
+	for _, pod := range cfg.Pods {
+		pods = append(pods, NewInventoryPod(pod))
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		if pods[i].Namespace != pods[j].Namespace {
+			return pods[i].Namespace < pods[j].Namespace
+		}
+		return pods[i].Name < pods[j].Name
+	})
+
+	pageSize := cfg.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultInventoryPageSize
+	}
+	pageCount := (len(pods) + pageSize - 1) / pageSize
+	if pageCount == 0 {
+		pageCount = 1
+	}
+
+	now := time.Now()
+	records := make([]*InventoryRecord, 0, pageCount)
+	for page := 0; page < pageCount; page++ {
+		end := min((page+1)*pageSize, len(pods))
+		record := &InventoryRecord{
+			SchemaVersion:   CurrentSchemaVersion,
+			RecordType:      InventoryRecordType,
+			IntervalSeconds: int64(cfg.Interval / time.Second),
+			Page:            page + 1,
+			PageCount:       pageCount,
+			PodCount:        len(pods),
+			Pods:            pods[min(page*pageSize, end):end],
+			timestamp:       now,
+		}
+		record.FormatTimestamps(RFC3339NanoTimestampFormat)
+		records = append(records, record)
+	}
+	return records
+}
+
+// FormatTimestamps formats the timestamp of the InventoryRecord with the provided format (RFC3339Nano if empty)
+func (i *InventoryRecord) FormatTimestamps(format TimestampFormat) {
+	i.Timestamp = format.format(i.timestamp)
+}
+
+// Link implements Record
+func (i *InventoryRecord) Link() ChainLink {
+	return ChainLink{Chain: i.Chain, Sequence: i.Sequence, PreviousHash: i.PreviousHash, Signature: i.Signature}
+}
+
+func (i *InventoryRecord) withLink(link ChainLink) Record {
+	linked := *i
+	linked.Chain, linked.Sequence, linked.PreviousHash, linked.Signature = link.Chain, link.Sequence, link.PreviousHash, link.Signature
+	return &linked
+}
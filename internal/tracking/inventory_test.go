@@ -0,0 +1,114 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("InventoryRecord", func() {
+	newPod := func(namespace, name string, ips ...string) *corev1.Pod {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, UID: types.UID("uid-" + name)},
+			Spec:       corev1.PodSpec{NodeName: "node-1"},
+		}
+		for _, ip := range ips {
+			pod.Status.PodIPs = append(pod.Status.PodIPs, corev1.PodIP{IP: ip})
+		}
+		return pod
+	}
+
+	It("lists the pods by namespace and name", func() {
+		records := NewInventoryRecords(&InventoryRecordConfig{
+			Pods: []*corev1.Pod{
+				newPod("b", "pod-1", "10.0.0.3"),
+				newPod("a", "pod-2", "10.0.0.2", "fd00::2"),
+				newPod("a", "pod-1", "10.0.0.1"),
+			},
+			Interval: 5 * time.Minute,
+		})
+		Expect(records).To(HaveLen(1))
+		record := records[0]
+		Expect(record.RecordType).To(Equal(InventoryRecordType))
+		Expect(record.IntervalSeconds).To(BeEquivalentTo(300))
+		Expect(record.PodCount).To(Equal(3))
+		Expect(record.Page).To(Equal(1))
+		Expect(record.PageCount).To(Equal(1))
+		Expect(record.Pods).To(Equal([]InventoryPod{
+			{UID: "uid-pod-1", Name: "pod-1", Namespace: "a", IPs: []string{"10.0.0.1"}, Node: "node-1"},
+			{UID: "uid-pod-2", Name: "pod-2", Namespace: "a", IPs: []string{"10.0.0.2", "fd00::2"}, Node: "node-1"},
+			{UID: "uid-pod-1", Name: "pod-1", Namespace: "b", IPs: []string{"10.0.0.3"}, Node: "node-1"},
+		}))
+		Expect(record.Timestamp).NotTo(BeEmpty())
+	})
+
+	It("records an empty inventory", func() {
+		records := NewInventoryRecords(&InventoryRecordConfig{Interval: time.Minute})
+		Expect(records).To(HaveLen(1))
+		record := records[0]
+		Expect(record.Page).To(Equal(1))
+		Expect(record.PageCount).To(Equal(1))
+		Expect(record.PodCount).To(BeZero())
+		Expect(record.Pods).To(BeEmpty())
+		Expect(record.Pods).NotTo(BeNil())
+	})
+
+	It("splits large inventories into pages", func() {
+		records := NewInventoryRecords(&InventoryRecordConfig{
+			Pods: []*corev1.Pod{
+				newPod("a", "pod-1", "10.0.0.1"),
+				newPod("a", "pod-2", "10.0.0.2"),
+				newPod("a", "pod-3", "10.0.0.3"),
+				newPod("a", "pod-4", "10.0.0.4"),
+				newPod("a", "pod-5", "10.0.0.5"),
+			},
+			Interval: time.Minute,
+			PageSize: 2,
+		})
+		Expect(records).To(HaveLen(3))
+
+		names := []string{}
+		for i, record := range records {
+			Expect(record.Page).To(Equal(i + 1))
+			Expect(record.PageCount).To(Equal(3))
+			Expect(record.PodCount).To(Equal(5))
+			Expect(record.Timestamp).To(Equal(records[0].Timestamp))
+			Expect(len(record.Pods)).To(BeNumerically("<=", 2))
+			for _, pod := range record.Pods {
+				names = append(names, pod.Name)
+			}
+		}
+		Expect(names).To(Equal([]string{"pod-1", "pod-2", "pod-3", "pod-4", "pod-5"}))
+	})
+})
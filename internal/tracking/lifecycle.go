@@ -0,0 +1,162 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// OptionalPodEvents are the events that PodTrackers can opt into, in addition to the Create, Delete, NetworkUpdate and Snapshot events which are always recorded
+var OptionalPodEvents = []PodEvent{
+	PodIPAssignedEvent,
+	PodIPChangedEvent,
+	PodReadyEvent,
+	PodTerminatedEvent,
+	PodEvictedEvent,
+	PodServicesChangedEvent,
+	PodRescheduledEvent,
+}
+
+// IsOptional returns true if PodTrackers have to opt into the event for it to be recorded
+func (e PodEvent) IsOptional() bool {
+	for _, optional := range OptionalPodEvents {
+		if e == optional {
+			return true
+		}
+	}
+	return false
+}
+
+// podEvictedReason is the status reason set by the kubelet on Pods that it evicts
+const podEvictedReason = "Evicted"
+
+// ContainerTermination describes how a container of a Pod terminated
+type ContainerTermination struct {
+	Container  string `json:"container"`
+	ExitCode   int32  `json:"exitCode"`
+	Signal     int32  `json:"signal,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	FinishedAt string `json:"finishedAt,omitempty"`
+
+	// finishedAt is the unformatted FinishedAt timestamp
+	finishedAt time.Time
+}
+
+// containerTerminations returns how each terminated container (including init containers) of the Pod terminated
+func containerTerminations(pod *corev1.Pod) []ContainerTermination {
+	terminations := []ContainerTermination{}
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if status.State.Terminated == nil {
+				continue
+			}
+
+			termination := ContainerTermination{
+				Container: status.Name,
+				ExitCode:  status.State.Terminated.ExitCode,
+				Signal:    status.State.Terminated.Signal,
+				Reason:    status.State.Terminated.Reason,
+			}
+			termination.finishedAt = status.State.Terminated.FinishedAt.Time
+			terminations = append(terminations, termination)
+		}
+	}
+	return terminations
+}
+
+// disruptionTarget returns the DisruptionTarget condition of the Pod if it is set
+func disruptionTarget(pod *corev1.Pod) *corev1.PodCondition {
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == corev1.DisruptionTarget && pod.Status.Conditions[i].Status == corev1.ConditionTrue {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// podStatusReason returns the reason and message explaining the state of the Pod. The reason of a DisruptionTarget condition
+// (e.g. "EvictionByEvictionAPI" or "PreemptionByScheduler") is used if the Pod status doesn't set one
+func podStatusReason(pod *corev1.Pod) (string, string) {
+	if pod.Status.Reason == "" {
+		if condition := disruptionTarget(pod); condition != nil {
+			return condition.Reason, condition.Message
+		}
+	}
+	return pod.Status.Reason, pod.Status.Message
+}
+
+// PodIPs returns all the IPs allocated to the Pod, or nil if no IP has been allocated yet
+func PodIPs(pod *corev1.Pod) []string {
+	if pod.Status.PodIP == "" && len(pod.Status.PodIPs) == 0 {
+		return nil
+	}
+	return podIPs(pod)
+}
+
+// PodIsReady returns true if the Pod's Ready condition is true
+func PodIsReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// PodIsTerminated returns true if all the containers of the Pod have terminated and will not be restarted
+func PodIsTerminated(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+}
+
+// PodIsEvicted returns true if the Pod was evicted by the kubelet, or is being disrupted (e.g. evicted through the Eviction API or preempted)
+func PodIsEvicted(pod *corev1.Pod) bool {
+	return pod.Status.Reason == podEvictedReason || disruptionTarget(pod) != nil
+}
+
+// releaseTime returns when the Pod released its IPs: when it was marked for deletion, or when its last container terminated
+// if it succeeded or failed without being deleted
+func releaseTime(pod *corev1.Pod) time.Time {
+	if deletionTimestamp := pod.GetDeletionTimestamp(); deletionTimestamp != nil {
+		return deletionTimestamp.Time
+	}
+
+	var released time.Time
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if status.State.Terminated != nil && status.State.Terminated.FinishedAt.After(released) {
+				released = status.State.Terminated.FinishedAt.Time
+			}
+		}
+	}
+	if released.IsZero() {
+		return time.Now()
+	}
+	return released
+}
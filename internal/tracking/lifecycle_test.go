@@ -0,0 +1,102 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Lifecycle events", func() {
+	It("records the terminations of an evicted pod", func() {
+		pod := &corev1.Pod{
+			Status: corev1.PodStatus{
+				Phase:   corev1.PodFailed,
+				Reason:  "Evicted",
+				Message: "The node was low on resource: memory.",
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "api", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}}},
+					{Name: "sidecar", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+				},
+			},
+		}
+		Expect(PodIsTerminated(pod)).To(BeTrue())
+		Expect(PodIsEvicted(pod)).To(BeTrue())
+
+		info := New(&PodInfoConfig{Pod: pod, Node: &corev1.Node{}, Event: PodEvictedEvent})
+		Expect(info.Reason).To(Equal("Evicted"))
+		Expect(info.Message).To(Equal("The node was low on resource: memory."))
+		Expect(info.Terminations).To(Equal([]ContainerTermination{{Container: "api", ExitCode: 137, Reason: "OOMKilled"}}))
+	})
+
+	It("uses the reason of the disruption target condition", func() {
+		pod := &corev1.Pod{
+			Status: corev1.PodStatus{
+				Conditions: []corev1.PodCondition{
+					{Type: corev1.DisruptionTarget, Status: corev1.ConditionTrue, Reason: "PreemptionByScheduler"},
+				},
+			},
+		}
+		Expect(PodIsEvicted(pod)).To(BeTrue())
+
+		info := New(&PodInfoConfig{Pod: pod, Node: &corev1.Node{}, Event: PodEvictedEvent})
+		Expect(info.Reason).To(Equal("PreemptionByScheduler"))
+	})
+
+	It("only records previous IPs for IP changes", func() {
+		pod := &corev1.Pod{Status: corev1.PodStatus{PodIP: "10.244.0.18"}}
+
+		info := New(&PodInfoConfig{Pod: pod, Node: &corev1.Node{}, Event: PodIPChangedEvent, PreviousPodIPs: []string{"10.244.0.17"}})
+		Expect(info.PreviousPodIPs).To(Equal([]IPAddress{{IP: "10.244.0.17", Family: corev1.IPv4Protocol}}))
+
+		info = New(&PodInfoConfig{Pod: pod, Node: &corev1.Node{}, Event: PodReadyEvent, PreviousPodIPs: []string{"10.244.0.17"}})
+		Expect(info.PreviousPodIPs).To(BeNil())
+		Expect(info.Terminations).To(BeNil())
+	})
+
+	It("records the release of a completed pod", func() {
+		finishedAt := metav1.NewTime(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC))
+		pod := &corev1.Pod{
+			Status: corev1.PodStatus{
+				Phase: corev1.PodSucceeded,
+				PodIP: "10.244.0.17",
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "job", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{FinishedAt: finishedAt}}},
+				},
+			},
+		}
+
+		info := New(&PodInfoConfig{Pod: pod, Node: &corev1.Node{}, Event: PodDeleteEvent})
+		Expect(info.Phase).To(Equal(corev1.PodSucceeded))
+		Expect(info.DeletionTimestamp).To(Equal("2026-10-19T12:00:00Z"))
+	})
+})
@@ -0,0 +1,82 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NetworkStatusAnnotation is the annotation that Multus (and other CNI meta-plugins implementing the Kubernetes Network Custom Resource
+// Definition De-facto Standard) uses to report the status of every network interface attached to a Pod
+const NetworkStatusAnnotation = "k8s.v1.cni.cncf.io/network-status"
+
+// NetworkInterface describes a network interface attached to a Pod, as reported in the network-status annotation
+type NetworkInterface struct {
+	Network   string   `json:"network"`
+	Interface string   `json:"interface,omitempty"`
+	IPs       []string `json:"ips,omitempty"`
+	MAC       string   `json:"mac,omitempty"`
+	Default   bool     `json:"default,omitempty"`
+}
+
+// networkStatus is a single entry of the network-status annotation
+type networkStatus struct {
+	Name      string   `json:"name"`
+	Interface string   `json:"interface"`
+	IPs       []string `json:"ips"`
+	MAC       string   `json:"mac"`
+	Default   bool     `json:"default"`
+}
+
+// NetworkInterfaces parses the network-status annotation of the Pod.
+// nil is returned if the Pod has no network-status annotation, or if the annotation can't be parsed
+func NetworkInterfaces(pod *corev1.Pod) []NetworkInterface {
+	annotation, ok := pod.GetAnnotations()[NetworkStatusAnnotation]
+	if !ok {
+		return nil
+	}
+
+	statuses := []networkStatus{}
+	if err := json.Unmarshal([]byte(annotation), &statuses); err != nil {
+		return nil
+	}
+
+	interfaces := make([]NetworkInterface, 0, len(statuses))
+	for _, status := range statuses {
+		interfaces = append(interfaces, NetworkInterface{
+			Network:   status.Name,
+			Interface: status.Interface,
+			IPs:       status.IPs,
+			MAC:       status.MAC,
+			Default:   status.Default,
+		})
+	}
+	return interfaces
+}
@@ -0,0 +1,87 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// NetworkPolicyExposure describes the NetworkPolicies selecting a Pod, and whether they isolate its ingress and egress traffic.
+// Traffic of a Pod which isn't isolated is allowed regardless of the NetworkPolicies of its namespace
+type NetworkPolicyExposure struct {
+	// Policies are the names of the NetworkPolicies selecting the Pod
+	Policies        []string `json:"policies"`
+	IngressIsolated bool     `json:"ingressIsolated"`
+	EgressIsolated  bool     `json:"egressIsolated"`
+}
+
+// PodNetworkPolicies evaluates the provided NetworkPolicies of the Pod's namespace against the labels of the Pod.
+// Policies with an invalid Pod selector are ignored, as they aren't enforced either
+func PodNetworkPolicies(pod *corev1.Pod, policies []networkingv1.NetworkPolicy) *NetworkPolicyExposure {
+	exposure := &NetworkPolicyExposure{Policies: []string{}}
+	for _, policy := range policies {
+		if policy.GetNamespace() != pod.GetNamespace() {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.PodSelector)
+		if err != nil || !selector.Matches(labels.Set(pod.GetLabels())) {
+			continue
+		}
+
+		exposure.Policies = append(exposure.Policies, policy.GetName())
+		ingress, egress := policyTypes(&policy)
+		exposure.IngressIsolated = exposure.IngressIsolated || ingress
+		exposure.EgressIsolated = exposure.EgressIsolated || egress
+	}
+
+	sort.Strings(exposure.Policies)
+	return exposure
+}
+
+// policyTypes returns whether the NetworkPolicy applies to ingress and egress traffic. Policies that don't set their types
+// apply to ingress traffic, and to egress traffic if they have egress rules
+func policyTypes(policy *networkingv1.NetworkPolicy) (ingress bool, egress bool) {
+	if len(policy.Spec.PolicyTypes) == 0 {
+		return true, len(policy.Spec.Egress) > 0
+	}
+
+	for _, policyType := range policy.Spec.PolicyTypes {
+		switch policyType {
+		case networkingv1.PolicyTypeIngress:
+			ingress = true
+		case networkingv1.PolicyTypeEgress:
+			egress = true
+		}
+	}
+	return ingress, egress
+}
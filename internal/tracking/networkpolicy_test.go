@@ -0,0 +1,95 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("NetworkPolicies", func() {
+	var pod *corev1.Pod
+
+	// policy returns a NetworkPolicy of the "app" namespace selecting Pods with the provided labels
+	policy := func(name string, matchLabels map[string]string, types ...networkingv1.PolicyType) networkingv1.NetworkPolicy {
+		return networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "app"},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: matchLabels},
+				PolicyTypes: types,
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "app", Labels: map[string]string{"app": "api"}}}
+	})
+
+	It("records the policies selecting a pod and whether its traffic is isolated", func() {
+		egress := policy("allow-dns", nil, networkingv1.PolicyTypeEgress)
+		egress.Spec.Egress = []networkingv1.NetworkPolicyEgressRule{{}}
+
+		Expect(PodNetworkPolicies(pod, []networkingv1.NetworkPolicy{
+			policy("default-deny", nil),
+			egress,
+			policy("web", map[string]string{"app": "web"}, networkingv1.PolicyTypeIngress),
+		})).To(Equal(&NetworkPolicyExposure{
+			Policies:        []string{"allow-dns", "default-deny"},
+			IngressIsolated: true,
+			EgressIsolated:  true,
+		}))
+	})
+
+	It("isolates egress traffic of policies with egress rules that don't set their types", func() {
+		implicit := policy("api", map[string]string{"app": "api"})
+		Expect(PodNetworkPolicies(pod, []networkingv1.NetworkPolicy{implicit}).EgressIsolated).To(BeFalse())
+
+		implicit.Spec.Egress = []networkingv1.NetworkPolicyEgressRule{{}}
+		Expect(PodNetworkPolicies(pod, []networkingv1.NetworkPolicy{implicit}).EgressIsolated).To(BeTrue())
+	})
+
+	It("records pods which aren't selected by any policy as exposed", func() {
+		Expect(PodNetworkPolicies(pod, nil)).To(Equal(&NetworkPolicyExposure{Policies: []string{}}))
+	})
+
+	It("only records policies on create and snapshot", func() {
+		exposure := &NetworkPolicyExposure{Policies: []string{"default-deny"}, IngressIsolated: true}
+
+		info := New(&PodInfoConfig{Pod: pod, Node: &corev1.Node{}, Event: PodCreateEvent, NetworkPolicies: exposure})
+		Expect(info.NetworkPolicies).To(Equal(exposure))
+
+		info = New(&PodInfoConfig{Pod: pod, Node: &corev1.Node{}, Event: PodSnapshotEvent, NetworkPolicies: exposure})
+		Expect(info.NetworkPolicies).To(Equal(exposure))
+
+		info = New(&PodInfoConfig{Pod: pod, Node: &corev1.Node{}, Event: PodDeleteEvent, NetworkPolicies: exposure})
+		Expect(info.NetworkPolicies).To(BeNil())
+	})
+})
@@ -0,0 +1,168 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NodeEvent describes what kind of change a Node has undergone
+type NodeEvent string
+
+const (
+	// NodeJoinEvent is emitted when a Node is first observed
+	NodeJoinEvent NodeEvent = "Join"
+	// NodeAddressesChangedEvent is emitted when the addresses of a recorded Node change
+	NodeAddressesChangedEvent NodeEvent = "AddressesChanged"
+	// NodePodCIDRsChangedEvent is emitted when the Pod IP ranges assigned to a recorded Node change
+	NodePodCIDRsChangedEvent NodeEvent = "PodCIDRsChanged"
+	// NodeLeaveEvent is emitted when a recorded Node is deleted
+	NodeLeaveEvent NodeEvent = "Leave"
+)
+
+// NodeRecordType is the recordType of every NodeRecord, which tells them apart from PodInfo records in the same stream
+const NodeRecordType = "Node"
+
+// NodeAddress is an address of a Node, tagged with its IP family if it is an IP
+type NodeAddress struct {
+	Type    corev1.NodeAddressType `json:"type"`
+	Address string                 `json:"address"`
+	Family  corev1.IPFamily        `json:"family,omitempty"`
+}
+
+// NodeAddresses returns the addresses of the Node. Hostnames and DNS names are returned without an IP family
+func NodeAddresses(node *corev1.Node) []NodeAddress {
+	addresses := []NodeAddress{}
+	for _, addr := range node.Status.Addresses {
+		address := NodeAddress{Type: addr.Type, Address: addr.Address}
+		if ips := newIPAddresses(addr.Address); len(ips) == 1 {
+			address.Family = ips[0].Family
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+// NodePodCIDRs returns the Pod IP ranges assigned to the Node
+func NodePodCIDRs(node *corev1.Node) []string {
+	cidrs := nodePodCIDRs(node)
+	if cidrs == nil {
+		return []string{}
+	}
+	return cidrs
+}
+
+// NodeRecordConfig describes a NodeRecord
+type NodeRecordConfig struct {
+	Node  *corev1.Node
+	Event NodeEvent
+	// PreviousAddresses are the addresses the Node had before an AddressesChanged event
+	PreviousAddresses []NodeAddress
+	// PreviousPodCIDRs are the Pod IP ranges the Node had before a PodCIDRsChanged event
+	PreviousPodCIDRs []string
+}
+
+// NodeRecord describes the addresses and Pod IP ranges of a Node, so that the traffic of host-network Pods and the egress traffic
+// SNAT'd to Node IPs can be attributed even when Pods outlive a change of the IPs of their Node.
+// NodeRecords are written by the same BackendWriters as PodInfo records, and are told apart by their recordType
+type NodeRecord struct {
+	SchemaVersion     SchemaVersion `json:"schemaVersion"`
+	RecordType        string        `json:"recordType"`
+	TrackedBy         string        `json:"trackedBy,omitempty"`
+	ID                string        `json:"id"`
+	Event             NodeEvent     `json:"event"`
+	Name              string        `json:"name"`
+	CreationTimestamp string        `json:"creationTimestamp"`
+	DeletionTimestamp string        `json:"deletionTimestamp,omitempty"`
+	Addresses         []NodeAddress `json:"addresses"`
+	PodCIDRs          []string      `json:"podCIDRs"`
+	// PreviousAddresses and PreviousPodCIDRs are only set for the AddressesChanged and PodCIDRsChanged events respectively
+	PreviousAddresses []NodeAddress `json:"previousAddresses,omitempty"`
+	PreviousPodCIDRs  []string      `json:"previousPodCIDRs,omitempty"`
+
+	// InstanceInfo identifies the cluster and the controller process which emitted the record (see Instance)
+	InstanceInfo
+
+	// Chain, Sequence, PreviousHash and Signature are only set when integrity is enabled for the PodTracker (see IntegrityConfig)
+	Chain        string `json:"chain,omitempty"`
+	Sequence     uint64 `json:"sequence,omitempty"`
+	PreviousHash string `json:"previousHash,omitempty"`
+	Signature    string `json:"signature,omitempty"`
+
+	// creation and deletion are the unformatted timestamps of the NodeRecord
+	creation time.Time
+	deletion time.Time
+}
+
+// NewNodeRecord creates a new NodeRecord
+func NewNodeRecord(cfg *NodeRecordConfig) *NodeRecord {
+	record := &NodeRecord{
+		SchemaVersion: CurrentSchemaVersion,
+		RecordType:    NodeRecordType,
+		ID:            string(cfg.Node.GetUID()),
+		Event:         cfg.Event,
+		Name:          cfg.Node.GetName(),
+		Addresses:     NodeAddresses(cfg.Node),
+		PodCIDRs:      NodePodCIDRs(cfg.Node),
+		creation:      cfg.Node.GetCreationTimestamp().Time,
+	}
+
+	switch record.Event {
+	case NodeAddressesChangedEvent:
+		record.PreviousAddresses = cfg.PreviousAddresses
+	case NodePodCIDRsChangedEvent:
+		record.PreviousPodCIDRs = cfg.PreviousPodCIDRs
+	case NodeLeaveEvent:
+		record.deletion = time.Now()
+		if deletion := cfg.Node.GetDeletionTimestamp(); deletion != nil {
+			record.deletion = deletion.Time
+		}
+	}
+
+	record.FormatTimestamps(RFC3339NanoTimestampFormat)
+	return record
+}
+
+// FormatTimestamps formats the timestamps of the NodeRecord with the provided format (RFC3339Nano if empty)
+func (n *NodeRecord) FormatTimestamps(format TimestampFormat) {
+	n.CreationTimestamp = format.format(n.creation)
+	n.DeletionTimestamp = format.format(n.deletion)
+}
+
+// Link implements Record
+func (n *NodeRecord) Link() ChainLink {
+	return ChainLink{Chain: n.Chain, Sequence: n.Sequence, PreviousHash: n.PreviousHash, Signature: n.Signature}
+}
+
+func (n *NodeRecord) withLink(link ChainLink) Record {
+	linked := *n
+	linked.Chain, linked.Sequence, linked.PreviousHash, linked.Signature = link.Chain, link.Sequence, link.PreviousHash, link.Signature
+	return &linked
+}
@@ -0,0 +1,76 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("NodeRecord", func() {
+	var node *corev1.Node
+
+	BeforeEach(func() {
+		node = &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1", UID: "node-uid"},
+			Spec:       corev1.NodeSpec{PodCIDR: "10.244.1.0/24"},
+			Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeInternalIP, Address: "192.168.1.10"},
+				{Type: corev1.NodeInternalIP, Address: "fd00::a"},
+				{Type: corev1.NodeHostName, Address: "node-1"},
+			}},
+		}
+	})
+
+	It("records the addresses and pod CIDRs of a node", func() {
+		record := NewNodeRecord(&NodeRecordConfig{Node: node, Event: NodeJoinEvent})
+		Expect(record.RecordType).To(Equal(NodeRecordType))
+		Expect(record.Addresses).To(Equal([]NodeAddress{
+			{Type: corev1.NodeInternalIP, Address: "192.168.1.10", Family: corev1.IPv4Protocol},
+			{Type: corev1.NodeInternalIP, Address: "fd00::a", Family: corev1.IPv6Protocol},
+			{Type: corev1.NodeHostName, Address: "node-1"},
+		}))
+		Expect(record.PodCIDRs).To(Equal([]string{"10.244.1.0/24"}))
+		Expect(record.DeletionTimestamp).To(BeEmpty())
+	})
+
+	It("records the previous state of the changes it describes only", func() {
+		previous := NodeAddresses(node)
+		node.Status.Addresses = node.Status.Addresses[1:]
+
+		record := NewNodeRecord(&NodeRecordConfig{Node: node, Event: NodeAddressesChangedEvent, PreviousAddresses: previous, PreviousPodCIDRs: []string{"10.244.9.0/24"}})
+		Expect(record.PreviousAddresses).To(Equal(previous))
+		Expect(record.PreviousPodCIDRs).To(BeNil())
+
+		record = NewNodeRecord(&NodeRecordConfig{Node: node, Event: NodeLeaveEvent, PreviousAddresses: previous})
+		Expect(record.PreviousAddresses).To(BeNil())
+		Expect(record.DeletionTimestamp).NotTo(BeEmpty())
+	})
+})
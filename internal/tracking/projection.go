@@ -0,0 +1,251 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/gobwas/glob"
+)
+
+const (
+	// maskedValue replaces the value of masked keys
+	maskedValue = "********"
+	// hashedValuePrefix is prepended to the hex encoded SHA-256 of hashed values
+	hashedValuePrefix = "sha256:"
+)
+
+// ProjectionConfig describes how the labels and annotations of a Pod are projected into a PodInfo record before it reaches any writer
+// +kubebuilder:object:generate=true
+type ProjectionConfig struct {
+	// Labels configures which Pod labels are recorded and how
+	//+optional
+	Labels *KeyProjection `json:"labels,omitempty"`
+
+	// Annotations configures which Pod annotations are recorded and how
+	//+optional
+	Annotations *KeyProjection `json:"annotations,omitempty"`
+
+	// MaxValueBytes is the maximum size of a single label or annotation value.
+	// Larger values are replaced by a placeholder that only records their original size
+	//+optional
+	MaxValueBytes *int32 `json:"maxValueBytes,omitempty"`
+
+	// compiled holds the compiled key patterns, once the ProjectionConfig has been compiled (see Compile)
+	compiled *compiledProjection `json:"-"`
+}
+
+// KeyProjection selects and transforms the keys of a map of labels or annotations.
+// Every list accepts (globbable) keys, e.g. "kubectl.kubernetes.io/*"
+// +kubebuilder:object:generate=true
+type KeyProjection struct {
+	// Allow is a list of keys to record. If empty, all keys are allowed
+	//+optional
+	Allow []string `json:"allow,omitempty"`
+
+	// Deny is a list of keys which are never recorded, even if they are allowed
+	//+optional
+	Deny []string `json:"deny,omitempty"`
+
+	// Hash is a list of keys whose values are replaced with their (unkeyed) SHA-256 hash, so that they can be correlated across records.
+	// Hashing does not anonymise values: values which can be guessed (e.g. names, emails or IPs) are recovered by hashing candidates,
+	// so keys whose values must not be recoverable should be masked or denied instead
+	//+optional
+	Hash []string `json:"hash,omitempty"`
+
+	// Mask is a list of keys whose values are replaced with a fixed placeholder
+	//+optional
+	Mask []string `json:"mask,omitempty"`
+}
+
+// compiledProjection holds the compiled key patterns of a ProjectionConfig
+type compiledProjection struct {
+	labels      *compiledKeyProjection
+	annotations *compiledKeyProjection
+}
+
+// compiledKeyProjection holds the compiled key patterns of a KeyProjection
+type compiledKeyProjection struct {
+	allow []glob.Glob
+	deny  []glob.Glob
+	hash  []glob.Glob
+	mask  []glob.Glob
+}
+
+// DeepCopyInto copies the compiled patterns into out. Compiled patterns are never modified, so the copies share them
+func (in *compiledProjection) DeepCopyInto(out *compiledProjection) {
+	*out = *in
+}
+
+// compileKeyPatterns compiles the provided (globbable) key patterns. An error is returned for the first pattern that is not a valid glob
+func compileKeyPatterns(patterns []string) ([]glob.Glob, error) {
+	globs := make([]glob.Glob, 0, len(patterns))
+	for _, pattern := range patterns {
+		g, err := glob.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key pattern %q: %w", pattern, err)
+		}
+		globs = append(globs, g)
+	}
+	return globs, nil
+}
+
+// keyMatches takes a key and a list of compiled patterns and returns true if the key matches any of the patterns
+func keyMatches(key string, globs []glob.Glob) bool {
+	for _, g := range globs {
+		if g.Match(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// compile compiles the key patterns of the KeyProjection (if any)
+func (k *KeyProjection) compile() (*compiledKeyProjection, error) {
+	if k == nil {
+		return nil, nil
+	}
+
+	compiled := &compiledKeyProjection{}
+	for _, list := range []struct {
+		patterns []string
+		globs    *[]glob.Glob
+	}{
+		{k.Allow, &compiled.allow},
+		{k.Deny, &compiled.deny},
+		{k.Hash, &compiled.hash},
+		{k.Mask, &compiled.mask},
+	} {
+		globs, err := compileKeyPatterns(list.patterns)
+		if err != nil {
+			return nil, err
+		}
+		*list.globs = globs
+	}
+	return compiled, nil
+}
+
+// project returns a new map containing the entries of values that are selected by the compiled KeyProjection (if any), with their values
+// hashed, masked or replaced when they are larger than maxValueBytes
+func (k *compiledKeyProjection) project(values map[string]string, maxValueBytes *int32) map[string]string {
+	if values == nil {
+		return nil
+	}
+
+	projected := make(map[string]string, len(values))
+	for key, value := range values {
+		if k != nil {
+			if !k.selects(key) {
+				continue
+			}
+
+			switch {
+			case keyMatches(key, k.mask):
+				value = maskedValue
+			case keyMatches(key, k.hash):
+				sum := sha256.Sum256([]byte(value))
+				value = hashedValuePrefix + hex.EncodeToString(sum[:])
+			}
+		}
+
+		if maxValueBytes != nil && len(value) > int(*maxValueBytes) {
+			value = fmt.Sprintf("<omitted: %d bytes>", len(value))
+		}
+
+		projected[key] = value
+	}
+
+	return projected
+}
+
+// selects returns true if the key is allowed and not denied by the compiled KeyProjection
+func (k *compiledKeyProjection) selects(key string) bool {
+	if len(k.allow) > 0 && !keyMatches(key, k.allow) {
+		return false
+	}
+	return !keyMatches(key, k.deny)
+}
+
+// compile compiles the key patterns of the ProjectionConfig
+func (p *ProjectionConfig) compile() (*compiledProjection, error) {
+	labels, err := p.Labels.compile()
+	if err != nil {
+		return nil, fmt.Errorf("unable to compile label patterns: %w", err)
+	}
+	annotations, err := p.Annotations.compile()
+	if err != nil {
+		return nil, fmt.Errorf("unable to compile annotation patterns: %w", err)
+	}
+	return &compiledProjection{labels: labels, annotations: annotations}, nil
+}
+
+// Compile compiles the key patterns of the ProjectionConfig once, so that they aren't compiled again for every record projected with it
+// (or with its deep copies). The patterns are left uncompiled if any of them is not a valid glob, so that Project keeps reporting the error
+func (p *ProjectionConfig) Compile() {
+	if p == nil {
+		return
+	}
+	if compiled, err := p.compile(); err == nil {
+		p.compiled = compiled
+	}
+}
+
+// Project applies the ProjectionConfig to the provided PodInfo. The labels and annotations of the PodInfo are replaced with projected copies,
+// so the maps that they referenced originally (which may be shared with the Pod object) are never modified. The network interfaces of the
+// PodInfo are parsed from the network-status annotation, so they are removed unless the annotation is recorded as is.
+// An error is returned, and the PodInfo is left unmodified, if any of the key patterns is not a valid glob
+func (p *ProjectionConfig) Project(info *PodInfo) error {
+	if p == nil {
+		return nil
+	}
+
+	compiled := p.compiled
+	if compiled == nil {
+		var err error
+		if compiled, err = p.compile(); err != nil {
+			return err
+		}
+	}
+
+	annotations := compiled.annotations.project(info.Annotations, p.MaxValueBytes)
+	if status, ok := annotations[NetworkStatusAnnotation]; !ok || status != info.Annotations[NetworkStatusAnnotation] {
+		info.Interfaces = nil
+	}
+
+	info.Labels = compiled.labels.project(info.Labels, p.MaxValueBytes)
+	info.Annotations = annotations
+	return nil
+}
+
+// Validate returns an error for the first key pattern that is not a valid glob
+func (p *ProjectionConfig) Validate() error {
+	_, err := p.compile()
+	return err
+}
@@ -0,0 +1,149 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ProjectionConfig", func() {
+	var info *PodInfo
+
+	BeforeEach(func() {
+		info = &PodInfo{
+			Labels: map[string]string{
+				"app":                    "api",
+				"team.example.com/owner": "network",
+				"internal-token":         "s3cr3t",
+			},
+			Annotations: map[string]string{
+				"kubectl.kubernetes.io/last-applied-configuration": strings.Repeat("x", 4096),
+				"example.com/contact":                              "someone@example.com",
+			},
+		}
+	})
+
+	It("leaves records untouched when not configured", func() {
+		var p *ProjectionConfig
+		Expect(p.Project(info)).To(Succeed())
+		Expect(info.Labels).To(HaveLen(3))
+		Expect(info.Annotations).To(HaveLen(2))
+	})
+
+	It("applies allow and deny lists", func() {
+		labels := info.Labels
+		Expect((&ProjectionConfig{
+			Labels: &KeyProjection{
+				Allow: []string{"app", "*.example.com/*", "internal-*"},
+				Deny:  []string{"internal-*"},
+			},
+			Annotations: &KeyProjection{
+				Deny: []string{"kubectl.kubernetes.io/*"},
+			},
+		}).Project(info)).To(Succeed())
+
+		Expect(info.Labels).To(Equal(map[string]string{"app": "api", "team.example.com/owner": "network"}))
+		Expect(info.Annotations).To(Equal(map[string]string{"example.com/contact": "someone@example.com"}))
+
+		// the original map (shared with the Pod) must not be modified
+		Expect(labels).To(HaveKey("internal-token"))
+	})
+
+	It("hashes, masks and size limits values", func() {
+		maxValueBytes := int32(256)
+		Expect((&ProjectionConfig{
+			Labels: &KeyProjection{
+				Mask: []string{"internal-token"},
+			},
+			Annotations: &KeyProjection{
+				Hash: []string{"example.com/contact"},
+			},
+			MaxValueBytes: &maxValueBytes,
+		}).Project(info)).To(Succeed())
+
+		Expect(info.Labels).To(HaveKeyWithValue("internal-token", maskedValue))
+		Expect(info.Annotations).To(HaveKeyWithValue("example.com/contact", HavePrefix(hashedValuePrefix)))
+		Expect(info.Annotations).To(HaveKeyWithValue("kubectl.kubernetes.io/last-applied-configuration", "<omitted: 4096 bytes>"))
+	})
+
+	It("rejects invalid key patterns", func() {
+		Expect((&ProjectionConfig{Labels: &KeyProjection{Allow: []string{"app-["}}}).Validate()).NotTo(Succeed())
+	})
+
+	It("returns an error instead of projecting with invalid key patterns", func() {
+		labels := info.Labels
+		Expect((&ProjectionConfig{Labels: &KeyProjection{Deny: []string{"app-["}}}).Project(info)).NotTo(Succeed())
+		Expect(info.Labels).To(Equal(labels))
+	})
+
+	It("projects with the key patterns compiled once, which are shared by its deep copies", func() {
+		p := &ProjectionConfig{Labels: &KeyProjection{Allow: []string{"app"}}}
+		p.Compile()
+		Expect(p.compiled).NotTo(BeNil())
+
+		copied := p.DeepCopy()
+		Expect(copied.compiled).NotTo(BeIdenticalTo(p.compiled))
+		Expect(copied.compiled.labels).To(BeIdenticalTo(p.compiled.labels))
+
+		Expect(copied.Project(info)).To(Succeed())
+		Expect(info.Labels).To(Equal(map[string]string{"app": "api"}))
+	})
+
+	It("leaves invalid key patterns uncompiled", func() {
+		p := &ProjectionConfig{Labels: &KeyProjection{Deny: []string{"app-["}}}
+		p.Compile()
+		Expect(p.compiled).To(BeNil())
+		Expect(p.Project(info)).NotTo(Succeed())
+	})
+
+	Context("with a network-status annotation", func() {
+		BeforeEach(func() {
+			info.Annotations[NetworkStatusAnnotation] = `[{"name": "cbr0", "interface": "eth0", "ips": ["10.244.0.17"], "default": true}]`
+			info.Interfaces = []NetworkInterface{{Network: "cbr0", Interface: "eth0", IPs: []string{"10.244.0.17"}, Default: true}}
+		})
+
+		It("keeps the network interfaces when the annotation is recorded as is", func() {
+			Expect((&ProjectionConfig{Annotations: &KeyProjection{Deny: []string{"kubectl.kubernetes.io/*"}}}).Project(info)).To(Succeed())
+			Expect(info.Interfaces).To(HaveLen(1))
+		})
+
+		DescribeTable("removes the network interfaces when the annotation isn't recorded as is",
+			func(annotations *KeyProjection) {
+				Expect((&ProjectionConfig{Annotations: annotations}).Project(info)).To(Succeed())
+				Expect(info.Interfaces).To(BeNil())
+			},
+			Entry("not allowed", &KeyProjection{Allow: []string{"example.com/*"}}),
+			Entry("denied", &KeyProjection{Deny: []string{"k8s.v1.cni.cncf.io/*"}}),
+			Entry("hashed", &KeyProjection{Hash: []string{NetworkStatusAnnotation}}),
+			Entry("masked", &KeyProjection{Mask: []string{NetworkStatusAnnotation}}),
+		)
+	})
+})
@@ -0,0 +1,252 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// ResourceRule describes a resource holding IPs which are not allocated to Pods or Services (e.g. CNI endpoints or egress gateways),
+// and where its identifier and IPs are found
+// +kubebuilder:object:generate=true
+type ResourceRule struct {
+	// Group is the API group of the resource. It is empty for the core API group
+	//+optional
+	Group string `json:"group,omitempty"`
+	// Version is the API version of the resource
+	Version string `json:"version"`
+	// Kind is the kind of the resource
+	Kind string `json:"kind"`
+
+	// IDPath is a JSONPath expression (e.g. "{.status.id}") of the identifier of the resource. If not set, the UID of the resource is used
+	//+optional
+	IDPath string `json:"idPath,omitempty"`
+	// IPPaths are JSONPath expressions of the IPs held by the resource (e.g. "{.status.networking.addressing[*].ipv4}").
+	// A field may hold a single IP or a list of IPs
+	IPPaths []string `json:"ipPaths"`
+}
+
+// GroupVersionKind returns the GroupVersionKind of the resource described by the ResourceRule
+func (r ResourceRule) GroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: r.Group, Version: r.Version, Kind: r.Kind}
+}
+
+// Validate returns an error if any of the JSONPath expressions of the ResourceRule can't be parsed
+func (r ResourceRule) Validate() error {
+	for _, path := range append([]string{r.IDPath}, r.IPPaths...) {
+		if path == "" {
+			continue
+		}
+		if err := jsonpath.New("rule").Parse(path); err != nil {
+			return fmt.Errorf("invalid JSONPath expression %q: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// ID returns the identifier of the provided resource
+func (r ResourceRule) ID(obj *unstructured.Unstructured) (string, error) {
+	if r.IDPath == "" {
+		return string(obj.GetUID()), nil
+	}
+
+	values, err := evaluateJSONPath(r.IDPath, obj)
+	if err != nil || len(values) == 0 {
+		return "", err
+	}
+	return values[0], nil
+}
+
+// IPs returns the IPs held by the provided resource, in the order of the IPPaths they are found at
+func (r ResourceRule) IPs(obj *unstructured.Unstructured) ([]IPAddress, error) {
+	ips := []IPAddress{}
+	for _, path := range r.IPPaths {
+		values, err := evaluateJSONPath(path, obj)
+		if err != nil {
+			return nil, err
+		}
+		ips = append(ips, newIPAddresses(values...)...)
+	}
+	return ips, nil
+}
+
+// evaluateJSONPath returns the string values found at the provided JSONPath expression. Lists are flattened, and missing fields are ignored
+func evaluateJSONPath(path string, obj *unstructured.Unstructured) ([]string, error) {
+	j := jsonpath.New("rule").AllowMissingKeys(true)
+	if err := j.Parse(path); err != nil {
+		return nil, err
+	}
+	results, err := j.FindResults(obj.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	values := []string{}
+	for _, result := range results {
+		for _, value := range result {
+			values = append(values, flattenJSONPathValue(value)...)
+		}
+	}
+	return values, nil
+}
+
+// flattenJSONPathValue returns the string values of a JSONPath result, which may be a scalar or a list
+func flattenJSONPathValue(value reflect.Value) []string {
+	for value.Kind() == reflect.Interface || value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		values := []string{}
+		for i := 0; i < value.Len(); i++ {
+			values = append(values, flattenJSONPathValue(value.Index(i))...)
+		}
+		return values
+	case reflect.Map, reflect.Struct:
+		// objects are not identifiers or IPs
+		return nil
+	default:
+		return []string{fmt.Sprint(value.Interface())}
+	}
+}
+
+// ResourceEvent describes what kind of change the IPs of a resource have undergone
+type ResourceEvent string
+
+const (
+	// ResourceCreateEvent is emitted when IPs are first observed for a resource
+	ResourceCreateEvent ResourceEvent = "Create"
+	// ResourceIPChangedEvent is emitted when the IPs of a recorded resource change
+	ResourceIPChangedEvent ResourceEvent = "IPChanged"
+	// ResourceDeleteEvent is emitted when a recorded resource is deleted and its IPs are released
+	ResourceDeleteEvent ResourceEvent = "Delete"
+)
+
+// ResourceRecordType is the recordType of every ResourceRecord, which tells them apart from PodInfo records in the same stream
+const ResourceRecordType = "Resource"
+
+// ResourceRecordConfig describes a ResourceRecord
+type ResourceRecordConfig struct {
+	Object *unstructured.Unstructured
+	Event  ResourceEvent
+	// ResourceID and IPs are the identifier and IPs of the resource, as found with its ResourceRule
+	ResourceID string
+	IPs        []IPAddress
+	// PreviousIPs are the IPs the resource had before an IPChanged event
+	PreviousIPs []IPAddress
+}
+
+// ResourceRecord describes the IPs held by a resource tracked with a ResourceRule. ResourceRecords are written by the same BackendWriters
+// as PodInfo records, and are told apart by their recordType
+type ResourceRecord struct {
+	SchemaVersion     SchemaVersion `json:"schemaVersion"`
+	RecordType        string        `json:"recordType"`
+	TrackedBy         string        `json:"trackedBy,omitempty"`
+	ID                string        `json:"id"`
+	Event             ResourceEvent `json:"event"`
+	APIVersion        string        `json:"apiVersion"`
+	Kind              string        `json:"kind"`
+	Name              string        `json:"name"`
+	Namespace         string        `json:"namespace,omitempty"`
+	ResourceID        string        `json:"resourceID"`
+	CreationTimestamp string        `json:"creationTimestamp"`
+	DeletionTimestamp string        `json:"deletionTimestamp,omitempty"`
+	IPs               []IPAddress   `json:"ips"`
+	// PreviousIPs is only set for IPChanged events
+	PreviousIPs []IPAddress `json:"previousIPs,omitempty"`
+
+	// InstanceInfo identifies the cluster and the controller process which emitted the record (see Instance)
+	InstanceInfo
+
+	// Chain, Sequence, PreviousHash and Signature are only set when integrity is enabled for the PodTracker (see IntegrityConfig)
+	Chain        string `json:"chain,omitempty"`
+	Sequence     uint64 `json:"sequence,omitempty"`
+	PreviousHash string `json:"previousHash,omitempty"`
+	Signature    string `json:"signature,omitempty"`
+
+	// creation and deletion are the unformatted timestamps of the ResourceRecord
+	creation time.Time
+	deletion time.Time
+}
+
+// NewResourceRecord creates a new ResourceRecord
+func NewResourceRecord(cfg *ResourceRecordConfig) *ResourceRecord {
+	record := &ResourceRecord{
+		SchemaVersion: CurrentSchemaVersion,
+		RecordType:    ResourceRecordType,
+		ID:            string(cfg.Object.GetUID()),
+		Event:         cfg.Event,
+		APIVersion:    cfg.Object.GetAPIVersion(),
+		Kind:          cfg.Object.GetKind(),
+		Name:          cfg.Object.GetName(),
+		Namespace:     cfg.Object.GetNamespace(),
+		ResourceID:    cfg.ResourceID,
+		IPs:           cfg.IPs,
+		creation:      cfg.Object.GetCreationTimestamp().Time,
+	}
+
+	switch record.Event {
+	case ResourceIPChangedEvent:
+		record.PreviousIPs = cfg.PreviousIPs
+	case ResourceDeleteEvent:
+		record.deletion = time.Now()
+		if deletion := cfg.Object.GetDeletionTimestamp(); deletion != nil {
+			record.deletion = deletion.Time
+		}
+	}
+
+	record.FormatTimestamps(RFC3339NanoTimestampFormat)
+	return record
+}
+
+// FormatTimestamps formats the timestamps of the ResourceRecord with the provided format (RFC3339Nano if empty)
+func (r *ResourceRecord) FormatTimestamps(format TimestampFormat) {
+	r.CreationTimestamp = format.format(r.creation)
+	r.DeletionTimestamp = format.format(r.deletion)
+}
+
+// Link implements Record
+func (r *ResourceRecord) Link() ChainLink {
+	return ChainLink{Chain: r.Chain, Sequence: r.Sequence, PreviousHash: r.PreviousHash, Signature: r.Signature}
+}
+
+func (r *ResourceRecord) withLink(link ChainLink) Record {
+	linked := *r
+	linked.Chain, linked.Sequence, linked.PreviousHash, linked.Signature = link.Chain, link.Sequence, link.PreviousHash, link.Signature
+	return &linked
+}
@@ -0,0 +1,88 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = Describe("ResourceRule", func() {
+	var endpoint *unstructured.Unstructured
+
+	BeforeEach(func() {
+		endpoint = &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "cilium.io/v2",
+			"kind":       "CiliumEndpoint",
+			"metadata":   map[string]interface{}{"name": "api", "namespace": "app", "uid": "endpoint-uid"},
+			"status": map[string]interface{}{
+				"id": int64(1234),
+				"networking": map[string]interface{}{
+					"addressing": []interface{}{
+						map[string]interface{}{"ipv4": "10.244.0.17", "ipv6": "fd00::17"},
+					},
+				},
+			},
+		}}
+	})
+
+	It("finds the identifier and IPs of a resource", func() {
+		rule := ResourceRule{
+			Group:   "cilium.io",
+			Version: "v2",
+			Kind:    "CiliumEndpoint",
+			IDPath:  "{.status.id}",
+			IPPaths: []string{"{.status.networking.addressing[*].ipv4}", "{.status.networking.addressing[*].ipv6}"},
+		}
+		Expect(rule.Validate()).To(Succeed())
+		Expect(rule.GroupVersionKind()).To(Equal(endpoint.GroupVersionKind()))
+
+		Expect(rule.ID(endpoint)).To(Equal("1234"))
+		Expect(rule.IPs(endpoint)).To(Equal([]IPAddress{
+			{IP: "10.244.0.17", Family: corev1.IPv4Protocol},
+			{IP: "fd00::17", Family: corev1.IPv6Protocol},
+		}))
+	})
+
+	It("flattens lists of IPs and ignores missing fields", func() {
+		Expect(unstructured.SetNestedStringSlice(endpoint.Object, []string{"192.0.2.1", "192.0.2.2"}, "spec", "egressIPs")).To(Succeed())
+		rule := ResourceRule{IPPaths: []string{"{.spec.egressIPs}", "{.status.missing}"}}
+
+		Expect(rule.ID(endpoint)).To(Equal("endpoint-uid"))
+		Expect(rule.IPs(endpoint)).To(Equal([]IPAddress{
+			{IP: "192.0.2.1", Family: corev1.IPv4Protocol},
+			{IP: "192.0.2.2", Family: corev1.IPv4Protocol},
+		}))
+	})
+
+	It("rejects invalid JSONPath expressions", func() {
+		Expect(ResourceRule{IPPaths: []string{"{.status.ips"}}.Validate()).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,256 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SchemaVersion identifies the shape of a PodInfo record. Fields may be added to a schema version,
+// but fields are only removed, renamed or changed in a new schema version
+// +kubebuilder:validation:Enum=v1;v2
+type SchemaVersion string
+
+const (
+	// SchemaVersionV1 is the shape of the records written by PodTracker 1.0.0: only Create and Delete events, with legacy timestamps.
+	// v1 records don't have a schemaVersion field. Deprecated: v1 records will no longer be producible in a future release
+	SchemaVersionV1 SchemaVersion = "v1"
+	// SchemaVersionV2 is the current shape of the records
+	SchemaVersionV2 SchemaVersion = "v2"
+
+	// CurrentSchemaVersion is the version of the records written by PodTrackers that don't set a schema version
+	CurrentSchemaVersion = SchemaVersionV2
+)
+
+// SchemaVersions lists every schema version that records can be produced in, from oldest to newest
+var SchemaVersions = []SchemaVersion{SchemaVersionV1, SchemaVersionV2}
+
+// IsDeprecated returns true if the schema version will no longer be producible in a future release
+func (v SchemaVersion) IsDeprecated() bool {
+	return v == SchemaVersionV1
+}
+
+// podInfoV1 is the shape of v1 records. The integrity fields are included, as they are only set when integrity is enabled for the PodTracker
+type podInfoV1 struct {
+	TrackedBy         string              `json:"trackedBy,omitempty"`
+	ID                string              `json:"id"`
+	Event             PodEvent            `json:"event"`
+	Name              string              `json:"name"`
+	Namespace         string              `json:"namespace"`
+	Labels            map[string]string   `json:"labels"`
+	Annotations       map[string]string   `json:"annotations"`
+	CreationTimestamp string              `json:"creationTimestamp"`
+	DeletionTimestamp string              `json:"deletionTimestamp"`
+	PodIP             string              `json:"podIP"`
+	Node              string              `json:"node"`
+	NodeIPs           map[string][]string `json:"nodeIPs"`
+
+	Sequence     uint64 `json:"sequence,omitempty"`
+	PreviousHash string `json:"previousHash,omitempty"`
+	Signature    string `json:"signature,omitempty"`
+}
+
+// podInfo has the fields of PodInfo without its MarshalJSON method
+type podInfo PodInfo
+
+// MarshalJSON encodes the PodInfo in the shape of its schema version. Records without a schema version are encoded in the CurrentSchemaVersion
+func (p PodInfo) MarshalJSON() ([]byte, error) {
+	if p.SchemaVersion == "" {
+		p.SchemaVersion = CurrentSchemaVersion
+	}
+	if p.SchemaVersion == SchemaVersionV1 {
+		return json.Marshal(podInfoV1{
+			TrackedBy:         p.TrackedBy,
+			ID:                p.ID,
+			Event:             p.Event,
+			Name:              p.Name,
+			Namespace:         p.Namespace,
+			Labels:            p.Labels,
+			Annotations:       p.Annotations,
+			CreationTimestamp: p.CreationTimestamp,
+			DeletionTimestamp: p.DeletionTimestamp,
+			PodIP:             p.PodIP,
+			Node:              p.Node,
+			NodeIPs:           p.NodeIPs,
+			Sequence:          p.Sequence,
+			PreviousHash:      p.PreviousHash,
+			Signature:         p.Signature,
+		})
+	}
+	return json.Marshal(podInfo(p))
+}
+
+// UnmarshalJSON decodes a PodInfo of any schema version. v1 records are the only records encoded without their schema version,
+// so a record without a schema version is decoded as a v1 record (and encoded in the same shape again)
+func (p *PodInfo) UnmarshalJSON(data []byte) error {
+	decoded := podInfo{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if decoded.SchemaVersion == "" {
+		decoded.SchemaVersion = SchemaVersionV1
+	}
+	*p = PodInfo(decoded)
+	return nil
+}
+
+// JSONSchema returns a JSON Schema (draft 2020-12) describing the records of the provided schema version
+func JSONSchema(version SchemaVersion) (map[string]interface{}, error) {
+	var schema map[string]interface{}
+	switch version {
+	case SchemaVersionV1:
+		schema = typeSchema(reflect.TypeOf(podInfoV1{}), false)
+		schema["properties"].(map[string]interface{})["event"] = map[string]interface{}{
+			"type": "string",
+			"enum": []PodEvent{PodCreateEvent, PodDeleteEvent},
+		}
+	case SchemaVersionV2:
+		schema = typeSchema(reflect.TypeOf(podInfo{}), false)
+		schema["properties"].(map[string]interface{})["schemaVersion"] = map[string]interface{}{
+			"type":  "string",
+			"const": version,
+		}
+	default:
+		return nil, fmt.Errorf("unknown schema version %q", version)
+	}
+
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = fmt.Sprintf("PodTracker PodInfo record (%s)", version)
+	return schema, nil
+}
+
+// ServiceRecordJSONSchema returns a JSON Schema (draft 2020-12) describing ServiceRecords, which are only produced in the current schema version
+func ServiceRecordJSONSchema() map[string]interface{} {
+	return recordJSONSchema(reflect.TypeOf(ServiceRecord{}), ServiceRecordType)
+}
+
+// NodeRecordJSONSchema returns a JSON Schema (draft 2020-12) describing NodeRecords, which are only produced in the current schema version
+func NodeRecordJSONSchema() map[string]interface{} {
+	return recordJSONSchema(reflect.TypeOf(NodeRecord{}), NodeRecordType)
+}
+
+// ResourceRecordJSONSchema returns a JSON Schema (draft 2020-12) describing ResourceRecords, which are only produced in the current schema version
+func ResourceRecordJSONSchema() map[string]interface{} {
+	return recordJSONSchema(reflect.TypeOf(ResourceRecord{}), ResourceRecordType)
+}
+
+// InventoryRecordJSONSchema returns a JSON Schema (draft 2020-12) describing InventoryRecords, which are only produced in the current schema version
+func InventoryRecordJSONSchema() map[string]interface{} {
+	return recordJSONSchema(reflect.TypeOf(InventoryRecord{}), InventoryRecordType)
+}
+
+// recordJSONSchema returns the JSON Schema of the provided record type of the current schema version
+func recordJSONSchema(t reflect.Type, recordType string) map[string]interface{} {
+	schema := typeSchema(t, false)
+	properties := schema["properties"].(map[string]interface{})
+	properties["schemaVersion"] = map[string]interface{}{"type": "string", "const": CurrentSchemaVersion}
+	properties["recordType"] = map[string]interface{}{"type": "string", "const": recordType}
+
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = fmt.Sprintf("PodTracker %s record (%s)", recordType, CurrentSchemaVersion)
+	return schema
+}
+
+// typeSchema returns the JSON Schema of the provided type, as encoded by encoding/json. nullable is true if the value may be null
+func typeSchema(t reflect.Type, nullable bool) map[string]interface{} {
+	schema := map[string]interface{}{}
+	typeName := ""
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem(), nullable)
+	case reflect.String:
+		typeName = "string"
+		if t == reflect.TypeOf(PodEvent("")) {
+			schema["enum"] = append([]PodEvent{PodCreateEvent, PodDeleteEvent, PodNetworkUpdateEvent, PodSnapshotEvent}, OptionalPodEvents...)
+		}
+		if t == reflect.TypeOf(ServiceEvent("")) {
+			schema["enum"] = []ServiceEvent{ServiceCreateEvent, ServiceIPChangedEvent, ServiceDeleteEvent}
+		}
+		if t == reflect.TypeOf(NodeEvent("")) {
+			schema["enum"] = []NodeEvent{NodeJoinEvent, NodeAddressesChangedEvent, NodePodCIDRsChangedEvent, NodeLeaveEvent}
+		}
+		if t == reflect.TypeOf(ResourceEvent("")) {
+			schema["enum"] = []ResourceEvent{ResourceCreateEvent, ResourceIPChangedEvent, ResourceDeleteEvent}
+		}
+	case reflect.Bool:
+		typeName = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		typeName = "integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		typeName = "integer"
+		schema["minimum"] = 0
+	case reflect.Float32, reflect.Float64:
+		typeName = "number"
+	case reflect.Slice:
+		typeName = "array"
+		schema["items"] = typeSchema(t.Elem(), false)
+	case reflect.Map:
+		typeName = "object"
+		schema["additionalProperties"] = typeSchema(t.Elem(), false)
+	case reflect.Struct:
+		typeName = "object"
+		properties := map[string]interface{}{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+				// the fields of embedded structs are encoded as fields of the record
+				embedded := typeSchema(field.Type, false)
+				for key, property := range embedded["properties"].(map[string]interface{}) {
+					properties[key] = property
+				}
+				required = append(required, embedded["required"].([]string)...)
+				continue
+			}
+			if !field.IsExported() || name == "-" || name == "" {
+				continue
+			}
+
+			omitEmpty := strings.Contains(options, "omitempty")
+			kind := field.Type.Kind()
+			properties[name] = typeSchema(field.Type, !omitEmpty && (kind == reflect.Pointer || kind == reflect.Slice || kind == reflect.Map))
+			if !omitEmpty {
+				required = append(required, name)
+			}
+		}
+		schema["properties"] = properties
+		schema["required"] = required
+	}
+
+	if nullable {
+		schema["type"] = []string{typeName, "null"}
+	} else {
+		schema["type"] = typeName
+	}
+	return schema
+}
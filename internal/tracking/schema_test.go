@@ -0,0 +1,113 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Schema versions", func() {
+	var info *PodInfo
+
+	// fields returns the fields of the provided record as it is encoded
+	fields := func(info *PodInfo) map[string]interface{} {
+		data, err := json.Marshal(info)
+		Expect(err).NotTo(HaveOccurred())
+		decoded := map[string]interface{}{}
+		Expect(json.Unmarshal(data, &decoded)).To(Succeed())
+		return decoded
+	}
+
+	BeforeEach(func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "api",
+				Namespace:         "app",
+				UID:               "uid",
+				CreationTimestamp: metav1.NewTime(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)),
+			},
+			Spec:   corev1.PodSpec{NodeName: "node-1"},
+			Status: corev1.PodStatus{Phase: corev1.PodSucceeded, PodIP: "10.244.0.17"},
+		}
+		info = New(&PodInfoConfig{Pod: pod, Node: &corev1.Node{}, Event: PodDeleteEvent})
+	})
+
+	It("encodes records in the current schema version", func() {
+		encoded := fields(info)
+		Expect(encoded).To(HaveKeyWithValue("schemaVersion", "v2"))
+		Expect(encoded).To(HaveKeyWithValue("phase", "Succeeded"))
+		Expect(encoded).To(HaveKey("leaseDurationSeconds"))
+	})
+
+	It("encodes v1 records in the shape of PodTracker 1.0.0", func() {
+		info.SchemaVersion = SchemaVersionV1
+		info.FormatTimestamps(RFC3339NanoTimestampFormat)
+
+		encoded := fields(info)
+		Expect(encoded).To(HaveLen(11))
+		Expect(encoded).NotTo(HaveKey("schemaVersion"))
+		Expect(encoded).To(HaveKeyWithValue("creationTimestamp", "2026-10-19T12:00:00+0000"))
+
+		decoded := &PodInfo{}
+		data, err := json.Marshal(info)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(json.Unmarshal(data, decoded)).To(Succeed())
+		Expect(decoded.SchemaVersion).To(Equal(SchemaVersionV1))
+		Expect(fields(decoded)).To(Equal(encoded))
+	})
+
+	It("encodes records without a schema version in the current schema version", func() {
+		info.SchemaVersion = ""
+		Expect(fields(info)).To(HaveKeyWithValue("schemaVersion", string(CurrentSchemaVersion)))
+	})
+
+	It("describes the encoded records", func() {
+		for _, version := range SchemaVersions {
+			info.SchemaVersion = version
+			encoded := fields(info)
+
+			schema, err := JSONSchema(version)
+			Expect(err).NotTo(HaveOccurred())
+			for key := range encoded {
+				Expect(schema["properties"]).To(HaveKey(key), "version %s", version)
+			}
+			for _, key := range schema["required"].([]string) {
+				Expect(encoded).To(HaveKey(key), "version %s", version)
+			}
+		}
+
+		_, err := JSONSchema("v0")
+		Expect(err).To(HaveOccurred())
+	})
+})
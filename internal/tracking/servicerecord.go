@@ -0,0 +1,174 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ServiceEvent describes what kind of change the IPs of a Service have undergone
+type ServiceEvent string
+
+const (
+	// ServiceCreateEvent is emitted when IPs are first observed for a Service
+	ServiceCreateEvent ServiceEvent = "Create"
+	// ServiceIPChangedEvent is emitted when the IPs of a recorded Service change (e.g. when a load balancer is provisioned)
+	ServiceIPChangedEvent ServiceEvent = "IPChanged"
+	// ServiceDeleteEvent is emitted when a recorded Service is deleted and its IPs are released
+	ServiceDeleteEvent ServiceEvent = "Delete"
+)
+
+// ServiceRecordType is the recordType of every ServiceRecord, which tells them apart from PodInfo records in the same stream
+const ServiceRecordType = "Service"
+
+// ServiceIPs are the IPs allocated to a Service
+type ServiceIPs struct {
+	ClusterIPs  []IPAddress `json:"clusterIPs"`
+	ExternalIPs []IPAddress `json:"externalIPs,omitempty"`
+	// LoadBalancerIPs and LoadBalancerHostnames are the ingress points of the load balancer of the Service
+	LoadBalancerIPs       []IPAddress `json:"loadBalancerIPs,omitempty"`
+	LoadBalancerHostnames []string    `json:"loadBalancerHostnames,omitempty"`
+}
+
+// NewServiceIPs returns the IPs allocated to the Service. The cluster IP of headless Services ("None") is not an IP, so it isn't returned
+func NewServiceIPs(svc *corev1.Service) ServiceIPs {
+	clusterIPs := svc.Spec.ClusterIPs
+	if len(clusterIPs) == 0 {
+		clusterIPs = []string{svc.Spec.ClusterIP}
+	}
+
+	ips := ServiceIPs{ClusterIPs: []IPAddress{}}
+	for _, ip := range clusterIPs {
+		if ip != corev1.ClusterIPNone {
+			ips.ClusterIPs = append(ips.ClusterIPs, newIPAddresses(ip)...)
+		}
+	}
+	if len(svc.Spec.ExternalIPs) > 0 {
+		ips.ExternalIPs = newIPAddresses(svc.Spec.ExternalIPs...)
+	}
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			ips.LoadBalancerIPs = append(ips.LoadBalancerIPs, newIPAddresses(ingress.IP)...)
+		}
+		if ingress.Hostname != "" {
+			ips.LoadBalancerHostnames = append(ips.LoadBalancerHostnames, ingress.Hostname)
+		}
+	}
+	return ips
+}
+
+// IsEmpty returns true if no IP is allocated to the Service
+func (s ServiceIPs) IsEmpty() bool {
+	return len(s.ClusterIPs) == 0 && len(s.ExternalIPs) == 0 && len(s.LoadBalancerIPs) == 0 && len(s.LoadBalancerHostnames) == 0
+}
+
+// ServiceRecordConfig describes a ServiceRecord
+type ServiceRecordConfig struct {
+	Service *corev1.Service
+	Event   ServiceEvent
+	// PreviousIPs are the IPs the Service had before an IPChanged event
+	PreviousIPs *ServiceIPs
+}
+
+// ServiceRecord describes the IPs allocated to a Service. ServiceRecords are written by the same BackendWriters as PodInfo records,
+// and are told apart by their recordType
+type ServiceRecord struct {
+	SchemaVersion     SchemaVersion      `json:"schemaVersion"`
+	RecordType        string             `json:"recordType"`
+	TrackedBy         string             `json:"trackedBy,omitempty"`
+	ID                string             `json:"id"`
+	Event             ServiceEvent       `json:"event"`
+	Name              string             `json:"name"`
+	Namespace         string             `json:"namespace"`
+	Type              corev1.ServiceType `json:"type"`
+	CreationTimestamp string             `json:"creationTimestamp"`
+	DeletionTimestamp string             `json:"deletionTimestamp,omitempty"`
+	IPs               ServiceIPs         `json:"ips"`
+	// PreviousIPs is only set for IPChanged events
+	PreviousIPs *ServiceIPs `json:"previousIPs,omitempty"`
+
+	// InstanceInfo identifies the cluster and the controller process which emitted the record (see Instance)
+	InstanceInfo
+
+	// Chain, Sequence, PreviousHash and Signature are only set when integrity is enabled for the PodTracker (see IntegrityConfig)
+	Chain        string `json:"chain,omitempty"`
+	Sequence     uint64 `json:"sequence,omitempty"`
+	PreviousHash string `json:"previousHash,omitempty"`
+	Signature    string `json:"signature,omitempty"`
+
+	// creation and deletion are the unformatted timestamps of the ServiceRecord
+	creation time.Time
+	deletion time.Time
+}
+
+// NewServiceRecord creates a new ServiceRecord
+func NewServiceRecord(cfg *ServiceRecordConfig) *ServiceRecord {
+	record := &ServiceRecord{
+		SchemaVersion: CurrentSchemaVersion,
+		RecordType:    ServiceRecordType,
+		ID:            string(cfg.Service.GetUID()),
+		Event:         cfg.Event,
+		Name:          cfg.Service.GetName(),
+		Namespace:     cfg.Service.GetNamespace(),
+		Type:          cfg.Service.Spec.Type,
+		IPs:           NewServiceIPs(cfg.Service),
+		creation:      cfg.Service.GetCreationTimestamp().Time,
+	}
+
+	switch record.Event {
+	case ServiceIPChangedEvent:
+		record.PreviousIPs = cfg.PreviousIPs
+	case ServiceDeleteEvent:
+		record.deletion = time.Now()
+		if deletion := cfg.Service.GetDeletionTimestamp(); deletion != nil {
+			record.deletion = deletion.Time
+		}
+	}
+
+	record.FormatTimestamps(RFC3339NanoTimestampFormat)
+	return record
+}
+
+// FormatTimestamps formats the timestamps of the ServiceRecord with the provided format (RFC3339Nano if empty)
+func (s *ServiceRecord) FormatTimestamps(format TimestampFormat) {
+	s.CreationTimestamp = format.format(s.creation)
+	s.DeletionTimestamp = format.format(s.deletion)
+}
+
+// Link implements Record
+func (s *ServiceRecord) Link() ChainLink {
+	return ChainLink{Chain: s.Chain, Sequence: s.Sequence, PreviousHash: s.PreviousHash, Signature: s.Signature}
+}
+
+func (s *ServiceRecord) withLink(link ChainLink) Record {
+	linked := *s
+	linked.Chain, linked.Sequence, linked.PreviousHash, linked.Signature = link.Chain, link.Sequence, link.PreviousHash, link.Signature
+	return &linked
+}
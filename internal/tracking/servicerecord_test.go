@@ -0,0 +1,118 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("ServiceRecord", func() {
+	var svc *corev1.Service
+
+	BeforeEach(func() {
+		svc = &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "api",
+				Namespace:         "app",
+				UID:               "svc-uid",
+				CreationTimestamp: metav1.NewTime(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)),
+			},
+			Spec: corev1.ServiceSpec{
+				Type:       corev1.ServiceTypeLoadBalancer,
+				ClusterIP:  "10.96.0.10",
+				ClusterIPs: []string{"10.96.0.10", "fd00::10"},
+			},
+		}
+	})
+
+	It("records the cluster, external and load balancer IPs of a service", func() {
+		svc.Spec.ExternalIPs = []string{"192.0.2.10"}
+		svc.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "203.0.113.7"}, {Hostname: "api.example.com"}}
+
+		Expect(NewServiceIPs(svc)).To(Equal(ServiceIPs{
+			ClusterIPs:            []IPAddress{{IP: "10.96.0.10", Family: corev1.IPv4Protocol}, {IP: "fd00::10", Family: corev1.IPv6Protocol}},
+			ExternalIPs:           []IPAddress{{IP: "192.0.2.10", Family: corev1.IPv4Protocol}},
+			LoadBalancerIPs:       []IPAddress{{IP: "203.0.113.7", Family: corev1.IPv4Protocol}},
+			LoadBalancerHostnames: []string{"api.example.com"},
+		}))
+	})
+
+	It("does not record the cluster IP of headless services", func() {
+		svc.Spec.ClusterIP, svc.Spec.ClusterIPs = corev1.ClusterIPNone, []string{corev1.ClusterIPNone}
+		Expect(NewServiceIPs(svc).IsEmpty()).To(BeTrue())
+	})
+
+	It("records the previous IPs of IPChanged events only", func() {
+		previous := NewServiceIPs(svc)
+		svc.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "203.0.113.7"}}
+
+		record := NewServiceRecord(&ServiceRecordConfig{Service: svc, Event: ServiceIPChangedEvent, PreviousIPs: &previous})
+		Expect(record.PreviousIPs).To(Equal(&previous))
+		Expect(record.IPs.LoadBalancerIPs).To(HaveLen(1))
+		Expect(record.DeletionTimestamp).To(BeEmpty())
+
+		record = NewServiceRecord(&ServiceRecordConfig{Service: svc, Event: ServiceDeleteEvent, PreviousIPs: &previous})
+		Expect(record.PreviousIPs).To(BeNil())
+		Expect(record.DeletionTimestamp).NotTo(BeEmpty())
+	})
+
+	It("is told apart from pod records by its record type", func() {
+		data, err := json.Marshal(NewServiceRecord(&ServiceRecordConfig{Service: svc, Event: ServiceCreateEvent}))
+		Expect(err).NotTo(HaveOccurred())
+
+		fields := map[string]interface{}{}
+		Expect(json.Unmarshal(data, &fields)).To(Succeed())
+		Expect(fields).To(HaveKeyWithValue("recordType", ServiceRecordType))
+		Expect(fields).To(HaveKeyWithValue("schemaVersion", string(SchemaVersionV2)))
+		Expect(fields).To(HaveKeyWithValue("creationTimestamp", "2026-10-19T12:00:00Z"))
+	})
+
+	It("is linked into the hash chain of a writer like pod records", func() {
+		chain := NewChain("chain", []byte("key"))
+		first, err := chain.Next(&PodInfo{ID: "pod"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(chain.Commit(first)).To(Succeed())
+
+		second, err := chain.Next(NewServiceRecord(&ServiceRecordConfig{Service: svc, Event: ServiceCreateEvent}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(chain.Commit(second)).To(Succeed())
+
+		verifier := &Verifier{Key: []byte("key")}
+		for _, record := range []Record{first, second} {
+			raw, err := json.Marshal(record)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verifier.Verify(record, raw)).To(BeEmpty())
+		}
+	})
+})
@@ -0,0 +1,127 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+// ServiceInfo describes a Service fronting a Pod, which is found from the EndpointSlices referencing the Pod
+type ServiceInfo struct {
+	Name string `json:"name"`
+	// ClusterIPs are the cluster IPs of the Service. Headless Services don't have any
+	ClusterIPs []string      `json:"clusterIPs,omitempty"`
+	Ports      []ServicePort `json:"ports,omitempty"`
+}
+
+// ServicePort is a port of a Service, along with the port of the Pod that it targets
+type ServicePort struct {
+	Name       string          `json:"name,omitempty"`
+	Port       int32           `json:"port"`
+	TargetPort int32           `json:"targetPort,omitempty"`
+	Protocol   corev1.Protocol `json:"protocol,omitempty"`
+}
+
+// EndpointSliceReferencesPod returns true if any of the endpoints of the EndpointSlice targets the Pod
+func EndpointSliceReferencesPod(slice *discoveryv1.EndpointSlice, pod *corev1.Pod) bool {
+	for _, endpoint := range slice.Endpoints {
+		if ref := endpoint.TargetRef; ref != nil && ref.Kind == "Pod" && ref.UID == pod.GetUID() {
+			return true
+		}
+	}
+	return false
+}
+
+// PodServices returns the Services fronting the Pod, sorted by name. slices are the EndpointSlices of the Pod's namespace,
+// and services are the Services they belong to by name. Services which aren't found are recorded by name only
+func PodServices(pod *corev1.Pod, slices []discoveryv1.EndpointSlice, services map[string]*corev1.Service) []ServiceInfo {
+	// the ports of the Pod targeted by each Service, by Service port name
+	targetPorts := map[string]map[string]int32{}
+	for i := range slices {
+		name := slices[i].GetLabels()[discoveryv1.LabelServiceName]
+		if name == "" || !EndpointSliceReferencesPod(&slices[i], pod) {
+			continue
+		}
+
+		if targetPorts[name] == nil {
+			targetPorts[name] = map[string]int32{}
+		}
+		for _, port := range slices[i].Ports {
+			if port.Port != nil {
+				targetPorts[name][stringOrEmpty(port.Name)] = *port.Port
+			}
+		}
+	}
+	if len(targetPorts) == 0 {
+		return nil
+	}
+
+	infos := make([]ServiceInfo, 0, len(targetPorts))
+	for name, ports := range targetPorts {
+		info := ServiceInfo{Name: name}
+		if svc, ok := services[name]; ok && svc != nil {
+			for _, ip := range svc.Spec.ClusterIPs {
+				if ip != corev1.ClusterIPNone && ip != "" {
+					info.ClusterIPs = append(info.ClusterIPs, ip)
+				}
+			}
+			for _, port := range svc.Spec.Ports {
+				info.Ports = append(info.Ports, ServicePort{
+					Name:       port.Name,
+					Port:       port.Port,
+					TargetPort: ports[port.Name],
+					Protocol:   port.Protocol,
+				})
+			}
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// ServiceNames returns the names of the provided Services
+func ServiceNames(services []ServiceInfo) []string {
+	names := make([]string, 0, len(services))
+	for _, svc := range services {
+		names = append(names, svc.Name)
+	}
+	return names
+}
+
+// stringOrEmpty returns the value of the provided string pointer, or an empty string if it is nil
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
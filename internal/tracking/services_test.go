@@ -0,0 +1,109 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Services", func() {
+	var pod *corev1.Pod
+
+	// endpointSlice returns an EndpointSlice of the named Service targeting the Pods with the provided UIDs on port 8080
+	endpointSlice := func(service string, uids ...string) discoveryv1.EndpointSlice {
+		portName, port := "http", int32(8080)
+		slice := discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{discoveryv1.LabelServiceName: service}},
+			Ports:      []discoveryv1.EndpointPort{{Name: &portName, Port: &port}},
+		}
+		for _, uid := range uids {
+			slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+				TargetRef: &corev1.ObjectReference{Kind: "Pod", UID: k8stypes.UID(uid)},
+			})
+		}
+		return slice
+	}
+
+	BeforeEach(func() {
+		pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "app", UID: "pod-uid"}}
+	})
+
+	It("finds the services fronting a pod from the endpoint slices referencing it", func() {
+		slices := []discoveryv1.EndpointSlice{
+			endpointSlice("web", "other-uid", "pod-uid"),
+			endpointSlice("api", "pod-uid"),
+			endpointSlice("db", "other-uid"),
+			endpointSlice("", "pod-uid"),
+		}
+		services := map[string]*corev1.Service{
+			"api": {Spec: corev1.ServiceSpec{
+				ClusterIPs: []string{"10.96.0.10", "fd00::10"},
+				Ports:      []corev1.ServicePort{{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP}},
+			}},
+			"web": {Spec: corev1.ServiceSpec{ClusterIPs: []string{corev1.ClusterIPNone}}},
+		}
+
+		Expect(PodServices(pod, slices, services)).To(Equal([]ServiceInfo{
+			{
+				Name:       "api",
+				ClusterIPs: []string{"10.96.0.10", "fd00::10"},
+				Ports:      []ServicePort{{Name: "http", Port: 80, TargetPort: 8080, Protocol: corev1.ProtocolTCP}},
+			},
+			{Name: "web"},
+		}))
+	})
+
+	It("doesn't record services for pods that aren't referenced", func() {
+		Expect(PodServices(pod, []discoveryv1.EndpointSlice{endpointSlice("db", "other-uid")}, nil)).To(BeNil())
+	})
+
+	It("only records services and membership changes when enabled", func() {
+		info := New(&PodInfoConfig{
+			Pod:              pod,
+			Node:             &corev1.Node{},
+			Event:            PodServicesChangedEvent,
+			Services:         []ServiceInfo{{Name: "api"}},
+			PreviousServices: []string{"web"},
+		})
+		Expect(info.PreviousServices).To(Equal([]string{"web"}))
+
+		disabled := *info
+		Expect((&EnrichmentConfig{}).Enrich(&disabled)).To(Succeed())
+		Expect(disabled.Services).To(BeNil())
+		Expect(disabled.PreviousServices).To(BeNil())
+
+		enabled := *info
+		Expect((&EnrichmentConfig{Services: true}).Enrich(&enabled)).To(Succeed())
+		Expect(enabled.Services).To(Equal([]ServiceInfo{{Name: "api"}}))
+	})
+})
@@ -0,0 +1,103 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// TimestampFormat describes how the timestamps of a PodInfo record are formatted
+// +kubebuilder:validation:Enum=RFC3339Nano;Legacy
+type TimestampFormat string
+
+const (
+	// RFC3339NanoTimestampFormat formats timestamps in UTC following RFC 3339, with nanosecond precision (e.g. "2024-05-01T13:04:05.123456789Z")
+	RFC3339NanoTimestampFormat TimestampFormat = "RFC3339Nano"
+	// LegacyTimestampFormat formats timestamps with second precision and a numeric time zone (e.g. "2024-05-01T13:04:05+0000"),
+	// as recorded by earlier versions of PodTracker
+	LegacyTimestampFormat TimestampFormat = "Legacy"
+
+	legacyTimestampLayout string = "2006-01-02T15:04:05-0700"
+)
+
+// format formats the provided time, or returns an empty string if it is zero
+func (f TimestampFormat) format(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	if f == LegacyTimestampFormat {
+		return t.Format(legacyTimestampLayout)
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// timestamps are the times recorded in a PodInfo, which are kept so that they can be formatted differently for each PodTracker
+type timestamps struct {
+	creation   time.Time
+	deletion   time.Time
+	ipAssigned time.Time
+	ipReleased time.Time
+}
+
+// IPAssignedTime returns when the Pod was assigned its IPs: when its sandbox (including its network) was ready, or when it was
+// acknowledged by the kubelet if the PodReadyToStartContainers condition isn't reported. The creation time of the Pod is used as a last resort
+func IPAssignedTime(pod *corev1.Pod) time.Time {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReadyToStartContainers && condition.Status == corev1.ConditionTrue && !condition.LastTransitionTime.IsZero() {
+			return condition.LastTransitionTime.Time
+		}
+	}
+	if pod.Status.StartTime != nil {
+		return pod.Status.StartTime.Time
+	}
+	return pod.GetCreationTimestamp().Time
+}
+
+// FormatTimestamps formats all the timestamps of the PodInfo with the provided format (RFC3339Nano if empty).
+// v1 records are always formatted with the legacy format. The terminations of the PodInfo are replaced with copies, so the slice that they referenced originally is never modified
+func (p *PodInfo) FormatTimestamps(format TimestampFormat) {
+	if p.SchemaVersion == SchemaVersionV1 {
+		format = LegacyTimestampFormat
+	}
+	p.CreationTimestamp = format.format(p.times.creation)
+	p.DeletionTimestamp = format.format(p.times.deletion)
+	p.IPAssignedTimestamp = format.format(p.times.ipAssigned)
+	p.IPReleasedTimestamp = format.format(p.times.ipReleased)
+
+	if p.Terminations == nil {
+		return
+	}
+	terminations := make([]ContainerTermination, 0, len(p.Terminations))
+	for _, termination := range p.Terminations {
+		termination.FinishedAt = format.format(termination.finishedAt)
+		terminations = append(terminations, termination)
+	}
+	p.Terminations = terminations
+}
@@ -0,0 +1,100 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Timestamps", func() {
+	var pod *corev1.Pod
+
+	BeforeEach(func() {
+		created := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+		pod = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				CreationTimestamp: metav1.NewTime(created),
+				DeletionTimestamp: &metav1.Time{Time: created.Add(90*time.Second + 250*time.Millisecond)},
+			},
+			Status: corev1.PodStatus{
+				PodIP:     "10.244.0.17",
+				StartTime: &metav1.Time{Time: created.Add(500 * time.Millisecond)},
+				Conditions: []corev1.PodCondition{{
+					Type:               corev1.PodReadyToStartContainers,
+					Status:             corev1.ConditionTrue,
+					LastTransitionTime: metav1.NewTime(created.Add(1500 * time.Millisecond)),
+				}},
+			},
+		}
+	})
+
+	It("records the lease of the IPs of a deleted pod", func() {
+		info := New(&PodInfoConfig{Pod: pod, Node: &corev1.Node{}, Event: PodDeleteEvent})
+		Expect(info.CreationTimestamp).To(Equal("2026-10-19T12:00:00Z"))
+		Expect(info.IPAssignedTimestamp).To(Equal("2026-10-19T12:00:01.5Z"))
+		Expect(info.IPReleasedTimestamp).To(Equal("2026-10-19T12:01:30.25Z"))
+		Expect(info.DeletionTimestamp).To(Equal(info.IPReleasedTimestamp))
+		Expect(info.LeaseDurationSeconds).To(HaveValue(BeNumerically("~", 88.75)))
+	})
+
+	It("falls back to the start time when the sandbox condition isn't reported", func() {
+		pod.Status.Conditions = nil
+
+		info := New(&PodInfoConfig{Pod: pod, Node: &corev1.Node{}, Event: PodCreateEvent})
+		Expect(info.IPAssignedTimestamp).To(Equal("2026-10-19T12:00:00.5Z"))
+		Expect(info.IPReleasedTimestamp).To(BeEmpty())
+		Expect(info.LeaseDurationSeconds).To(BeNil())
+	})
+
+	It("doesn't record a lease for pods without IPs", func() {
+		pod.Status.PodIP = ""
+
+		info := New(&PodInfoConfig{Pod: pod, Node: &corev1.Node{}, Event: PodDeleteEvent})
+		Expect(info.IPAssignedTimestamp).To(BeEmpty())
+		Expect(info.IPReleasedTimestamp).To(BeEmpty())
+		Expect(info.LeaseDurationSeconds).To(BeNil())
+	})
+
+	It("formats timestamps in the legacy format", func() {
+		info := New(&PodInfoConfig{Pod: pod, Node: &corev1.Node{}, Event: PodDeleteEvent})
+		terminations := []ContainerTermination{{Container: "app", finishedAt: pod.DeletionTimestamp.Time}}
+		info.Terminations = terminations
+
+		info.FormatTimestamps(LegacyTimestampFormat)
+		Expect(info.CreationTimestamp).To(Equal("2026-10-19T12:00:00+0000"))
+		Expect(info.DeletionTimestamp).To(Equal("2026-10-19T12:01:30+0000"))
+		Expect(info.IPAssignedTimestamp).To(Equal("2026-10-19T12:00:01+0000"))
+		Expect(info.Terminations[0].FinishedAt).To(Equal("2026-10-19T12:01:30+0000"))
+		Expect(terminations[0].FinishedAt).To(BeEmpty())
+	})
+})
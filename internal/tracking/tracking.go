@@ -28,7 +28,10 @@ SOFTWARE.
 package tracking
 
 import (
+	"net/netip"
+
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 // PodEvent describes what kind of change a Pod has undergone
@@ -37,30 +40,174 @@ type PodEvent string
 const (
 	PodCreateEvent PodEvent = "Create"
 	PodDeleteEvent PodEvent = "Delete"
+	// PodNetworkUpdateEvent is emitted when the network interfaces reported in the network-status annotation change after the Pod was recorded
+	PodNetworkUpdateEvent PodEvent = "NetworkUpdate"
+	// PodSnapshotEvent is emitted for every tracked Pod when a PodTracker is registered (and optionally when the controller starts),
+	// as a baseline of the Pods which already exist. It doesn't mean that the Pod has just been created
+	PodSnapshotEvent PodEvent = "Snapshot"
 
-	timestampFormat string = "2006-01-02T15:04:05-0700"
+	// The following events are only recorded by PodTrackers that opt into them (see OptionalPodEvents)
+	// PodIPAssignedEvent is emitted when IPs are first observed for a Pod
+	PodIPAssignedEvent PodEvent = "IPAssigned"
+	// PodIPChangedEvent is emitted when the IPs of a recorded Pod change
+	PodIPChangedEvent PodEvent = "IPChanged"
+	// PodReadyEvent is emitted when a recorded Pod becomes ready
+	PodReadyEvent PodEvent = "Ready"
+	// PodTerminatedEvent is emitted when a recorded Pod succeeds or fails, along with the exit codes and reasons of its containers
+	PodTerminatedEvent PodEvent = "Terminated"
+	// PodEvictedEvent is emitted when a recorded Pod is evicted, preempted or otherwise disrupted
+	PodEvictedEvent PodEvent = "Evicted"
+	// PodRescheduledEvent is emitted when a Pod replaces a previously recorded Pod with the same name on a different Node (e.g. a StatefulSet Pod)
+	PodRescheduledEvent PodEvent = "Rescheduled"
+	// PodServicesChangedEvent is emitted when the Services fronting a recorded Pod change. It is only detected for PodTrackers recording Services (see EnrichmentConfig)
+	PodServicesChangedEvent PodEvent = "ServicesChanged"
 )
 
 type PodInfoConfig struct {
 	Pod   *corev1.Pod
 	Node  *corev1.Node
 	Event PodEvent
+	// Owner is the top-level controller of the Pod, if it has been resolved
+	Owner *Owner
+	// PreviousPodIPs are the IPs the Pod had before an IPChanged event
+	PreviousPodIPs []string
+	// PreviousNode is the Node of the Pod replaced by the Pod of a Rescheduled event
+	PreviousNode string
+	// Services are the Services fronting the Pod, if they have been looked up
+	Services []ServiceInfo
+	// PreviousServices are the names of the Services which fronted the Pod before a ServicesChanged event
+	PreviousServices []string
+	// NetworkPolicies are the NetworkPolicies selecting the Pod, if they have been evaluated. They are only recorded for Create and Snapshot events
+	NetworkPolicies *NetworkPolicyExposure
+	// DeletionStateUnknown is true if the deletion of the Pod was not observed directly (e.g. it was deleted while the controller was down),
+	// so the recorded state of the Pod is its last known state and its deletion timestamp is when the deletion was detected
+	DeletionStateUnknown bool
+}
+
+// Owner identifies the top-level controller of a Pod (e.g. the Deployment of a ReplicaSet managed Pod)
+type Owner struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Name       string    `json:"name"`
+	UID        types.UID `json:"uid"`
+}
+
+// IPAddress is an IP address tagged with its IP family
+type IPAddress struct {
+	IP     string          `json:"ip"`
+	Family corev1.IPFamily `json:"family"`
 }
 
-// PodInfo describes a structured set of fields/data related to a pod that is compatible with PodTracker writers
+// newIPAddresses tags each of the provided IPs with its IP family. IPs that can't be parsed are kept with an empty family
+func newIPAddresses(ips ...string) []IPAddress {
+	addresses := []IPAddress{}
+	for _, ip := range ips {
+		if ip == "" {
+			continue
+		}
+
+		address := IPAddress{IP: ip}
+		if parsed, err := netip.ParseAddr(ip); err == nil {
+			if parsed.Unmap().Is4() {
+				address.Family = corev1.IPv4Protocol
+			} else {
+				address.Family = corev1.IPv6Protocol
+			}
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+// podIPs returns all the IPs allocated to the Pod. Older API servers (or Pods that were never updated) may only set the singular PodIP
+func podIPs(pod *corev1.Pod) []string {
+	if len(pod.Status.PodIPs) == 0 {
+		return []string{pod.Status.PodIP}
+	}
+
+	ips := make([]string, 0, len(pod.Status.PodIPs))
+	for _, ip := range pod.Status.PodIPs {
+		ips = append(ips, ip.IP)
+	}
+	return ips
+}
+
+// hostIPs returns all the IPs of the host the Pod is assigned to. Older API servers may only set the singular HostIP
+func hostIPs(pod *corev1.Pod) []string {
+	if len(pod.Status.HostIPs) == 0 {
+		return []string{pod.Status.HostIP}
+	}
+
+	ips := make([]string, 0, len(pod.Status.HostIPs))
+	for _, ip := range pod.Status.HostIPs {
+		ips = append(ips, ip.IP)
+	}
+	return ips
+}
+
+// PodInfo describes a structured set of fields/data related to a pod that is compatible with PodTracker writers.
+// PodIP is the primary IP of the pod and is kept for compatibility, PodIPs contains every IP of the pod (e.g. on dual-stack clusters)
 type PodInfo struct {
-	TrackedBy         string              `json:"trackedBy,omitempty"`
-	ID                string              `json:"id"`
-	Event             PodEvent            `json:"event"`
-	Name              string              `json:"name"`
-	Namespace         string              `json:"namespace"`
-	Labels            map[string]string   `json:"labels"`
-	Annotations       map[string]string   `json:"annotations"`
-	CreationTimestamp string              `json:"creationTimestamp"`
-	DeletionTimestamp string              `json:"deletionTimestamp"`
-	PodIP             string              `json:"podIP"`
-	Node              string              `json:"node"`
-	NodeIPs           map[string][]string `json:"nodeIPs"`
+	// SchemaVersion is the shape the record is encoded in (see SchemaVersion)
+	SchemaVersion     SchemaVersion     `json:"schemaVersion"`
+	TrackedBy         string            `json:"trackedBy,omitempty"`
+	ID                string            `json:"id"`
+	Event             PodEvent          `json:"event"`
+	Name              string            `json:"name"`
+	Namespace         string            `json:"namespace"`
+	Labels            map[string]string `json:"labels"`
+	Annotations       map[string]string `json:"annotations"`
+	CreationTimestamp string            `json:"creationTimestamp"`
+	DeletionTimestamp string            `json:"deletionTimestamp"`
+	// IPAssignedTimestamp is when the Pod was assigned its IPs. IPReleasedTimestamp and LeaseDurationSeconds (the time between
+	// the assignment and the release of the IPs) are only set when the Pod releases its IPs
+	IPAssignedTimestamp  string              `json:"ipAssignedTimestamp,omitempty"`
+	IPReleasedTimestamp  string              `json:"ipReleasedTimestamp,omitempty"`
+	LeaseDurationSeconds *float64            `json:"leaseDurationSeconds,omitempty"`
+	Phase                corev1.PodPhase     `json:"phase,omitempty"`
+	PodIP                string              `json:"podIP"`
+	PodIPs               []IPAddress         `json:"podIPs"`
+	HostIPs              []IPAddress         `json:"hostIPs"`
+	Node                 string              `json:"node"`
+	NodeIPs              map[string][]string `json:"nodeIPs"`
+	Interfaces           []NetworkInterface  `json:"interfaces,omitempty"`
+	Owner                *Owner              `json:"owner,omitempty"`
+
+	// PreviousPodIPs, PreviousNode, PreviousServices, Reason, Message, Terminations and DeletionStateUnknown are only set for the events they describe
+	PreviousPodIPs   []IPAddress            `json:"previousPodIPs,omitempty"`
+	PreviousNode     string                 `json:"previousNode,omitempty"`
+	PreviousServices []string               `json:"previousServices,omitempty"`
+	Reason           string                 `json:"reason,omitempty"`
+	Message          string                 `json:"message,omitempty"`
+	Terminations     []ContainerTermination `json:"terminations,omitempty"`
+
+	// DeletionStateUnknown is true for deletions which were not observed directly (see PodInfoConfig)
+	DeletionStateUnknown bool `json:"deletionStateUnknown,omitempty"`
+
+	// ServiceAccount, Containers, HostNetwork, HostPID, Services and NetworkPolicies (for Create and Snapshot events) are only set when enabled for the PodTracker (see EnrichmentConfig)
+	ServiceAccount  string                 `json:"serviceAccount,omitempty"`
+	Containers      []ContainerInfo        `json:"containers,omitempty"`
+	HostNetwork     *bool                  `json:"hostNetwork,omitempty"`
+	HostPID         *bool                  `json:"hostPID,omitempty"`
+	Services        []ServiceInfo          `json:"services,omitempty"`
+	NetworkPolicies *NetworkPolicyExposure `json:"networkPolicies,omitempty"`
+
+	// NodeTopology, NodeLabels and NodePodCIDRs are only set when enabled for the PodTracker (see NodeEnrichment)
+	NodeTopology *NodeTopology     `json:"nodeTopology,omitempty"`
+	NodeLabels   map[string]string `json:"nodeLabels,omitempty"`
+	NodePodCIDRs []string          `json:"nodePodCIDRs,omitempty"`
+
+	// InstanceInfo identifies the cluster and the controller process which emitted the record (see Instance)
+	InstanceInfo
+
+	// Chain, Sequence, PreviousHash and Signature are only set when integrity is enabled for the PodTracker (see IntegrityConfig)
+	Chain        string `json:"chain,omitempty"`
+	Sequence     uint64 `json:"sequence,omitempty"`
+	PreviousHash string `json:"previousHash,omitempty"`
+	Signature    string `json:"signature,omitempty"`
+
+	// times are the unformatted timestamps of the PodInfo
+	times timestamps
 }
 
 // New creates a new PodInfo structure
@@ -70,23 +217,64 @@ func New(cfg *PodInfoConfig) *PodInfo {
 		nodeIPs[string(addr.Type)] = append(nodeIPs[string(addr.Type)], addr.Address)
 	}
 
+	hostNetwork, hostPID := cfg.Pod.Spec.HostNetwork, cfg.Pod.Spec.HostPID
 	podInfo := &PodInfo{
-		ID:                string(cfg.Pod.GetUID()),
-		Event:             cfg.Event,
-		Name:              cfg.Pod.GetName(),
-		Namespace:         cfg.Pod.GetNamespace(),
-		Labels:            cfg.Pod.GetLabels(),
-		Annotations:       cfg.Pod.GetAnnotations(),
-		CreationTimestamp: cfg.Pod.GetCreationTimestamp().Format(timestampFormat),
-		PodIP:             cfg.Pod.Status.PodIP,
-		Node:              cfg.Pod.Spec.NodeName,
-		NodeIPs:           nodeIPs,
+		SchemaVersion:  CurrentSchemaVersion,
+		ID:             string(cfg.Pod.GetUID()),
+		Event:          cfg.Event,
+		Name:           cfg.Pod.GetName(),
+		Namespace:      cfg.Pod.GetNamespace(),
+		Labels:         cfg.Pod.GetLabels(),
+		Annotations:    cfg.Pod.GetAnnotations(),
+		PodIP:          cfg.Pod.Status.PodIP,
+		PodIPs:         newIPAddresses(podIPs(cfg.Pod)...),
+		HostIPs:        newIPAddresses(hostIPs(cfg.Pod)...),
+		Node:           cfg.Pod.Spec.NodeName,
+		NodeIPs:        nodeIPs,
+		Interfaces:     NetworkInterfaces(cfg.Pod),
+		Owner:          cfg.Owner,
+		ServiceAccount: cfg.Pod.Spec.ServiceAccountName,
+		Containers:     containers(cfg.Pod),
+		HostNetwork:    &hostNetwork,
+		HostPID:        &hostPID,
+		Services:       cfg.Services,
+		NodeTopology:   nodeTopology(cfg.Node),
+		NodeLabels:     cfg.Node.GetLabels(),
+		NodePodCIDRs:   nodePodCIDRs(cfg.Node),
+		times: timestamps{
+			creation: cfg.Pod.GetCreationTimestamp().Time,
+		},
+	}
+	if len(podInfo.PodIPs) > 0 {
+		podInfo.times.ipAssigned = IPAssignedTime(cfg.Pod)
 	}
 
-	// Only set the deletion timestamp field if the pod is being deleted
+	// Only set the deletion timestamp field if the pod is being deleted, or has released its IPs
 	if podInfo.Event == PodDeleteEvent {
-		podInfo.DeletionTimestamp = cfg.Pod.GetDeletionTimestamp().Format(timestampFormat)
+		podInfo.times.deletion = releaseTime(cfg.Pod)
+		if !podInfo.times.ipAssigned.IsZero() {
+			podInfo.times.ipReleased = podInfo.times.deletion
+			lease := podInfo.times.ipReleased.Sub(podInfo.times.ipAssigned).Seconds()
+			podInfo.LeaseDurationSeconds = &lease
+		}
+		podInfo.Phase = cfg.Pod.Status.Phase
+		podInfo.DeletionStateUnknown = cfg.DeletionStateUnknown
+	}
+
+	switch podInfo.Event {
+	case PodCreateEvent, PodSnapshotEvent:
+		podInfo.NetworkPolicies = cfg.NetworkPolicies
+	case PodIPChangedEvent:
+		podInfo.PreviousPodIPs = newIPAddresses(cfg.PreviousPodIPs...)
+	case PodRescheduledEvent:
+		podInfo.PreviousNode = cfg.PreviousNode
+	case PodServicesChangedEvent:
+		podInfo.PreviousServices = cfg.PreviousServices
+	case PodTerminatedEvent, PodEvictedEvent:
+		podInfo.Reason, podInfo.Message = podStatusReason(cfg.Pod)
+		podInfo.Terminations = containerTerminations(cfg.Pod)
 	}
 
+	podInfo.FormatTimestamps(RFC3339NanoTimestampFormat)
 	return podInfo
 }
@@ -0,0 +1,104 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package tracking
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("New", func() {
+	It("records every IP of a dual-stack pod", func() {
+		info := New(&PodInfoConfig{
+			Pod: &corev1.Pod{
+				Status: corev1.PodStatus{
+					PodIP:   "10.244.0.17",
+					PodIPs:  []corev1.PodIP{{IP: "10.244.0.17"}, {IP: "fd00:10:244::11"}},
+					HostIP:  "172.18.0.2",
+					HostIPs: []corev1.HostIP{{IP: "172.18.0.2"}, {IP: "fc00:f853:ccd:e793::2"}},
+				},
+			},
+			Node:  &corev1.Node{},
+			Event: PodCreateEvent,
+		})
+
+		Expect(info.PodIP).To(Equal("10.244.0.17"))
+		Expect(info.PodIPs).To(Equal([]IPAddress{
+			{IP: "10.244.0.17", Family: corev1.IPv4Protocol},
+			{IP: "fd00:10:244::11", Family: corev1.IPv6Protocol},
+		}))
+		Expect(info.HostIPs).To(Equal([]IPAddress{
+			{IP: "172.18.0.2", Family: corev1.IPv4Protocol},
+			{IP: "fc00:f853:ccd:e793::2", Family: corev1.IPv6Protocol},
+		}))
+	})
+
+	It("falls back to the singular pod and host IP", func() {
+		info := New(&PodInfoConfig{
+			Pod: &corev1.Pod{
+				Status: corev1.PodStatus{PodIP: "10.244.0.17", HostIP: "172.18.0.2"},
+			},
+			Node:  &corev1.Node{},
+			Event: PodCreateEvent,
+		})
+
+		Expect(info.PodIPs).To(Equal([]IPAddress{{IP: "10.244.0.17", Family: corev1.IPv4Protocol}}))
+		Expect(info.HostIPs).To(Equal([]IPAddress{{IP: "172.18.0.2", Family: corev1.IPv4Protocol}}))
+	})
+})
+
+var _ = Describe("NetworkInterfaces", func() {
+	It("parses the multus network-status annotation", func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					NetworkStatusAnnotation: `[
+						{"name": "cbr0", "interface": "eth0", "ips": ["10.244.0.17"], "mac": "0a:58:0a:f4:00:11", "default": true, "dns": {}},
+						{"name": "app/macvlan-conf", "interface": "net1", "ips": ["192.168.1.205", "fd00:1::5"], "mac": "86:1d:96:ff:55:0d"}
+					]`,
+				},
+			},
+		}
+
+		Expect(NetworkInterfaces(pod)).To(Equal([]NetworkInterface{
+			{Network: "cbr0", Interface: "eth0", IPs: []string{"10.244.0.17"}, MAC: "0a:58:0a:f4:00:11", Default: true},
+			{Network: "app/macvlan-conf", Interface: "net1", IPs: []string{"192.168.1.205", "fd00:1::5"}, MAC: "86:1d:96:ff:55:0d"},
+		}))
+	})
+
+	It("ignores a missing or malformed annotation", func() {
+		Expect(NetworkInterfaces(&corev1.Pod{})).To(BeNil())
+		Expect(NetworkInterfaces(&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{NetworkStatusAnnotation: "not json"},
+			},
+		})).To(BeNil())
+	})
+})
@@ -0,0 +1,170 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package writer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+// IntegrityConfig configures tamper-evident records. When enabled, every record written by a BackendWriter is given a sequence number
+// and the SHA-256 hash of the previous record written by the same writer, so that removed, reordered or modified records can be detected
+// +kubebuilder:object:generate=true
+type IntegrityConfig struct {
+	Enabled bool `json:"enabled"`
+
+	// HMACKey references a key used to sign every record with an HMAC-SHA256, so that records can't be forged by someone
+	// who is able to recompute the hash chain
+	//+optional
+	HMACKey *SecretKeySelector `json:"hmacKey,omitempty"`
+}
+
+// SecretReferences returns all the Secret keys referenced by the IntegrityConfig
+func (cfg *IntegrityConfig) SecretReferences() []SecretKeySelector {
+	if cfg == nil || cfg.HMACKey == nil {
+		return []SecretKeySelector{}
+	}
+	return []SecretKeySelector{*cfg.HMACKey}
+}
+
+// Wrap wraps each of the provided writers in a ChainWriter if integrity is enabled. Otherwise, the writers are returned as-is.
+// chain is the ID of the chains begun by the ChainWriters, which continue the ID of the previous chains instead if they are rebuilt (see ContinueChains)
+func (cfg *IntegrityConfig) Wrap(ctx context.Context, chain string, writers []BackendWriter, secrets SecretResolver) ([]BackendWriter, error) {
+	if cfg == nil || !cfg.Enabled {
+		return writers, nil
+	}
+
+	var key []byte
+	if cfg.HMACKey != nil {
+		var err error
+		if key, err = secrets.ResolveSecret(ctx, *cfg.HMACKey); err != nil {
+			return nil, err
+		}
+		// surrounding whitespace is trimmed, as it is when records are verified with podtrackerctl
+		key = bytes.TrimSpace(key)
+	}
+
+	wrapped := make([]BackendWriter, 0, len(writers))
+	for _, w := range writers {
+		wrapped = append(wrapped, &ChainWriter{
+			stream: StreamName(w),
+			writer: w,
+			chain:  tracking.NewChain(chain, key),
+		})
+	}
+	return wrapped, nil
+}
+
+// ChainWriter is a BackendWriter which links every record written by the wrapped writer into a hash chain
+type ChainWriter struct {
+	mu sync.Mutex
+	// stream identifies the wrapped writer within the writers of a PodTracker
+	stream string
+	writer BackendWriter
+	chain  *tracking.Chain
+	// successor is the ChainWriter which continues the chain once the writers have been rebuilt (see ContinueChains).
+	// The records written after that are written by the successor, so that the chain doesn't fork
+	successor *ChainWriter
+}
+
+// A blank assignment to ensure that ChainWriter implements BackendWriter
+var _ BackendWriter = &ChainWriter{}
+
+// Implement the BackendWriter interface
+func (c *ChainWriter) Write(record tracking.Record) error {
+	c.mu.Lock()
+	if successor := c.successor; successor != nil {
+		c.mu.Unlock()
+		return successor.Write(record)
+	}
+	defer c.mu.Unlock()
+
+	linked, err := c.chain.Next(record)
+	if err != nil {
+		return err
+	}
+
+	// the chain only advances once the record was written, so a failed write is retried with the same sequence number,
+	// and a skipped record leaves no gap in the chain
+	if err := c.writer.Write(linked); err != nil {
+		return err
+	}
+	return c.chain.Commit(linked)
+}
+
+// Close closes the wrapped writer
+func (c *ChainWriter) Close() error {
+	return c.writer.Close()
+}
+
+// StreamName identifies a writer within the writers of a PodTracker, whether or not it is wrapped in a ChainWriter.
+// Rebuilding the writers of a PodTracker does not change the names of their streams
+func StreamName(w BackendWriter) string {
+	switch typed := w.(type) {
+	case *ChainWriter:
+		return typed.stream
+	case *StdoutWriter:
+		return "stdout"
+	case *PluginWriter:
+		return "plugin/" + typed.name
+	default:
+		return fmt.Sprintf("%T", w)
+	}
+}
+
+// ContinueChains lets the ChainWriters in writers continue the hash chains of the ChainWriters for the same stream in previous,
+// so that rebuilding the writers of a PodTracker (e.g. after an update) does not restart its chains. Records which are still written to
+// the previous ChainWriters afterwards (i.e. by writes already in progress) are passed on to the ChainWriters which continue their chains
+func ContinueChains(writers []BackendWriter, previous []BackendWriter) {
+	chains := map[string]*ChainWriter{}
+	for _, w := range previous {
+		if prev, ok := w.(*ChainWriter); ok {
+			chains[prev.stream] = prev
+		}
+	}
+
+	for _, w := range writers {
+		next, ok := w.(*ChainWriter)
+		if !ok {
+			continue
+		}
+		prev, ok := chains[next.stream]
+		if !ok {
+			continue
+		}
+
+		prev.mu.Lock()
+		next.chain.Continue(prev.chain)
+		prev.successor = next
+		prev.mu.Unlock()
+	}
+}
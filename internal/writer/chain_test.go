@@ -0,0 +1,113 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package writer
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+// sequenceWriter is a BackendWriter which remembers the sequence numbers of the records written to it
+type sequenceWriter struct {
+	sequences []uint64
+}
+
+func (w *sequenceWriter) Write(record tracking.Record) error {
+	w.sequences = append(w.sequences, record.Link().Sequence)
+	return nil
+}
+
+func (w *sequenceWriter) Close() error { return nil }
+
+// staticSecrets is a SecretResolver which resolves every Secret key to the same value
+type staticSecrets []byte
+
+func (s staticSecrets) ResolveSecret(context.Context, SecretKeySelector) ([]byte, error) {
+	return s, nil
+}
+
+// signedWriter is a BackendWriter which keeps the last record written to it
+type signedWriter struct {
+	record tracking.Record
+}
+
+func (w *signedWriter) Write(record tracking.Record) error {
+	w.record = record
+	return nil
+}
+
+func (w *signedWriter) Close() error { return nil }
+
+var _ = Describe("IntegrityConfig", func() {
+	It("signs records with the HMAC key trimmed of surrounding whitespace", func() {
+		cfg := &IntegrityConfig{Enabled: true, HMACKey: &SecretKeySelector{Name: "integrity", Key: "hmac.key"}}
+		out := &signedWriter{}
+		writers, err := cfg.Wrap(context.Background(), "chain", []BackendWriter{out}, staticSecrets("hmac-key\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(writers[0].Write(&tracking.PodInfo{ID: "pod"})).To(Succeed())
+
+		Expect(out.record.Link().Chain).To(Equal("chain"))
+		expected, err := tracking.Sign(out.record, []byte("hmac-key"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out.record.Link().Signature).To(Equal(expected))
+	})
+})
+
+var _ = Describe("ContinueChains", func() {
+	It("passes the records written to the previous writers on to the writers continuing their chains", func() {
+		previousOut, nextOut := &sequenceWriter{}, &sequenceWriter{}
+		previous := &ChainWriter{stream: "stdout", writer: previousOut, chain: tracking.NewChain("", nil)}
+		next := &ChainWriter{stream: "stdout", writer: nextOut, chain: tracking.NewChain("", nil)}
+
+		Expect(previous.Write(&tracking.PodInfo{ID: "first"})).To(Succeed())
+		ContinueChains([]BackendWriter{next}, []BackendWriter{previous})
+
+		// e.g. a write which acquired the previous writers before they were replaced
+		Expect(previous.Write(&tracking.PodInfo{ID: "in-progress"})).To(Succeed())
+		Expect(next.Write(&tracking.PodInfo{ID: "third"})).To(Succeed())
+
+		Expect(previousOut.sequences).To(Equal([]uint64{1}))
+		Expect(nextOut.sequences).To(Equal([]uint64{2, 3}))
+	})
+
+	It("does not continue the chains of other streams", func() {
+		previous := &ChainWriter{stream: "plugin/a", writer: &sequenceWriter{}, chain: tracking.NewChain("", nil)}
+		nextOut := &sequenceWriter{}
+		next := &ChainWriter{stream: "plugin/b", writer: nextOut, chain: tracking.NewChain("", nil)}
+
+		Expect(previous.Write(&tracking.PodInfo{ID: "first"})).To(Succeed())
+		ContinueChains([]BackendWriter{next}, []BackendWriter{previous})
+		Expect(next.Write(&tracking.PodInfo{ID: "second"})).To(Succeed())
+
+		Expect(nextOut.sequences).To(Equal([]uint64{1}))
+	})
+})
@@ -27,29 +27,57 @@ SOFTWARE.
 
 package writer
 
+import (
+	"context"
+)
+
 //
 // CONFIGURATION
 //
 
 // BackendWriterConfig defines configuration options for backends that can be used by PodTracker to
 // write Pod tracking info to all configured backends
+// +kubebuilder:object:generate=true
 type BackendWriterConfig struct {
 	Stdout *StdoutConfig `json:"stdout,omitempty"`
+
+	// Plugins configures external writer plugins which PodInfo is streamed to over gRPC
+	//+optional
+	Plugins []PluginConfig `json:"plugins,omitempty"`
 	// NOTE: more to be added as desired
 }
 
-// GetWriters will create a list of concrete BackendWriter based which writers are configured in the incoming BackendWriterConfig
-func (b BackendWriterConfig) GetWriters() []BackendWriter {
+// SecretReferences returns all the Secret keys referenced by any of the configured writers
+func (b BackendWriterConfig) SecretReferences() []SecretKeySelector {
+	refs := []SecretKeySelector{}
+	for i := range b.Plugins {
+		refs = append(refs, b.Plugins[i].SecretReferences()...)
+	}
+	return refs
+}
+
+// GetWriters will create a list of concrete BackendWriter based which writers are configured in the incoming BackendWriterConfig.
+// Any Secrets referenced by the configuration are looked up using the provided SecretResolver
+func (b BackendWriterConfig) GetWriters(ctx context.Context, secrets SecretResolver) ([]BackendWriter, error) {
 	writers := []BackendWriter{}
 	if b.Stdout != nil {
 		writers = append(writers, NewStdoutWriter(b.Stdout))
 	}
 
+	for i := range b.Plugins {
+		w, err := NewPluginWriter(ctx, &b.Plugins[i], secrets)
+		if err != nil {
+			CloseAll(writers)
+			return nil, err
+		}
+		writers = append(writers, w)
+	}
+
 	// check if any writers were configured
 	// if not, just use stdout writer as a default
 	if len(writers) == 0 {
-		return []BackendWriter{NewStdoutWriter(nil)}
+		return []BackendWriter{NewStdoutWriter(nil)}, nil
 	}
 
-	return writers
+	return writers, nil
 }
@@ -0,0 +1,174 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package writer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/gccloudone-aurora/podtracker/internal/plugin"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+const defaultPluginTimeoutSeconds int32 = 10
+
+// A backend writer for streaming records to an external writer plugin over gRPC
+type PluginWriter struct {
+	name    string
+	enabled bool
+	timeout time.Duration
+	client  *plugin.Client
+}
+
+// A blank assignment to ensure that PluginWriter implements BackendWriter
+var _ BackendWriter = &PluginWriter{}
+
+// Implement the BackendWriter interface
+func (p *PluginWriter) Write(record tracking.Record) error {
+	if !p.enabled {
+		return ErrRecordSkipped
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	if err := p.client.Write(ctx, record); err != nil {
+		if errors.Is(err, plugin.ErrUnsupportedRecord) {
+			return ErrRecordSkipped
+		}
+		return fmt.Errorf("writer plugin %q: %w", p.name, err)
+	}
+	return nil
+}
+
+// Close closes the connection to the plugin
+func (p *PluginWriter) Close() error {
+	return p.client.Close()
+}
+
+// PluginConfig is a concrete way to configure a PluginWriter
+// +kubebuilder:object:generate=true
+type PluginConfig struct {
+	// Name identifies the plugin in logs and errors
+	Name string `json:"name"`
+
+	Enabled bool `json:"enabled"`
+
+	// Address is the gRPC target the plugin is served on.
+	// Use "unix:///path/to/plugin.sock" for a unix socket shared with a sidecar, or "<host>:<port>" for TCP
+	Address string `json:"address"`
+
+	// TimeoutSeconds is how long to wait for the plugin to acknowledge a record before the write is considered failed. Defaults to 10 seconds
+	//+optional
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+
+	// TLS configures the connection to the plugin to use TLS. If not set, the connection is unencrypted,
+	// which is only appropriate for plugins reached over a unix socket or the Pod's loopback interface
+	//+optional
+	TLS *TLSConfig `json:"tls,omitempty"`
+
+	// Token references a bearer token which is sent to the plugin as "authorization" metadata on every call.
+	// A token can only be configured together with TLS
+	//+optional
+	Token *SecretKeySelector `json:"token,omitempty"`
+}
+
+// SecretReferences returns all the Secret keys referenced by the PluginConfig
+func (cfg *PluginConfig) SecretReferences() []SecretKeySelector {
+	refs := []SecretKeySelector{}
+	if cfg.TLS != nil {
+		refs = append(refs, cfg.TLS.SecretReferences()...)
+	}
+	if cfg.Token != nil {
+		refs = append(refs, *cfg.Token)
+	}
+	return refs
+}
+
+// tokenCredentials implements credentials.PerRPCCredentials to send a bearer token with every call to a plugin.
+// The token is never sent over an unencrypted connection
+type tokenCredentials struct {
+	token string
+}
+
+func (t tokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return true
+}
+
+// NewPluginWriter creates and configures a PluginWriter and returns a reference to it.
+// Any referenced Secrets are resolved immediately, but no connection is made to the plugin until the first record is written
+func NewPluginWriter(ctx context.Context, cfg *PluginConfig, secrets SecretResolver) (*PluginWriter, error) {
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if cfg.TLS != nil {
+		tlsConfig, err := cfg.TLS.Build(ctx, secrets)
+		if err != nil {
+			return nil, fmt.Errorf("unable to configure TLS for writer plugin %q: %w", cfg.Name, err)
+		}
+		opts[0] = grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))
+	}
+	if cfg.Token != nil {
+		if cfg.TLS == nil {
+			return nil, fmt.Errorf("unable to configure token for writer plugin %q: a bearer token can only be sent over TLS", cfg.Name)
+		}
+		token, err := secrets.ResolveSecret(ctx, *cfg.Token)
+		if err != nil {
+			return nil, fmt.Errorf("unable to configure token for writer plugin %q: %w", cfg.Name, err)
+		}
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials{
+			token: strings.TrimSpace(string(token)),
+		}))
+	}
+
+	client, err := plugin.NewClient(cfg.Address, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to configure writer plugin %q: %w", cfg.Name, err)
+	}
+
+	timeout := defaultPluginTimeoutSeconds
+	if cfg.TimeoutSeconds != nil {
+		timeout = *cfg.TimeoutSeconds
+	}
+
+	return &PluginWriter{
+		name:    cfg.Name,
+		enabled: cfg.Enabled,
+		timeout: time.Duration(timeout) * time.Second,
+		client:  client,
+	}, nil
+}
@@ -0,0 +1,180 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package writer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+
+	"github.com/gccloudone-aurora/podtracker/internal/plugin"
+	"github.com/gccloudone-aurora/podtracker/internal/plugin/reference"
+	"github.com/gccloudone-aurora/podtracker/internal/tracking"
+)
+
+var _ = Describe("PluginWriter", func() {
+	var (
+		out     *bytes.Buffer
+		ref     *reference.Plugin
+		handler plugin.Handler
+		server  *grpc.Server
+		socket  string
+		w       *PluginWriter
+	)
+
+	serve := func() {
+		lis, err := net.Listen("unix", socket)
+		Expect(err).NotTo(HaveOccurred())
+
+		server = plugin.NewServer(handler)
+		go func() {
+			defer GinkgoRecover()
+			Expect(server.Serve(lis)).To(Succeed())
+		}()
+	}
+
+	BeforeEach(func() {
+		out = &bytes.Buffer{}
+		ref = &reference.Plugin{Out: out}
+		handler = ref
+
+		socket = filepath.Join(GinkgoT().TempDir(), "plugin.sock")
+		serve()
+
+		var err error
+		w, err = NewPluginWriter(context.Background(), &PluginConfig{
+			Name:    "reference",
+			Enabled: true,
+			Address: "unix://" + socket,
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(w.Close()).To(Succeed())
+		server.Stop()
+	})
+
+	It("streams records to the plugin", func() {
+		Expect(w.Write(&tracking.PodInfo{ID: "first", Event: tracking.PodCreateEvent})).To(Succeed())
+		Expect(w.Write(&tracking.PodInfo{ID: "second", Event: tracking.PodDeleteEvent})).To(Succeed())
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		Expect(lines).To(HaveLen(2))
+
+		info := &tracking.PodInfo{}
+		Expect(json.Unmarshal([]byte(lines[1]), info)).To(Succeed())
+		Expect(info.ID).To(Equal("second"))
+		Expect(info.Event).To(Equal(tracking.PodDeleteEvent))
+	})
+
+	It("negotiates the protocol version during the handshake", func() {
+		Expect(w.Write(&tracking.PodInfo{ID: "first"})).To(Succeed())
+		Expect(w.client.PluginName).To(Equal("reference"))
+		Expect(w.client.ProtocolVersion).To(Equal(plugin.ProtocolVersion))
+	})
+
+	It("streams service records to plugins which write them", func() {
+		Expect(w.Write(&tracking.ServiceRecord{ID: "service", RecordType: tracking.ServiceRecordType})).To(Succeed())
+		Expect(out.String()).To(ContainSubstring(`"recordType":"Service"`))
+	})
+
+	It("skips the record types the plugin does not write", func() {
+		Expect(w.Write(&tracking.PodInfo{ID: "first"})).To(Succeed())
+		server.Stop()
+
+		// the plugin only implements plugin.Handler, so it negotiates the version of the protocol which only carries PodInfo records
+		handler = struct{ plugin.Handler }{ref}
+		serve()
+		Eventually(func() error {
+			return w.Write(&tracking.PodInfo{ID: "after-restart"})
+		}).Should(Succeed())
+		Expect(w.Write(&tracking.NodeRecord{ID: "node", RecordType: tracking.NodeRecordType})).To(MatchError(ErrRecordSkipped))
+		Expect(WriteToAll([]BackendWriter{w}, &tracking.NodeRecord{ID: "node", RecordType: tracking.NodeRecordType})).To(BeEmpty())
+		Expect(w.client.ProtocolVersion).To(Equal(uint32(1)))
+		Expect(out.String()).NotTo(ContainSubstring(`"recordType":"Node"`))
+	})
+
+	It("does not link skipped records into the hash chain", func() {
+		Expect(w.Write(&tracking.PodInfo{ID: "unchained"})).To(Succeed())
+		server.Stop()
+		handler = struct{ plugin.Handler }{ref}
+		serve()
+
+		chained := &ChainWriter{stream: StreamName(w), writer: w, chain: tracking.NewChain("", nil)}
+		Eventually(func() error {
+			return chained.Write(&tracking.PodInfo{SchemaVersion: tracking.CurrentSchemaVersion, ID: "first"})
+		}).Should(Succeed())
+		Expect(chained.Write(&tracking.NodeRecord{ID: "node", RecordType: tracking.NodeRecordType})).To(MatchError(ErrRecordSkipped))
+		Expect(chained.Write(&tracking.PodInfo{SchemaVersion: tracking.CurrentSchemaVersion, ID: "second"})).To(Succeed())
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		info := &tracking.PodInfo{}
+		Expect(json.Unmarshal([]byte(lines[len(lines)-1]), info)).To(Succeed())
+		Expect(info.ID).To(Equal("second"))
+		Expect(info.Sequence).To(Equal(uint64(2)))
+	})
+
+	It("returns an error when the plugin does not acknowledge a record", func() {
+		ref.Reject = func(info *tracking.PodInfo) error {
+			if info.ID == "rejected" {
+				return errors.New("sink unavailable")
+			}
+			return nil
+		}
+
+		err := w.Write(&tracking.PodInfo{ID: "rejected"})
+		Expect(err).To(MatchError(ContainSubstring("sink unavailable")))
+
+		// the stream remains usable after a rejected record
+		Expect(w.Write(&tracking.PodInfo{ID: "accepted"})).To(Succeed())
+		Expect(out.String()).To(ContainSubstring(`"id":"accepted"`))
+		Expect(out.String()).NotTo(ContainSubstring(`"id":"rejected"`))
+	})
+
+	It("reconnects when the plugin is restarted", func() {
+		Expect(w.Write(&tracking.PodInfo{ID: "first"})).To(Succeed())
+		server.Stop()
+
+		Expect(w.Write(&tracking.PodInfo{ID: "lost"})).NotTo(Succeed())
+
+		serve()
+		Eventually(func() error {
+			return w.Write(&tracking.PodInfo{ID: "after-restart"})
+		}).Should(Succeed())
+		Expect(out.String()).To(ContainSubstring(`"id":"after-restart"`))
+	})
+})
@@ -0,0 +1,132 @@
+/*
+
+MIT License
+
+Copyright (c) His Majesty the King in Right of Canada, as represented by the
+Minister responsible for Shared Services Canada, 2024
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package writer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// SecretKeySelector selects a key of a Secret in the namespace that the podtracker controller runs in.
+// It is used by writer configurations to reference sensitive values (tokens, passwords, certificates) instead of embedding them in the PodTracker spec
+// +kubebuilder:object:generate=true
+type SecretKeySelector struct {
+	// Name is the name of the Secret in the controller namespace
+	Name string `json:"name"`
+
+	// Key is the key of the Secret to select
+	Key string `json:"key"`
+}
+
+// SecretResolver looks up the value referenced by a SecretKeySelector
+type SecretResolver interface {
+	ResolveSecret(ctx context.Context, ref SecretKeySelector) ([]byte, error)
+}
+
+// TLSConfig configures the TLS material used by a writer to connect to its backend
+// +kubebuilder:object:generate=true
+type TLSConfig struct {
+	// CA references a PEM encoded CA bundle used to verify the backend's serving certificate.
+	// If not set, the system roots are used
+	//+optional
+	CA *SecretKeySelector `json:"ca,omitempty"`
+
+	// Cert references a PEM encoded client certificate used for mutual TLS. Must be set together with Key
+	//+optional
+	Cert *SecretKeySelector `json:"cert,omitempty"`
+
+	// Key references the PEM encoded private key for Cert
+	//+optional
+	Key *SecretKeySelector `json:"key,omitempty"`
+
+	// ServerName overrides the server name used to verify the backend's serving certificate
+	//+optional
+	ServerName string `json:"serverName,omitempty"`
+
+	// InsecureSkipVerify disables verification of the backend's serving certificate. This should only be used for testing
+	//+optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// SecretReferences returns all the Secret keys referenced by the TLSConfig
+func (t *TLSConfig) SecretReferences() []SecretKeySelector {
+	refs := []SecretKeySelector{}
+	for _, ref := range []*SecretKeySelector{t.CA, t.Cert, t.Key} {
+		if ref != nil {
+			refs = append(refs, *ref)
+		}
+	}
+	return refs
+}
+
+// Build resolves the referenced Secrets and creates a *tls.Config from them
+func (t *TLSConfig) Build(ctx context.Context, resolver SecretResolver) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify, //nolint:gosec // explicitly requested by the PodTracker configuration
+	}
+
+	if t.CA != nil {
+		ca, err := resolver.ResolveSecret(ctx, *t.CA)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no valid PEM certificates found in secret %q key %q", t.CA.Name, t.CA.Key)
+		}
+	}
+
+	if (t.Cert == nil) != (t.Key == nil) {
+		return nil, errors.New("a client certificate and key must be configured together")
+	}
+
+	if t.Cert != nil {
+		cert, err := resolver.ResolveSecret(ctx, *t.Cert)
+		if err != nil {
+			return nil, err
+		}
+		key, err := resolver.ResolveSecret(ctx, *t.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		keyPair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate in secret %q: %w", t.Cert.Name, err)
+		}
+		cfg.Certificates = []tls.Certificate{keyPair}
+	}
+
+	return cfg, nil
+}
@@ -34,7 +34,7 @@ import (
 	"github.com/gccloudone-aurora/podtracker/internal/tracking"
 )
 
-// A backend writer for writing PodInfo to stdout
+// A backend writer for writing records to stdout
 type StdoutWriter struct {
 	enabled bool
 }
@@ -43,12 +43,12 @@ type StdoutWriter struct {
 var _ BackendWriter = &StdoutWriter{}
 
 // Implement the BackendWriter interface
-func (s StdoutWriter) Write(info *tracking.PodInfo) error {
+func (s StdoutWriter) Write(record tracking.Record) error {
 	if !s.enabled {
-		return nil
+		return ErrRecordSkipped
 	}
 
-	resp, err := json.Marshal(info)
+	resp, err := json.Marshal(record)
 	if err != nil {
 		return err
 	}
@@ -57,6 +57,11 @@ func (s StdoutWriter) Write(info *tracking.PodInfo) error {
 	return err
 }
 
+// Close implements the BackendWriter interface. Records are written to stdout unbuffered, so there is nothing to flush
+func (s StdoutWriter) Close() error {
+	return nil
+}
+
 // StdoutConfig is a concrete way to configure the StdoutWriter
 type StdoutConfig struct {
 	Enabled bool `json:"enabled"`
@@ -28,26 +28,49 @@ SOFTWARE.
 package writer
 
 import (
+	"errors"
+
 	"github.com/gccloudone-aurora/podtracker/internal/tracking"
 )
 
+// ErrRecordSkipped is returned by BackendWriters which deliberately did not write a record, because they are disabled or because they don't
+// write records of its type. It is not a failure, so the record is not retried, but a ChainWriter does not link the record into its chain
+var ErrRecordSkipped = errors.New("record skipped by writer")
+
 // BackendWriter is an interface that describes what functions of a BackendWriter implementation should have
 type BackendWriter interface {
-	// Write takes PodInfo and writes/sends/publishes it to some backend store that implements the interface.
+	// Write takes a record (a PodInfo or a ServiceRecord) and writes/sends/publishes it to some backend store that implements the interface.
 	//
 	// Common implementations might include:
 	//   - HTTPS / API -based write
 	//   - Simply writing to stdout
-	Write(*tracking.PodInfo) error
+	Write(tracking.Record) error
+
+	// Close flushes any buffered records and releases the resources (such as network connections) held by the writer.
+	// Write is never called after Close
+	Close() error
 }
 
-// WriteToAll writes the provided PodInfo to all configured backends
-func WriteToAll(writers []BackendWriter, info *tracking.PodInfo) []error {
-	errors := []error{}
+// WriteToAll writes the provided record to all configured backends. Writers which skip the record (see ErrRecordSkipped) do not fail it
+func WriteToAll(writers []BackendWriter, record tracking.Record) []error {
+	errs := []error{}
 
 	// write using all the configured backend writers
 	for _, writer := range writers {
-		if err := writer.Write(info); err != nil {
+		if err := writer.Write(record); err != nil && !errors.Is(err, ErrRecordSkipped) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// CloseAll closes all the provided writers
+func CloseAll(writers []BackendWriter) []error {
+	errors := []error{}
+
+	for _, writer := range writers {
+		if err := writer.Close(); err != nil {
 			errors = append(errors, err)
 		}
 	}